@@ -0,0 +1,156 @@
+package docker
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AuthChallenge is one challenge of a WWW-Authenticate header, like `Bearer realm="https://auth",service="registry"`.
+type AuthChallenge struct {
+	// Scheme as sent, compare it with strings.EqualFold.
+	Scheme string
+	// Params by lower case name with unquoted values.
+	Params map[string]string
+	// Token68 is set for challenges like `Negotiate abc==` instead of params.
+	Token68 string
+}
+
+// IsBearer returns true for the Bearer scheme.
+func (a AuthChallenge) IsBearer() bool {
+	return strings.EqualFold(a.Scheme, "bearer")
+}
+
+// ParseAuthenticateHeader returns the Bearer challenge of the header or the first challenge if none is Bearer.
+func ParseAuthenticateHeader(header string) (AuthChallenge, error) {
+	challenges, err := ParseAuthChallenges(header)
+	if err != nil {
+		return AuthChallenge{}, err
+	}
+	for _, challenge := range challenges {
+		if challenge.IsBearer() {
+			return challenge, nil
+		}
+	}
+	return challenges[0], nil
+}
+
+// ParseAuthChallenges parses all challenges of a WWW-Authenticate header like `Basic realm="a", Bearer realm="b"`.
+// Quoted values may contain commas and backslash escapes.
+func ParseAuthChallenges(header string) ([]AuthChallenge, error) {
+	p := &authHeaderParser{header: header}
+	var challenges []AuthChallenge
+	for {
+		p.skip(" \t,")
+		if p.done() {
+			break
+		}
+		name := p.token()
+		if name == "" {
+			return nil, errors.Errorf("parse authenticate header '%s' failed: unexpected '%c' at %d", header, p.header[p.pos], p.pos)
+		}
+		p.skip(" \t")
+		if len(challenges) > 0 && p.peek() == '=' {
+			p.pos++
+			p.skip(" \t")
+			value, err := p.value()
+			if err != nil {
+				return nil, errors.Wrapf(err, "parse authenticate header '%s' failed", header)
+			}
+			challenges[len(challenges)-1].Params[strings.ToLower(name)] = value
+			continue
+		}
+		challenges = append(challenges, AuthChallenge{
+			Scheme:  name,
+			Params:  make(map[string]string),
+			Token68: p.token68(),
+		})
+	}
+	if len(challenges) == 0 {
+		return nil, errors.New("authenticate header is empty")
+	}
+	return challenges, nil
+}
+
+type authHeaderParser struct {
+	header string
+	pos    int
+}
+
+func (p *authHeaderParser) done() bool {
+	return p.pos >= len(p.header)
+}
+
+func (p *authHeaderParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.header[p.pos]
+}
+
+func (p *authHeaderParser) skip(chars string) {
+	for !p.done() && strings.IndexByte(chars, p.header[p.pos]) != -1 {
+		p.pos++
+	}
+}
+
+// token reads the token chars of RFC 7230, which exclude separators like '=', ',' and '"'.
+func (p *authHeaderParser) token() string {
+	start := p.pos
+	for !p.done() && isTokenChar(p.header[p.pos]) {
+		p.pos++
+	}
+	return p.header[start:p.pos]
+}
+
+// token68 reads a token68 directly following the scheme, params are left for the caller.
+func (p *authHeaderParser) token68() string {
+	end := p.pos
+	for end < len(p.header) && (isAlphaNum(p.header[end]) || strings.IndexByte("-._~+/", p.header[end]) != -1) {
+		end++
+	}
+	if end == p.pos {
+		return ""
+	}
+	for end < len(p.header) && p.header[end] == '=' {
+		end++
+	}
+	rest := strings.TrimLeft(p.header[end:], " \t")
+	if rest != "" && rest[0] != ',' {
+		return ""
+	}
+	result := p.header[p.pos:end]
+	p.pos = end
+	return result
+}
+
+func (p *authHeaderParser) value() (string, error) {
+	if p.peek() != '"' {
+		return p.token(), nil
+	}
+	var builder strings.Builder
+	for p.pos++; !p.done(); p.pos++ {
+		switch c := p.header[p.pos]; c {
+		case '"':
+			p.pos++
+			return builder.String(), nil
+		case '\\':
+			p.pos++
+			if p.done() {
+				return "", errors.New("unterminated escape")
+			}
+			builder.WriteByte(p.header[p.pos])
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return "", errors.New("unterminated quoted value")
+}
+
+func isTokenChar(c byte) bool {
+	return isAlphaNum(c) || strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1
+}
+
+func isAlphaNum(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
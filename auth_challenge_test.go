@@ -0,0 +1,64 @@
+package docker_test
+
+import (
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseAuthenticateHeader", func() {
+	It("parses a bearer challenge", func() {
+		challenge, err := docker.ParseAuthenticateHeader(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull",error="insufficient_scope"`)
+		Expect(err).To(BeNil())
+		Expect(challenge.IsBearer()).To(BeTrue())
+		Expect(challenge.Params).To(Equal(map[string]string{
+			"realm":   "https://auth.docker.io/token",
+			"service": "registry.docker.io",
+			"scope":   "repository:library/nginx:pull",
+			"error":   "insufficient_scope",
+		}))
+	})
+	It("keeps commas and escapes of quoted values", func() {
+		challenge, err := docker.ParseAuthenticateHeader(`Bearer realm="https://auth", scope="repository:team/app:pull,push", error_description="say \"hi\""`)
+		Expect(err).To(BeNil())
+		Expect(challenge.Params["scope"]).To(Equal("repository:team/app:pull,push"))
+		Expect(challenge.Params["error_description"]).To(Equal(`say "hi"`))
+	})
+	It("prefers the bearer challenge of multiple schemes", func() {
+		challenge, err := docker.ParseAuthenticateHeader(`Basic realm="basic, realm", Bearer realm="https://auth",service=registry`)
+		Expect(err).To(BeNil())
+		Expect(challenge.Scheme).To(Equal("Bearer"))
+		Expect(challenge.Params).To(Equal(map[string]string{"realm": "https://auth", "service": "registry"}))
+	})
+	It("returns the first challenge without bearer", func() {
+		challenge, err := docker.ParseAuthenticateHeader(`Basic realm="Registry"`)
+		Expect(err).To(BeNil())
+		Expect(challenge.IsBearer()).To(BeFalse())
+		Expect(challenge.Params["realm"]).To(Equal("Registry"))
+	})
+	It("lowers param names", func() {
+		challenge, err := docker.ParseAuthenticateHeader(`bearer Realm="https://auth"`)
+		Expect(err).To(BeNil())
+		Expect(challenge.IsBearer()).To(BeTrue())
+		Expect(challenge.Params["realm"]).To(Equal("https://auth"))
+	})
+	It("parses token68 challenges", func() {
+		challenges, err := docker.ParseAuthChallenges(`Negotiate abc+/def==, Basic realm="x"`)
+		Expect(err).To(BeNil())
+		Expect(challenges).To(HaveLen(2))
+		Expect(challenges[0].Token68).To(Equal("abc+/def=="))
+		Expect(challenges[1].Params["realm"]).To(Equal("x"))
+	})
+	It("rejects empty headers", func() {
+		_, err := docker.ParseAuthenticateHeader(" ")
+		Expect(err).NotTo(BeNil())
+	})
+	It("rejects unterminated quotes", func() {
+		_, err := docker.ParseAuthenticateHeader(`Bearer realm="https://auth`)
+		Expect(err).NotTo(BeNil())
+	})
+	It("rejects invalid characters", func() {
+		_, err := docker.ParseAuthenticateHeader(`Bearer realm="a", "b"`)
+		Expect(err).NotTo(BeNil())
+	})
+})
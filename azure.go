@@ -0,0 +1,131 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AzureTokenUsername is the username Azure Container Registry expects if an AAD access token is used as password.
+// Admin credentials use the admin username and password instead and are sent as basic auth to the token endpoint.
+const AzureTokenUsername = "00000000-0000-0000-0000-000000000000"
+
+// AzureTokenValidity is the shortest lifetime of an AAD access token of the Azure CLI.
+const AzureTokenValidity = time.Hour
+
+// IsAzure returns true if the registry is hosted on Azure Container Registry.
+func (r Registry) IsAzure() bool {
+	return strings.HasSuffix(r.host(), ".azurecr.io")
+}
+
+// CredentialsFromAzure uses the service principal of AZURE_CLIENT_ID and AZURE_CLIENT_SECRET
+// or sets an AAD access token of the logged in Azure CLI account as password.
+// The token is fetched with `az account get-access-token` and exchanged for an ACR refresh token on the first challenge,
+// PasswordExpires is set so a V2Client renews it.
+func (r *Registry) CredentialsFromAzure() error {
+	if !r.IsAzure() {
+		return errors.Errorf("registry %s is not an azure registry", r.Url)
+	}
+	if clientID, clientSecret := os.Getenv("AZURE_CLIENT_ID"), os.Getenv("AZURE_CLIENT_SECRET"); clientID != "" && clientSecret != "" {
+		// acr accepts service principals as basic auth
+		r.Username = clientID
+		r.Password = clientSecret
+		r.PasswordExpires = time.Time{}
+		return nil
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("az", "account", "get-access-token", "--query", "accessToken", "--output", "tsv")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(ErrUnauthorized, "az account get-access-token failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	token := strings.TrimSpace(stdout.String())
+	if token == "" {
+		return errors.Wrap(ErrUnauthorized, "az returned empty access token")
+	}
+	r.Username = AzureTokenUsername
+	r.Password = token
+	r.PasswordExpires = time.Now().Add(AzureTokenValidity)
+	return nil
+}
+
+// usesAzureToken returns true if the password is an AAD access token that must be exchanged instead of sent as basic auth.
+func (c *v2Client) usesAzureToken() bool {
+	return c.registry.IsAzure() && c.registry.Username == AzureTokenUsername && c.registry.Password != ""
+}
+
+// getAzureToken exchanges the AAD access token for an ACR refresh token at /oauth2/exchange
+// and trades the refresh token for an access token of the scope at the realm.
+// The refresh token is cached in memory until it expires, it is never written to the token cache dir.
+func (c *v2Client) getAzureToken(ctx context.Context, realm string, service string, scopes []string) (*tokenResponse, error) {
+	refreshToken, err := c.getAzureRefreshToken(ctx, realm, service)
+	if err != nil {
+		return nil, errors.Wrap(err, "exchange aad token failed")
+	}
+	values := url.Values{}
+	values.Set("grant_type", "refresh_token")
+	values.Set("service", service)
+	for _, scope := range scopes {
+		values.Add("scope", scope)
+	}
+	values.Set("refresh_token", refreshToken.String())
+	c.debugf("get azure token for scope %s from %s", strings.Join(scopes, " "), realm)
+	var data tokenResponse
+	if err := c.postForm(ctx, realm, values, &data); err != nil {
+		return nil, errors.Wrap(err, "request token failed")
+	}
+	if err := data.token().Validate(); err != nil {
+		return nil, errors.Wrap(err, "token response contains no valid access_token")
+	}
+	return &data, nil
+}
+
+func (c *v2Client) getAzureRefreshToken(ctx context.Context, realm string, service string) (RegistryToken, error) {
+	key := "azure-refresh " + service
+	if token, ok := c.refreshTokens.get(key); ok {
+		return token, nil
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse realm %s failed", realm)
+	}
+	u.Path = "/oauth2/exchange"
+	u.RawQuery = ""
+	_, accessToken, err := c.credentials()
+	if err != nil {
+		return "", err
+	}
+	values := url.Values{}
+	values.Set("grant_type", "access_token")
+	values.Set("service", service)
+	values.Set("access_token", accessToken)
+	c.debugf("exchange aad token at %s", u)
+	var data struct {
+		RefreshToken RegistryToken `json:"refresh_token"`
+	}
+	if err := c.postForm(ctx, u.String(), values, &data); err != nil {
+		return "", err
+	}
+	if err := data.RefreshToken.Validate(); err != nil {
+		return "", errors.Wrap(err, "exchange response contains no valid refresh_token")
+	}
+	c.refreshTokens.set(key, data.RefreshToken, tokenResponse{Token: data.RefreshToken.String()}.expires(time.Now()))
+	return data.RefreshToken, nil
+}
+
+func (c *v2Client) postForm(ctx context.Context, rawurl string, values url.Values, data interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, rawurl, strings.NewReader(values.Encode()))
+	if err != nil {
+		return errors.Wrap(err, "create request failed")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.httpClient.DoJSON(ctx, req, data)
+}
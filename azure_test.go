@@ -0,0 +1,128 @@
+package docker_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Azure", func() {
+	It("detects azurecr.io", func() {
+		Expect(docker.Registry{Url: "https://myregistry.azurecr.io"}.IsAzure()).To(BeTrue())
+		Expect(docker.Registry{Url: "myregistry.azurecr.io"}.IsAzure()).To(BeTrue())
+		Expect(docker.Registry{Url: "azurecr.io.example.com"}.IsAzure()).To(BeFalse())
+	})
+	Context("CredentialsFromAzure", func() {
+		var dir string
+		var oldPath, oldClientID, oldClientSecret string
+		BeforeEach(func() {
+			oldClientID = os.Getenv("AZURE_CLIENT_ID")
+			oldClientSecret = os.Getenv("AZURE_CLIENT_SECRET")
+			os.Unsetenv("AZURE_CLIENT_ID")
+			os.Unsetenv("AZURE_CLIENT_SECRET")
+			var err error
+			dir, err = ioutil.TempDir("", "docker-utils")
+			Expect(err).To(BeNil())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "az"), []byte("#!/bin/sh\necho aad-token\n"), 0755)).To(BeNil())
+			oldPath = os.Getenv("PATH")
+			os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+		})
+		AfterEach(func() {
+			os.Setenv("AZURE_CLIENT_ID", oldClientID)
+			os.Setenv("AZURE_CLIENT_SECRET", oldClientSecret)
+			os.Setenv("PATH", oldPath)
+			os.RemoveAll(dir)
+		})
+		It("sets aad token with expiry", func() {
+			registry := docker.Registry{Url: "https://myregistry.azurecr.io"}
+			Expect(registry.CredentialsFromAzure()).To(BeNil())
+			Expect(registry.Username).To(Equal(docker.AzureTokenUsername))
+			Expect(registry.Password).To(Equal("aad-token"))
+			Expect(registry.PasswordExpires).To(BeTemporally("~", time.Now().Add(docker.AzureTokenValidity), time.Minute))
+		})
+		It("uses the service principal of the environment", func() {
+			os.Setenv("AZURE_CLIENT_ID", "client-id")
+			os.Setenv("AZURE_CLIENT_SECRET", "client-secret")
+			registry := docker.Registry{Url: "https://myregistry.azurecr.io"}
+			Expect(registry.CredentialsFromAzure()).To(BeNil())
+			Expect(registry.Username).To(Equal("client-id"))
+			Expect(registry.Password).To(Equal("client-secret"))
+			Expect(registry.PasswordExpires.IsZero()).To(BeTrue())
+		})
+	})
+	Context("token exchange", func() {
+		var exchanges int
+		var registryAuth []string
+		var client docker.V2Client
+		var handler http.Handler
+		BeforeEach(func() {
+			exchanges = 0
+			registryAuth = nil
+			handler = http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/oauth2/exchange":
+					exchanges++
+					if req.FormValue("grant_type") != "access_token" || req.FormValue("access_token") != "aad-token" || req.FormValue("service") != "myregistry.azurecr.io" {
+						resp.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					fmt.Fprint(resp, `{"refresh_token":"acr-refresh"}`)
+				case "/oauth2/token":
+					if req.FormValue("grant_type") != "refresh_token" || req.FormValue("refresh_token") != "acr-refresh" {
+						resp.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					fmt.Fprintf(resp, `{"access_token":"access-%s"}`, req.FormValue("scope"))
+				default:
+					registryAuth = append(registryAuth, req.Header.Get("Authorization"))
+					if req.Header.Get("Authorization") != "Bearer access-repository:team/app:pull" {
+						resp.Header().Set("WWW-Authenticate", `Bearer realm="https://myregistry.azurecr.io/oauth2/token",service="myregistry.azurecr.io",scope="repository:team/app:pull"`)
+						resp.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					fmt.Fprint(resp, `{"name":"team/app","tags":["latest"]}`)
+				}
+			})
+			client = docker.NewV2Client(
+				docker.NewHttpClient(&http.Client{Transport: handlerTransport{handler}}),
+				docker.Registry{Url: "https://myregistry.azurecr.io", Username: docker.AzureTokenUsername, Password: "aad-token"},
+			)
+		})
+		It("exchanges the aad token for a scoped token", func() {
+			for i := 0; i < 2; i++ {
+				ch := make(chan docker.TagName, 10)
+				Expect(client.ListTags(context.Background(), "team/app", ch)).To(BeNil())
+				Expect(<-ch).To(Equal(docker.TagName("latest")))
+			}
+			Expect(exchanges).To(Equal(1))
+			Expect(registryAuth[0]).To(BeEmpty())
+		})
+		It("does not write the refresh token to the token cache dir", func() {
+			dir, err := ioutil.TempDir("", "docker-utils")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+			client = docker.NewV2Client(
+				docker.NewHttpClient(&http.Client{Transport: handlerTransport{handler}}),
+				docker.Registry{Url: "https://myregistry.azurecr.io", Username: docker.AzureTokenUsername, Password: "aad-token"},
+				docker.WithTokenCacheDir(dir),
+			)
+			ch := make(chan docker.TagName, 10)
+			Expect(client.ListTags(context.Background(), "team/app", ch)).To(BeNil())
+			files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+			Expect(err).To(BeNil())
+			Expect(files).To(HaveLen(1))
+			content, err := ioutil.ReadFile(files[0])
+			Expect(err).To(BeNil())
+			Expect(string(content)).To(ContainSubstring("access-repository:team/app:pull"))
+			Expect(string(content)).NotTo(ContainSubstring("acr-refresh"))
+		})
+	})
+})
@@ -0,0 +1,212 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type RegistryToken string
+
+func (r RegistryToken) String() string {
+	return string(r)
+}
+
+// Validate rejects empty tokens, which would result in a confusing 401 of the actual request.
+func (r RegistryToken) Validate() error {
+	if strings.TrimSpace(r.String()) == "" {
+		return errors.New("token is empty")
+	}
+	if strings.ContainsAny(r.String(), " \t\r\n") {
+		return errors.New("token contains whitespace")
+	}
+	return nil
+}
+
+// GetBearerToken fetches a token for the given scopes from the realm announced in a Bearer challenge.
+// Multiple scopes are sent as repeated scope parameters and result in one token covering all of them.
+// The registry credentials are sent as basic auth if present.
+func (c *v2Client) GetBearerToken(ctx context.Context, realm string, service string, scopes ...string) (RegistryToken, error) {
+	data, err := c.getBearerToken(ctx, realm, service, scopes...)
+	if err != nil {
+		return "", err
+	}
+	return data.token(), nil
+}
+
+func (c *v2Client) getBearerToken(ctx context.Context, realm string, service string, scopes ...string) (*tokenResponse, error) {
+	scopes = nonEmpty(scopes)
+	if c.usesAzureToken() {
+		return c.getAzureToken(ctx, realm, service, scopes)
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse realm %s failed", realm)
+	}
+	values := u.Query()
+	if service != "" {
+		values.Set("service", service)
+	}
+	for _, scope := range scopes {
+		values.Add("scope", scope)
+	}
+	u.RawQuery = values.Encode()
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "create request failed")
+	}
+	if !c.registry.IsAnonymous() {
+		username, password, err := c.credentials()
+		if err != nil {
+			return nil, err
+		}
+		req.SetBasicAuth(username, password)
+	}
+	c.debugf("get bearer token for scope %s from %s", strings.Join(scopes, " "), realm)
+	var data tokenResponse
+	if err := c.httpClient.DoJSON(ctx, req, &data); err != nil {
+		return nil, errors.Wrap(err, "request token failed")
+	}
+	if err := data.token().Validate(); err != nil {
+		return nil, errors.Wrap(err, "token response contains no valid token or access_token")
+	}
+	return &data, nil
+}
+
+// doWithBearerChallenge completes the bearer challenge of a 401 response and retries the request once.
+// The token is cached for further requests with the same scope until it expires.
+func (c *v2Client) doWithBearerChallenge(ctx context.Context, req *http.Request, resp *http.Response) (*http.Response, error) {
+	params, ok := c.bearerChallenge(resp.Header.Values("WWW-Authenticate"))
+	if !ok {
+		return resp, nil
+	}
+	resp.Body.Close()
+	// the scope parameter may list multiple scopes separated by space
+	scopes := strings.Fields(params["scope"])
+	if len(scopes) == 0 {
+		scopes = scopesForRequest(req)
+	} else if mount := mountScope(req); mount != "" && !containsString(scopes, mount) {
+		scopes = append(scopes, mount)
+	}
+	data, err := c.getBearerToken(ctx, params["realm"], params["service"], scopes...)
+	if err != nil && len(scopes) > 1 {
+		// some token servers reject multiple scopes, the token of the first scope still allows the request itself
+		c.debugf("get token for %d scopes failed, fallback to scope %s: %v", len(scopes), scopes[0], err)
+		data, err = c.getBearerToken(ctx, params["realm"], params["service"], scopes[0])
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "get bearer token failed")
+	}
+	token := data.token()
+	expires := data.expires(time.Now())
+	c.tokenCache.set(tokenCacheKey(req), token, expires)
+	if mountScope(req) != "" {
+		// the token also allows the upload into the destination if the registry does not mount
+		c.tokenCache.set(req.URL.Host+" "+scopeForRequest(req), token, expires)
+	}
+	retry, err := cloneRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	retry.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return c.httpClient.Do(ctx, retry)
+}
+
+// bearerChallenge returns the params of the first Bearer challenge with realm, a response may send multiple headers.
+func (c *v2Client) bearerChallenge(headers []string) (map[string]string, bool) {
+	for _, header := range headers {
+		challenges, err := ParseAuthChallenges(header)
+		if err != nil {
+			c.debugf("ignore invalid authenticate header: %v", err)
+			continue
+		}
+		for _, challenge := range challenges {
+			if challenge.IsBearer() && challenge.Params["realm"] != "" {
+				return challenge.Params, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// scopeForRequest derives the token scope for registries that do not announce one in the challenge.
+func scopeForRequest(req *http.Request) string {
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	if path == "_catalog" {
+		return "registry:catalog:*"
+	}
+	for _, marker := range []string{"/manifests/", "/tags/", "/blobs/", "/referrers/"} {
+		if i := strings.Index(path, marker); i > 0 {
+			actions := "pull"
+			switch req.Method {
+			case http.MethodDelete:
+				actions = "pull,delete"
+			case http.MethodPost, http.MethodPut, http.MethodPatch:
+				actions = "pull,push"
+			}
+			return fmt.Sprintf("repository:%s:%s", path[:i], actions)
+		}
+	}
+	return ""
+}
+
+// scopesForRequest returns the scope of the request and for blob mounts the pull scope of the source repository,
+// so a single token allows the cross repository mount.
+func scopesForRequest(req *http.Request) []string {
+	scope := scopeForRequest(req)
+	if scope == "" {
+		return nil
+	}
+	return nonEmpty([]string{scope, mountScope(req)})
+}
+
+// mountScope returns the pull scope of the source repository if the request mounts a blob.
+func mountScope(req *http.Request) string {
+	query := req.URL.Query()
+	if query.Get("mount") == "" || query.Get("from") == "" {
+		return ""
+	}
+	return fmt.Sprintf("repository:%s:pull", query.Get("from"))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func nonEmpty(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// errBodyNotReplayable is returned instead of resending a request whose streamed body was already sent.
+var errBodyNotReplayable = errors.New("request body can not be sent again")
+
+func cloneRequest(ctx context.Context, req *http.Request) (*http.Request, error) {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return nil, errors.Wrapf(errBodyNotReplayable, "%s request to %s", req.Method, req.URL.Host)
+	}
+	clone := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, errors.Wrap(err, "get request body failed")
+		}
+		clone.Body = body
+	}
+	return clone, nil
+}
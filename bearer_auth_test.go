@@ -0,0 +1,20 @@
+package docker_test
+
+import (
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RegistryToken", func() {
+	It("accepts a token", func() {
+		Expect(docker.RegistryToken("eyJhbGciOiJSUzI1NiJ9.e30.c2ln").Validate()).To(BeNil())
+	})
+	It("rejects empty token", func() {
+		Expect(docker.RegistryToken("").Validate()).NotTo(BeNil())
+		Expect(docker.RegistryToken(" ").Validate()).NotTo(BeNil())
+	})
+	It("rejects token with whitespace", func() {
+		Expect(docker.RegistryToken("abc def").Validate()).NotTo(BeNil())
+	})
+})
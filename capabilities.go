@@ -0,0 +1,120 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	capabilitiesProbeRepository = RepositoryName("docker-utils/capabilities-probe")
+	capabilitiesProbeDigest     = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+// DeleteCapability is what the probe found out about deleting manifests.
+type DeleteCapability string
+
+const (
+	// DeleteUnknown is returned if the registry does not report the allowed methods or rejects the probe with 401 or 403.
+	DeleteUnknown      DeleteCapability = "unknown"
+	DeleteSupported    DeleteCapability = "supported"
+	DeleteNotSupported DeleteCapability = "not-supported"
+)
+
+// Capabilities of a registry detected by cheap probe requests.
+type Capabilities struct {
+	V2        bool
+	Referrers bool
+	Delete    DeleteCapability
+}
+
+// Capabilities probes the registry once and returns the cached result afterwards.
+// The probes are a GET of /v2/, a GET of the referrers and an OPTIONS of a manifest
+// of the non existing repository docker-utils/capabilities-probe, nothing is modified.
+func (c *v2Client) Capabilities(ctx context.Context) (*Capabilities, error) {
+	c.capabilitiesMux.Lock()
+	defer c.capabilitiesMux.Unlock()
+	if c.capabilities != nil {
+		return c.capabilities, nil
+	}
+	capabilities, err := c.probeCapabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.debugf("registry %s has capabilities %+v", c.registry.BaseUrl(), *capabilities)
+	c.capabilities = capabilities
+	return c.capabilities, nil
+}
+
+func (c *v2Client) probeCapabilities(ctx context.Context) (*Capabilities, error) {
+	capabilities := Capabilities{Delete: DeleteUnknown}
+
+	statusCode, _, err := c.probe(ctx, http.MethodGet, fmt.Sprintf("%s/v2/", c.registry.BaseUrl()))
+	if err != nil {
+		return nil, errors.Wrap(err, "probe v2 failed")
+	}
+	capabilities.V2 = statusCode == http.StatusOK || statusCode == http.StatusUnauthorized
+	if !capabilities.V2 {
+		return &capabilities, nil
+	}
+
+	statusCode, contentType, err := c.probe(ctx, http.MethodGet, fmt.Sprintf("%s/v2/%s/referrers/%s", c.registry.BaseUrl(), capabilitiesProbeRepository, capabilitiesProbeDigest))
+	if err != nil {
+		return nil, errors.Wrap(err, "probe referrers failed")
+	}
+	// registries without referrers api answer with a plain text 404 of the router
+	capabilities.Referrers = statusCode == http.StatusOK || statusCode == http.StatusNotFound && strings.Contains(contentType, "json")
+
+	statusCode, allow, err := c.probeAllow(ctx, fmt.Sprintf("%s/v2/%s/manifests/%s", c.registry.BaseUrl(), capabilitiesProbeRepository, capabilitiesProbeDigest))
+	if err != nil {
+		return nil, errors.Wrap(err, "probe delete failed")
+	}
+	capabilities.Delete = deleteCapability(statusCode, allow)
+
+	return &capabilities, nil
+}
+
+// deleteCapability reads the Allow header, a rejected probe says nothing about the permissions on other repositories.
+func deleteCapability(statusCode int, allow string) DeleteCapability {
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden || allow == "" {
+		return DeleteUnknown
+	}
+	for _, method := range strings.Split(allow, ",") {
+		if strings.EqualFold(strings.TrimSpace(method), http.MethodDelete) {
+			return DeleteSupported
+		}
+	}
+	return DeleteNotSupported
+}
+
+func (c *v2Client) probe(ctx context.Context, method string, url string) (int, string, error) {
+	resp, err := c.probeResponse(ctx, method, url)
+	if err != nil {
+		return 0, "", err
+	}
+	return resp.StatusCode, resp.Header.Get("Content-Type"), nil
+}
+
+func (c *v2Client) probeAllow(ctx context.Context, url string) (int, string, error) {
+	resp, err := c.probeResponse(ctx, http.MethodOptions, url)
+	if err != nil {
+		return 0, "", err
+	}
+	return resp.StatusCode, strings.Join(resp.Header.Values("Allow"), ","), nil
+}
+
+func (c *v2Client) probeResponse(ctx context.Context, method string, url string) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "build request failed")
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
@@ -6,8 +6,8 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"time"
 
-	"github.com/golang/glog"
 	"github.com/pkg/errors"
 )
 
@@ -15,26 +15,31 @@ type DockerHubClient interface {
 	ListRepositories(ctx context.Context, repositoryName RepositoryName, ch chan<- DockerHubTagRepository) error
 	ListTags(ctx context.Context, repositoryName RepositoryName, ch chan<- DockerHubTag) error
 	DeleteTag(ctx context.Context, repositoryName RepositoryName, tag TagName) error
+	RepositoryInfo(ctx context.Context, repositoryName RepositoryName) (*DockerHubRepositoryInfo, error)
+	LastRateLimit() (RateLimit, bool)
 }
 
 type dockerHubClient struct {
+	clientOptions
 	httpClient HttpClient
 	registry   Registry
 
 	dockerhubMux   sync.Mutex
-	dockerhubToken string
+	dockerhubToken cachedToken
 
-	dockerIoMux   sync.Mutex
-	dockerIoToken string
+	rateLimitRecorder
 }
 
 func NewDockerHubClient(
 	httpClient HttpClient,
 	registry Registry,
+	options ...ClientOption,
 ) DockerHubClient {
+	o := newClientOptions(options)
 	return &dockerHubClient{
-		httpClient: httpClient,
-		registry:   registry,
+		clientOptions: o,
+		httpClient:    newUserAgentHttpClient(httpClient, o.userAgent, o.logger),
+		registry:      registry,
 	}
 }
 
@@ -52,9 +57,9 @@ func (c *dockerHubClient) ListRepositories(ctx context.Context, repositoryName R
 	for {
 		select {
 		case <-ctx.Done():
-			return nil
+			return ctx.Err()
 		default:
-			glog.V(2).Infof("request url: %v", url)
+			c.debugf("request url: %v", url)
 			req, err := http.NewRequest(http.MethodGet, url, nil)
 			if err != nil {
 				return errors.Wrap(err, "create http request failed")
@@ -67,7 +72,11 @@ func (c *dockerHubClient) ListRepositories(ctx context.Context, repositoryName R
 				return errors.Wrap(err, "perform http request failed")
 			}
 			for _, result := range response.Results {
-				ch <- result
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case ch <- result:
+				}
 			}
 			if len(response.Next) == 0 {
 				return nil
@@ -87,9 +96,9 @@ func (c *dockerHubClient) ListTags(ctx context.Context, repositoryName Repositor
 	for {
 		select {
 		case <-ctx.Done():
-			return nil
+			return ctx.Err()
 		default:
-			glog.V(2).Infof("request url: %v", url)
+			c.debugf("request url: %v", url)
 			req, err := http.NewRequest(http.MethodGet, url, nil)
 			if err != nil {
 				return errors.Wrap(err, "create http request failed")
@@ -102,7 +111,11 @@ func (c *dockerHubClient) ListTags(ctx context.Context, repositoryName Repositor
 				return errors.Wrap(err, "perform http request failed")
 			}
 			for _, result := range response.Results {
-				ch <- result
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case ch <- result:
+				}
 			}
 			if len(response.Next) == 0 {
 				return nil
@@ -113,70 +126,153 @@ func (c *dockerHubClient) ListTags(ctx context.Context, repositoryName Repositor
 }
 func (c *dockerHubClient) DeleteTag(ctx context.Context, repositoryName RepositoryName, tag TagName) error {
 	url := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/tags/%s/", repositoryName.String(), tag.String())
+	action := PlannedAction{
+		Type:       PlannedActionDeleteTag,
+		Repository: repositoryName,
+		Tag:        tag,
+	}
+	if c.dryRun {
+		c.infof("dry run: would delete %s:%s", repositoryName, tag)
+		c.planned(c.registry, action, true)
+		return nil
+	}
 	req, err := http.NewRequest(http.MethodDelete, url, nil)
 	if err != nil {
 		return errors.Wrap(err, "create http request failed")
 	}
-	if _, err := c.doSuccess(ctx, req); err != nil {
+	resp, err := c.doSuccess(ctx, req)
+	if err != nil {
 		return err
 	}
+	resp.Body.Close()
+	c.planned(c.registry, action, false)
 	return nil
 }
 
+// DockerHubRepositoryInfo contains the statistics hub.docker.com shows for a repository.
+type DockerHubRepositoryInfo struct {
+	Namespace   string    `json:"namespace"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	PullCount   int64     `json:"pull_count"`
+	StarCount   int64     `json:"star_count"`
+	LastUpdated time.Time `json:"last_updated"`
+}
+
+// RepositoryInfo returns pull count, star count and last update of the repository, official images like nginx are found in library.
+// Only Docker Hub offers the statistics, other registries return an error without request.
+func (c *dockerHubClient) RepositoryInfo(ctx context.Context, repositoryName RepositoryName) (*DockerHubRepositoryInfo, error) {
+	if !c.registry.IsDockerHub() {
+		return nil, errors.Errorf("repository info is only available on Docker Hub, not %s", c.registry.Url)
+	}
+	url := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/", repositoryName.Normalize(c.registry))
+	c.debugf("request url: %v", url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "create http request failed")
+	}
+	var info DockerHubRepositoryInfo
+	if err := c.doJSON(ctx, req, &info); err != nil {
+		return nil, errors.Wrapf(err, "get repository info of %s failed", repositoryName)
+	}
+	return &info, nil
+}
+
+// addAuth logs in with the credentials, public repositories are requested without jwt if there are none.
 func (c *dockerHubClient) addAuth(ctx context.Context, req *http.Request) error {
-	glog.V(2).Infof("auth with hub.docker.com")
+	if c.registry.IsAnonymous() {
+		return nil
+	}
+	c.debugf("auth with %s", c.registry.LoginUrl())
 	token, err := c.getDockerHubToken(ctx)
 	if err != nil {
 		return errors.Wrap(err, "get token failed")
 	}
 	req.Header.Add("Authorization", fmt.Sprintf("JWT %s", token))
-	glog.V(2).Infof("set Authorization header")
+	c.debugf("set Authorization header")
 	return nil
 }
 
+// do retries the request once with a fresh token if the cached one is rejected.
 func (c *dockerHubClient) do(ctx context.Context, req *http.Request) (*http.Response, error) {
 	err := c.addAuth(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-	return c.httpClient.Do(ctx, req)
+	resp, err := c.httpClient.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	c.record(resp.Header)
+	if resp.StatusCode != http.StatusUnauthorized || c.registry.IsAnonymous() {
+		return resp, nil
+	}
+	resp.Body.Close()
+	c.invalidateDockerHubToken()
+	retry, err := cloneRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	retry.Header.Del("Authorization")
+	if err := c.addAuth(ctx, retry); err != nil {
+		return nil, err
+	}
+	resp, err = c.httpClient.Do(ctx, retry)
+	if err != nil {
+		return nil, err
+	}
+	c.record(resp.Header)
+	return resp, nil
 }
 
 func (c *dockerHubClient) doSuccess(ctx context.Context, req *http.Request) (*http.Response, error) {
-	err := c.addAuth(ctx, req)
+	resp, err := c.do(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-	return c.httpClient.DoSuccess(ctx, req)
+	if err := checkSuccess(req, resp, c.logger); err != nil {
+		return nil, err
+	}
+	return resp, nil
 }
 
 func (c *dockerHubClient) doJSON(ctx context.Context, req *http.Request, data interface{}) error {
-	err := c.addAuth(ctx, req)
+	resp, err := c.doSuccess(ctx, req)
 	if err != nil {
 		return err
 	}
-	return c.httpClient.DoJSON(ctx, req, data)
+	return decodeJSON(resp, data, c.logger)
 }
 
-func (c *dockerHubClient) getDockerHubToken(ctx context.Context) (string, error) {
+// getDockerHubToken logs in once and reuses the jwt until shortly before its exp claim.
+func (c *dockerHubClient) getDockerHubToken(ctx context.Context) (RegistryToken, error) {
 	defer c.dockerhubMux.Unlock()
 	c.dockerhubMux.Lock()
-	if c.dockerhubToken == "" {
+	if c.dockerhubToken.token == "" || time.Now().Add(tokenExpiryMargin).After(c.dockerhubToken.expires) {
 		b := bytes.NewBufferString(fmt.Sprintf(`{"username": "%s", "password": "%s"}`, c.registry.Username, c.registry.Password))
-		req, err := http.NewRequest("POST", "https://hub.docker.com/v2/users/login/", b)
+		req, err := http.NewRequest("POST", c.registry.LoginUrl(), b)
 		if err != nil {
 			return "", errors.Wrap(err, "create request failed")
 		}
 		req.Header.Add("Content-Type", "application/json")
-		var data struct {
-			Token       string `json:"token"`
-			AccessToken string `json:"access_token"`
-		}
+		var data tokenResponse
 		if err := c.httpClient.DoJSON(ctx, req, &data); err != nil {
 			return "", errors.Wrap(err, "request failed")
 		}
-		glog.V(2).Infof("got token: %s", data.Token)
-		c.dockerhubToken = data.Token
+		if err := data.token().Validate(); err != nil {
+			return "", errors.Wrapf(ErrUnauthorized, "login response contains no valid token: %v", err)
+		}
+		c.debugf("got token")
+		c.dockerhubToken = cachedToken{
+			token:   data.token(),
+			expires: data.expires(time.Now()),
+		}
 	}
-	return c.dockerhubToken, nil
+	return c.dockerhubToken.token, nil
+}
+
+func (c *dockerHubClient) invalidateDockerHubToken() {
+	defer c.dockerhubMux.Unlock()
+	c.dockerhubMux.Lock()
+	c.dockerhubToken = cachedToken{}
 }
@@ -0,0 +1,68 @@
+package docker_test
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DockerHubClient", func() {
+	var logins []string
+	var authorizations []string
+	var client docker.DockerHubClient
+	var httpClient *http.Client
+	BeforeEach(func() {
+		logins = nil
+		authorizations = nil
+		httpClient = &http.Client{Transport: handlerTransport{handler: http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodPost {
+				logins = append(logins, req.URL.String())
+				resp.Write([]byte(`{"token":"jwt"}`))
+				return
+			}
+			authorizations = append(authorizations, req.Header.Get("Authorization"))
+			if req.URL.Path == "/v2/repositories/library/nginx/" {
+				resp.Write([]byte(`{"namespace":"library","name":"nginx","pull_count":1000000,"star_count":42,"last_updated":"2026-01-02T03:04:05.123456Z"}`))
+				return
+			}
+			resp.Write([]byte(`{"results":[{"name":"1.0.0"}]}`))
+		})}}
+		client = docker.NewDockerHubClient(
+			docker.NewHttpClient(httpClient),
+			docker.Registry{Url: "docker.io", Username: "user", Password: "secret", AuthUrl: "https://hub.example.com/api/login"},
+		)
+	})
+	It("logs in at the configured auth url", func() {
+		ch := make(chan docker.DockerHubTag, 10)
+		Expect(client.ListTags(context.Background(), "user/app", ch)).To(BeNil())
+		Expect(logins).To(Equal([]string{"https://hub.example.com/api/login"}))
+		Expect(authorizations).To(Equal([]string{"JWT jwt"}))
+		Expect(ch).To(Receive(Equal(docker.DockerHubTag{Tag: "1.0.0"})))
+	})
+	It("returns the repository info of official images", func() {
+		info, err := client.RepositoryInfo(context.Background(), "nginx")
+		Expect(err).To(BeNil())
+		Expect(info.Namespace).To(Equal("library"))
+		Expect(info.PullCount).To(Equal(int64(1000000)))
+		Expect(info.StarCount).To(Equal(int64(42)))
+		Expect(info.LastUpdated).To(Equal(time.Date(2026, 1, 2, 3, 4, 5, 123456000, time.UTC)))
+		Expect(authorizations).To(Equal([]string{"JWT jwt"}))
+	})
+	It("requests the repository info without login if anonymous", func() {
+		client = docker.NewDockerHubClient(docker.NewHttpClient(httpClient), docker.Registry{Url: "docker.io"})
+		_, err := client.RepositoryInfo(context.Background(), "nginx")
+		Expect(err).To(BeNil())
+		Expect(logins).To(BeEmpty())
+		Expect(authorizations).To(Equal([]string{""}))
+	})
+	It("rejects other registries", func() {
+		client = docker.NewDockerHubClient(docker.NewHttpClient(httpClient), docker.Registry{Url: "registry.example.com"})
+		_, err := client.RepositoryInfo(context.Background(), "team/app")
+		Expect(err).NotTo(BeNil())
+		Expect(authorizations).To(BeEmpty())
+	})
+})
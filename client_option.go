@@ -0,0 +1,52 @@
+package docker
+
+// DefaultPageSize is the number of entries requested per catalog or tags page.
+const DefaultPageSize = 1000
+
+type ClientOption func(o *clientOptions)
+
+type clientOptions struct {
+	pageSize  int
+	dryRun    bool
+	platform  Platform
+	harbor    bool
+	userAgent string
+	// tokenCacheDir persists tokens if not empty
+	tokenCacheDir string
+	plan          *Plan
+	// logger replaces the default of SetLogger if not nil
+	logger Logger
+}
+
+func newClientOptions(options []ClientOption) clientOptions {
+	o := clientOptions{
+		pageSize: DefaultPageSize,
+		platform: DefaultPlatform,
+	}
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
+
+// WithPageSize sets the n query parameter used for catalog and tags pagination.
+func WithPageSize(pageSize int) ClientOption {
+	return func(o *clientOptions) {
+		o.pageSize = pageSize
+	}
+}
+
+// WithDryRun makes all mutating operations only log the intended action without sending the mutating request.
+// Use WithPlan to get the actions as PlannedAction.
+func WithDryRun(dryRun bool) ClientOption {
+	return func(o *clientOptions) {
+		o.dryRun = dryRun
+	}
+}
+
+// WithPlatform selects the manifest of the given platform if a tag points to a multi-arch manifest list.
+func WithPlatform(platform Platform) ClientOption {
+	return func(o *clientOptions) {
+		o.platform = platform
+	}
+}
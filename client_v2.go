@@ -2,125 +2,468 @@ package docker
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
-	"regexp"
+	"net/url"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/golang/glog"
 	"github.com/pkg/errors"
 )
 
 type V2Client interface {
+	Ping(ctx context.Context) error
 	ListRepositories(ctx context.Context, ch chan<- RepositoryName) error
+	EachRepository(ctx context.Context, fn func(repositoryName RepositoryName) error) error
+	StreamRepositories(ctx context.Context) (<-chan RepositoryName, <-chan error)
+	ListRepositoriesAfter(ctx context.Context, after RepositoryName, n int) ([]RepositoryName, error)
+	ListRepositoriesFiltered(ctx context.Context, filter RepositoryFilter, ch chan<- RepositoryName) error
 	DeleteTag(ctx context.Context, repositoryName RepositoryName, tag TagName) error
 	ExistsTag(ctx context.Context, repositoryName RepositoryName, tag TagName) (bool, error)
 	ListTags(ctx context.Context, repositoryName RepositoryName, ch chan<- TagName) error
+	EachTag(ctx context.Context, repositoryName RepositoryName, fn func(tag TagName) error) error
+	ListTagsAfter(ctx context.Context, repositoryName RepositoryName, after TagName, n int) ([]TagName, error)
+	ListTagsSortedSemver(ctx context.Context, repositoryName RepositoryName) ([]TagName, error)
+	LatestTag(ctx context.Context, repositoryName RepositoryName) (TagName, error)
+	DeleteMatching(ctx context.Context, repositoryName RepositoryName, matcher TagMatcher, dryRun bool) ([]TagName, error)
+	Prune(ctx context.Context, repositoryName RepositoryName, keep int, options PruneOptions) ([]TagName, error)
+	ListTagsForRepositories(ctx context.Context, repositoryNames []RepositoryName, concurrency int) (map[RepositoryName][]TagName, error)
+	CountRepositories(ctx context.Context) (int, error)
+	Summary(ctx context.Context, options SummaryOptions) (*RegistrySummary, error)
 	Sha(ctx context.Context, repositoryName RepositoryName, tag TagName) (string, error)
+	Digest(ctx context.Context, repositoryName RepositoryName, tag TagName) (Digest, error)
 	Manifest(ctx context.Context, repositoryName RepositoryName, tag TagName) (*Manifest, error)
+	ManifestByReference(ctx context.Context, repositoryName RepositoryName, reference string) (*Manifest, Digest, error)
+	Manifests(ctx context.Context, repositoryName RepositoryName, tag TagName) ([]PlatformManifest, error)
+	HasPlatform(ctx context.Context, repositoryName RepositoryName, tag TagName, platform Platform) (bool, error)
+	ManifestForPlatform(ctx context.Context, repositoryName RepositoryName, tag TagName, platform Platform) (*Manifest, Digest, error)
+	RawManifest(ctx context.Context, repositoryName RepositoryName, tag TagName) ([]byte, string, error)
+	ImageConfig(ctx context.Context, repositoryName RepositoryName, tag TagName) (*ImageConfig, error)
+	Created(ctx context.Context, repositoryName RepositoryName, tag TagName) (time.Time, error)
+	Labels(ctx context.Context, repositoryName RepositoryName, tag TagName) (map[string]string, error)
+	Size(ctx context.Context, repositoryName RepositoryName, tag TagName) (int64, error)
+	Capabilities(ctx context.Context) (*Capabilities, error)
+	Pin(ctx context.Context, repository Repository) (Digest, error)
+	PinAll(ctx context.Context, repositories []Repository, concurrency int) (map[Repository]Digest, error)
+	GetBearerToken(ctx context.Context, realm string, service string, scopes ...string) (RegistryToken, error)
+	LastRateLimit() (RateLimit, bool)
 }
 
 type v2Client struct {
+	clientOptions
 	httpClient HttpClient
 	registry   Registry
+
+	capabilitiesMux sync.Mutex
+	capabilities    *Capabilities
+
+	tokenCache tokenCache
+	// refreshTokens keeps the long-lived azure refresh tokens in memory only
+	refreshTokens tokenCache
+	rateLimitRecorder
+
+	// credentialsMux guards the renewed credentials of registries with PasswordExpires
+	credentialsMux  sync.Mutex
+	username        string
+	password        string
+	passwordExpires time.Time
 }
 
 func NewV2Client(
 	httpClient HttpClient,
 	registry Registry,
+	options ...ClientOption,
 ) V2Client {
+	o := newClientOptions(options)
 	return &v2Client{
-		httpClient: httpClient,
-		registry:   registry,
+		clientOptions: o,
+		httpClient:    newUserAgentHttpClient(httpClient, o.userAgent, o.logger),
+		registry:      registry,
+		tokenCache:    newTokenCache(o.tokenCacheDir, registry.tokenCacheUsername(), o.logger),
 	}
 }
 
+// repositoryUrl returns the url of the path below the normalized repository.
+func (c *v2Client) repositoryUrl(repositoryName RepositoryName, path string) string {
+	return fmt.Sprintf("%s/v2/%s/%s", c.registry.BaseUrl(), repositoryName.Normalize(c.registry), path)
+}
+
+// StreamRepositories emits repositories while the catalog is fetched page by page.
+// Both channels are closed when the catalog is complete, the error channel receives at most one error.
+// The caller must drain the repositories or cancel the context.
+func (c *v2Client) StreamRepositories(ctx context.Context) (<-chan RepositoryName, <-chan error) {
+	repositories := make(chan RepositoryName, runtime.NumCPU())
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(repositories)
+		if err := c.ListRepositories(ctx, repositories); err != nil {
+			errs <- err
+		}
+	}()
+	return repositories, errs
+}
+
 func (c *v2Client) ListRepositories(ctx context.Context, ch chan<- RepositoryName) error {
-	url := fmt.Sprintf("%s/v2/_catalog", c.registry.Url)
-	glog.V(2).Infof("request url: %v", url)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	return c.EachRepository(ctx, func(repositoryName RepositoryName) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ch <- repositoryName:
+		}
+		return nil
+	})
+}
+
+// EachRepository calls fn for every repository of the catalog while the pages arrive, without collecting the catalog.
+// An error returned by fn stops the listing and is returned.
+func (c *v2Client) EachRepository(ctx context.Context, fn func(repositoryName RepositoryName) error) error {
+	if c.harbor {
+		return c.eachHarborRepository(ctx, fn)
+	}
+	err := c.paginate(ctx, fmt.Sprintf("%s/v2/_catalog", c.registry.BaseUrl()), func(decoder *json.Decoder) error {
+		var response struct {
+			Repositories []RepositoryName `json:"repositories"`
+		}
+		if err := decoder.Decode(&response); err != nil {
+			return errors.Wrap(err, "decode http response to json failed")
+		}
+		for _, repositoryName := range response.Repositories {
+			if err := fn(repositoryName); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return catalogError(c.registry, err)
+}
+
+// catalogError explains a missing catalog, many hosted registries disable the _catalog endpoint.
+func catalogError(registry Registry, err error) error {
+	if errors.Cause(err) != ErrNotFound {
+		return err
+	}
+	if registry.IsQuay() {
+		return errors.Wrap(err, "quay.io does not serve the _catalog api, list repositories with the quay api instead")
+	}
+	return errors.Wrap(err, "registry does not serve the _catalog api")
+}
+
+// errListComplete stops the pagination once enough entries are collected.
+var errListComplete = errors.New("list complete")
+
+// ListRepositoriesAfter returns up to n repositories of the catalog following after, using the last parameter of the catalog api.
+// An empty after starts at the beginning, n <= 0 returns all remaining repositories.
+// The last returned repository is the checkpoint for the next call, an empty result means the catalog is complete.
+func (c *v2Client) ListRepositoriesAfter(ctx context.Context, after RepositoryName, n int) ([]RepositoryName, error) {
+	names, err := c.listAfter(ctx, fmt.Sprintf("%s/v2/_catalog", c.registry.BaseUrl()), after.String(), n, func(decoder *json.Decoder) ([]string, error) {
+		var response struct {
+			Repositories []string `json:"repositories"`
+		}
+		err := decoder.Decode(&response)
+		return response.Repositories, err
+	})
 	if err != nil {
-		return errors.Wrap(err, "create http request failed")
+		return nil, catalogError(c.registry, err)
 	}
-	var response struct {
-		Repositories []RepositoryName `json:"repositories"`
+	result := make([]RepositoryName, len(names))
+	for i, name := range names {
+		result[i] = RepositoryName(name)
 	}
-	if err := c.doJSON(ctx, req, &response); err != nil {
-		return errors.Wrap(err, "perform http request failed")
+	return result, nil
+}
+
+// ListTagsAfter returns up to n tags of the repository following after in the order of the registry, like ListRepositoriesAfter.
+// The last returned tag is the checkpoint to resume the listing, an empty result means all tags are listed.
+func (c *v2Client) ListTagsAfter(ctx context.Context, repositoryName RepositoryName, after TagName, n int) ([]TagName, error) {
+	names, err := c.listAfter(ctx, c.repositoryUrl(repositoryName, "tags/list"), after.String(), n, func(decoder *json.Decoder) ([]string, error) {
+		var response struct {
+			Tags []string `json:"tags"`
+		}
+		err := decoder.Decode(&response)
+		return response.Tags, err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "list tags of %s failed", repositoryName)
 	}
-	for _, repositoryName := range response.Repositories {
-		ch <- repositoryName
+	result := make([]TagName, len(names))
+	for i, name := range names {
+		result[i] = TagName(name)
 	}
-	return nil
+	return result, nil
+}
+
+// listAfter pages through a catalog or tags list starting after the given name until n names are collected.
+func (c *v2Client) listAfter(ctx context.Context, rawurl string, after string, n int, decode func(decoder *json.Decoder) ([]string, error)) ([]string, error) {
+	values := url.Values{}
+	if after != "" {
+		values.Set("last", after)
+	}
+	if n > 0 && n < c.pageSize {
+		values.Set("n", strconv.Itoa(n))
+	}
+	result := []string{}
+	err := c.paginate(ctx, rawurl+"?"+values.Encode(), func(decoder *json.Decoder) error {
+		names, err := decode(decoder)
+		if err != nil {
+			return errors.Wrap(err, "decode http response to json failed")
+		}
+		for _, name := range names {
+			if n > 0 && len(result) >= n {
+				return errListComplete
+			}
+			result = append(result, name)
+		}
+		if n > 0 && len(result) >= n {
+			return errListComplete
+		}
+		return nil
+	})
+	if err != nil && err != errListComplete {
+		return nil, err
+	}
+	return result, nil
 }
 
 func (c *v2Client) DeleteTag(ctx context.Context, repositoryName RepositoryName, tag TagName) error {
+	if !c.dryRun {
+		if err := c.checkDeleteSupported(ctx); err != nil {
+			return err
+		}
+	}
 	dockerContentDigest, err := c.Sha(ctx, repositoryName, tag)
+	if errors.Cause(err) == ErrNotFound {
+		return errors.Wrapf(err, "tag %s:%s not found or already deleted", repositoryName, tag)
+	}
 	if err != nil {
 		return errors.Wrap(err, "get content digest failed")
 	}
-	url := fmt.Sprintf("%s/v2/%v/manifests/%v", c.registry.Url, repositoryName.String(), dockerContentDigest)
+	if c.dryRun {
+		c.infof("dry run: would delete %s:%s (%s)", repositoryName, tag, dockerContentDigest)
+		c.plannedDelete(repositoryName, tag, Digest(dockerContentDigest), true)
+		return nil
+	}
+	if err := c.deleteManifest(ctx, repositoryName, tag, Digest(dockerContentDigest)); err != nil {
+		return err
+	}
+	c.plannedDelete(repositoryName, tag, Digest(dockerContentDigest), false)
+	return nil
+}
+
+func (c *v2Client) plannedDelete(repositoryName RepositoryName, tag TagName, digest Digest, dryRun bool) {
+	c.planned(c.registry, PlannedAction{
+		Type:       PlannedActionDeleteManifest,
+		Repository: repositoryName,
+		Tag:        tag,
+		Digest:     digest,
+	}, dryRun)
+}
+
+// checkDeleteSupported returns ErrDeleteNotSupported if the capabilities show delete is disabled.
+// Unknown capabilities do not prevent the delete.
+func (c *v2Client) checkDeleteSupported(ctx context.Context) error {
+	capabilities, err := c.Capabilities(ctx)
+	if err != nil {
+		c.warningf("get capabilities failed: %v", err)
+		return nil
+	}
+	if capabilities.V2 && capabilities.Delete == DeleteNotSupported {
+		return ErrDeleteNotSupported
+	}
+	return nil
+}
+
+// deleteManifest deletes the manifest by digest, which removes all tags pointing to it.
+func (c *v2Client) deleteManifest(ctx context.Context, repositoryName RepositoryName, tag TagName, dockerContentDigest Digest) error {
+	url := c.repositoryUrl(repositoryName, "manifests/"+dockerContentDigest.String())
 	req, err := http.NewRequest(http.MethodDelete, url, nil)
 	if err != nil {
 		return errors.Wrap(err, "build request failed")
 	}
-	_, err = c.doSuccess(ctx, req)
-	if err != nil {
+	resp, err := c.doSuccess(ctx, req)
+	switch errors.Cause(err) {
+	case nil:
+	case ErrDeleteNotSupported:
+		return errors.Wrapf(err, "delete %s:%s failed, registry has delete disabled", repositoryName, tag)
+	case ErrNotFound:
+		return errors.Wrapf(err, "delete %s:%s failed, manifest %s already deleted", repositoryName, tag, dockerContentDigest)
+	default:
 		return errors.Wrap(err, "perform http request failed")
 	}
-	glog.V(2).Infof("tag deleted")
+	resp.Body.Close()
+	c.debugf("tag deleted")
 	return nil
 }
 
 func (c *v2Client) Sha(ctx context.Context, repositoryName RepositoryName, tag TagName) (string, error) {
-	url := fmt.Sprintf("%s/v2/%v/manifests/%v", c.registry.Url, repositoryName.String(), tag.String())
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	digest, err := c.Digest(ctx, repositoryName, tag)
+	if err != nil {
+		return "", err
+	}
+	return digest.String(), nil
+}
+
+// ExistsTag checks the tag with a HEAD request on its manifest, a missing tag or repository returns false.
+func (c *v2Client) ExistsTag(ctx context.Context, repositoryName RepositoryName, tag TagName) (bool, error) {
+	url := c.repositoryUrl(repositoryName, "manifests/"+tag.String())
+	req, err := http.NewRequest(http.MethodHead, url, nil)
 	if err != nil {
-		return "", errors.Wrap(err, "build request failed")
+		return false, errors.Wrap(err, "build request failed")
 	}
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+	req.Header.Add("Accept", acceptManifestMediaTypes())
 	resp, err := c.doSuccess(ctx, req)
+	if errors.Cause(err) == ErrNotFound {
+		c.debugf("tag not found")
+		return false, nil
+	}
 	if err != nil {
-		return "", errors.Wrap(err, "perform http request failed")
+		return false, errors.Wrapf(err, "check tag %s:%s failed", repositoryName, tag)
 	}
-	return resp.Header.Get("Docker-Content-Digest"), nil
+	resp.Body.Close()
+	c.debugf("found tag")
+	return true, nil
 }
 
-func (c *v2Client) ExistsTag(ctx context.Context, repositoryName RepositoryName, tag TagName) (bool, error) {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	tags := make(chan TagName, runtime.NumCPU())
-	go func() {
-		defer close(tags)
-		if err := c.ListTags(ctx, repositoryName, tags); err != nil {
-			glog.Warningf("list tags failed :%v", err)
+func (c *v2Client) ListTags(ctx context.Context, repositoryName RepositoryName, ch chan<- TagName) error {
+	return c.EachTag(ctx, repositoryName, func(tag TagName) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ch <- tag:
 		}
-	}()
-	for t := range tags {
-		if t == tag {
-			glog.V(2).Infof("found tag")
-			return true, nil
+		return nil
+	})
+}
+
+// EachTag calls fn for every tag of the repository while the pages arrive, like EachRepository.
+func (c *v2Client) EachTag(ctx context.Context, repositoryName RepositoryName, fn func(tag TagName) error) error {
+	return c.paginate(ctx, c.repositoryUrl(repositoryName, "tags/list"), func(decoder *json.Decoder) error {
+		var response struct {
+			Tags []TagName `json:"tags"`
 		}
-	}
-	glog.V(2).Infof("tag not found")
-	return false, nil
+		if err := decoder.Decode(&response); err != nil {
+			return errors.Wrap(err, "decode http response to json failed")
+		}
+		for _, tag := range response.Tags {
+			if err := fn(tag); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (c *v2Client) ListTags(ctx context.Context, repositoryName RepositoryName, ch chan<- TagName) error {
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/v2/%s/tags/list", c.registry.Url, repositoryName.String()), nil)
+// paginate requests the given url page by page and follows the rel="next" Link header.
+func (c *v2Client) paginate(ctx context.Context, rawurl string, handle func(decoder *json.Decoder) error) error {
+	if c.pageSize <= 0 {
+		return errors.Errorf("invalid page size %d", c.pageSize)
+	}
+	u, err := url.Parse(rawurl)
 	if err != nil {
-		return errors.Wrap(err, "create http request failed")
+		return errors.Wrapf(err, "parse url %s failed", rawurl)
 	}
-	var response struct {
-		Tags []TagName `json:"tags"`
+	seen := make(map[string]bool)
+	for u != nil {
+		c.setPageSize(u)
+		if seen[u.String()] {
+			return errors.Errorf("pagination loop detected at %s", u)
+		}
+		seen[u.String()] = true
+		c.debugf("request url: %v", u)
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return errors.Wrap(err, "create http request failed")
+		}
+		resp, err := c.doSuccess(ctx, req)
+		if err != nil {
+			return errors.Wrap(err, "perform http request failed")
+		}
+		err = handle(json.NewDecoder(resp.Body))
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		u, err = nextLink(resp.Header, req.URL)
+		if err != nil {
+			return err
+		}
 	}
-	if err := c.doJSON(ctx, req, &response); err != nil {
-		return errors.Wrap(err, "perform http request failed")
+	return nil
+}
+
+// setPageSize adds the n parameter if the url, e.g. a next link of the registry, does not have it.
+func (c *v2Client) setPageSize(u *url.URL) {
+	values := u.Query()
+	if values.Get("n") != "" {
+		return
 	}
-	for _, result := range response.Tags {
-		ch <- result
+	values.Set("n", strconv.Itoa(c.pageSize))
+	u.RawQuery = values.Encode()
+}
+
+// nextLink returns the target of the rel="next" Link header resolved against the request url.
+// Targets may be absolute or relative to the request.
+func nextLink(header http.Header, base *url.URL) (*url.URL, error) {
+	for _, value := range header["Link"] {
+		for _, link := range parseLinks(value) {
+			if !link.hasRel("next") {
+				continue
+			}
+			target, err := url.Parse(link.target)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parse link %s failed", link.target)
+			}
+			return base.ResolveReference(target), nil
+		}
+	}
+	return nil, nil
+}
+
+type link struct {
+	target string
+	rel    string
+}
+
+func (l link) hasRel(rel string) bool {
+	for _, value := range strings.Fields(l.rel) {
+		if strings.EqualFold(value, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLinks splits a Link header value like `<url1>; rel="next", <url2>; rel="prev"`.
+// Commas inside the angle brackets are part of the url.
+func parseLinks(value string) []link {
+	var links []link
+	for {
+		start := strings.Index(value, "<")
+		if start == -1 {
+			return links
+		}
+		end := strings.Index(value[start:], ">")
+		if end == -1 {
+			return links
+		}
+		l := link{target: value[start+1 : start+end]}
+		value = value[start+end+1:]
+		params := value
+		if next := strings.Index(value, "<"); next != -1 {
+			params = value[:next]
+		}
+		for _, param := range strings.Split(params, ";") {
+			parts := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(parts) == 2 && strings.EqualFold(strings.TrimSpace(parts[0]), "rel") {
+				l.rel = strings.Trim(strings.TrimSpace(strings.TrimRight(strings.TrimSpace(parts[1]), ",")), `"`)
+			}
+		}
+		links = append(links, l)
 	}
-	return nil
 }
 
 type ManifestConfig struct {
@@ -132,68 +475,160 @@ type ManifestConfig struct {
 type Manifest struct {
 	SchemaVersion int              `json:"schemaVersion"`
 	MediaType     string           `json:"mediaType"`
+	ArtifactType  string           `json:"artifactType,omitempty"`
 	Config        ManifestConfig   `json:"config"`
 	Layers        []ManifestConfig `json:"layers"`
+	// Blobs replaces layers in the deprecated OCI artifact manifest.
+	Blobs []ManifestConfig `json:"blobs,omitempty"`
+	// Manifests is only set for manifest lists and oci indexes.
+	Manifests   []ManifestDescriptor `json:"manifests,omitempty"`
+	Subject     *ManifestDescriptor  `json:"subject,omitempty"`
+	Annotations map[string]string    `json:"annotations,omitempty"`
+}
+
+// Type returns the artifactType or the config media type, e.g. MediaTypeHelmChartConfig to select Helm charts.
+// Container images return the media type of their image config.
+func (m Manifest) Type() string {
+	if m.ArtifactType != "" {
+		return m.ArtifactType
+	}
+	if m.Config.MediaType == MediaTypeOCIEmpty {
+		return ""
+	}
+	return m.Config.MediaType
+}
+
+// ConfigDigest returns the digest of the config blob, empty for manifest lists.
+func (m Manifest) ConfigDigest() Digest {
+	return Digest(m.Config.Digest)
+}
+
+// LayerDigests returns the digests of the layers in order, or of the blobs of an OCI artifact manifest.
+func (m Manifest) LayerDigests() []Digest {
+	result := []Digest{}
+	for _, layer := range m.Layers {
+		result = append(result, Digest(layer.Digest))
+	}
+	for _, blob := range m.Blobs {
+		result = append(result, Digest(blob.Digest))
+	}
+	return result
+}
+
+// ManifestDescriptor references the manifest of one platform in a manifest list.
+type ManifestDescriptor struct {
+	MediaType    string    `json:"mediaType"`
+	ArtifactType string    `json:"artifactType,omitempty"`
+	Size         int       `json:"size"`
+	Digest       string    `json:"digest"`
+	Platform     *Platform `json:"platform,omitempty"`
 }
 
 func (c *v2Client) Manifest(ctx context.Context, repositoryName RepositoryName, tag TagName) (*Manifest, error) {
-	url := fmt.Sprintf("%s/v2/%v/manifests/%v", c.registry.Url, repositoryName.String(), tag.String())
+	url := c.repositoryUrl(repositoryName, "manifests/"+tag.String())
 	method := http.MethodGet
 	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "build request failed")
 	}
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+	req.Header.Add("Accept", acceptImageManifestMediaTypes())
 	var manifest Manifest
 	if err := c.doJSON(ctx, req, &manifest); err != nil {
 		return nil, errors.Wrap(err, "perform http request failed")
 	}
-	glog.V(2).Infof("manifest %v", manifest)
+	c.debugf("manifest %v", manifest)
 	return &manifest, nil
 }
 
+// Token service of the Docker Hub registry. hub.docker.com is only the web api used by the Hub client.
+const (
+	dockerIoRealm   = "https://auth.docker.io/token"
+	dockerIoService = "registry.docker.io"
+)
+
 func (c *v2Client) addAuth(ctx context.Context, req *http.Request) error {
-	if req.URL.Host == "registry-1.docker.io" {
-		glog.V(2).Infof("auth with registry.docker.io")
+	if req.URL.Host == "registry-1.docker.io" && scopeForRequest(req) != "" {
+		c.debugf("auth with registry.docker.io")
 		token, err := c.getDockerIoToken(ctx, req)
 		if err != nil {
 			return errors.Wrap(err, "get token failed")
 		}
-		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-		glog.V(2).Infof("set Authorization header")
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		c.debugf("set Authorization header")
 		return nil
 	}
-	if c.registry.Username != "" && c.registry.Password != "" {
-		glog.V(2).Infof("basic auth")
-		req.SetBasicAuth(c.registry.Username, c.registry.Password)
-		glog.V(2).Infof("set basic auth")
+	if token, ok := c.tokenCache.get(tokenCacheKey(req)); ok {
+		c.debugf("use cached bearer token")
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		return nil
+	}
+	// an aad token is only sent to the exchange endpoint
+	if !c.registry.IsAnonymous() && !c.usesAzureToken() {
+		c.debugf("basic auth")
+		username, password, err := c.credentials()
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(username, password)
+		c.debugf("set basic auth")
 		return nil
 	}
 	return nil
 }
 
-func (c *v2Client) getDockerIoToken(ctx context.Context, req *http.Request) (string, error) {
-	re, err := regexp.Compile(`(?is)^/v2/(.*?/.*?)/`)
-	if err != nil {
-		return "", errors.Wrap(err, "invalid regex")
+// renewPasswordBefore renews expiring passwords before requests in flight could fail with an expired token.
+const renewPasswordBefore = 10 * time.Minute
+
+// credentials returns username and password of the registry and renews expiring ECR, Google and Azure tokens.
+func (c *v2Client) credentials() (string, string, error) {
+	if c.registry.PasswordExpires.IsZero() || !c.registry.IsECR() && !c.registry.IsGoogle() && !c.registry.IsAzure() {
+		return c.registry.Username, c.registry.Password, nil
 	}
-	matches := re.FindStringSubmatch(req.URL.Path)
-	if len(matches) < 2 {
-		return "", errors.New("regex does not match")
+	c.credentialsMux.Lock()
+	defer c.credentialsMux.Unlock()
+	if c.username == "" {
+		c.username = c.registry.Username
+		c.password = c.registry.Password
+		c.passwordExpires = c.registry.PasswordExpires
+	}
+	if !c.passwordExpires.IsZero() && time.Now().Add(renewPasswordBefore).After(c.passwordExpires) {
+		c.debugf("renew password expiring at %v", c.passwordExpires)
+		registry := c.registry
+		renew := registry.CredentialsFromECR
+		switch {
+		case registry.IsGoogle():
+			renew = registry.CredentialsFromGoogle
+		case registry.IsAzure():
+			renew = registry.CredentialsFromAzure
+		}
+		if err := renew(); err != nil {
+			return "", "", errors.Wrap(err, "renew password failed")
+		}
+		c.username = registry.Username
+		c.password = registry.Password
+		c.passwordExpires = registry.PasswordExpires
 	}
-	var data struct {
-		Token string `json:"token"`
+	return c.username, c.password, nil
+}
+
+// getDockerIoToken fetches the registry token from auth.docker.io for the scope of the request without waiting for the challenge.
+// The credentials are sent as basic auth, so private repositories work too.
+func (c *v2Client) getDockerIoToken(ctx context.Context, req *http.Request) (RegistryToken, error) {
+	key := tokenCacheKey(req)
+	if token, ok := c.tokenCache.get(key); ok {
+		return token, nil
 	}
-	repository := matches[1]
-	glog.V(2).Infof("get token for repository: %s", repository)
-	req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("https://auth.docker.io/token?service=registry.docker.io&scope=repository:%s:pull,push,delete", repository), nil)
+	data, err := c.getBearerToken(ctx, dockerIoRealm, dockerIoService, scopesForRequest(req)...)
 	if err != nil {
-		return "", errors.Wrap(err, "create request failed")
-	}
-	if err := c.httpClient.DoJSON(ctx, req, &data); err != nil {
 		return "", err
 	}
-	return data.Token, nil
+	c.tokenCache.set(key, data.token(), data.expires(time.Now()))
+	return data.token(), nil
+}
+
+// tokenCacheKey identifies the token needed for the request by host and scopes.
+func tokenCacheKey(req *http.Request) string {
+	return req.URL.Host + " " + strings.Join(scopesForRequest(req), " ")
 }
 
 func (c *v2Client) do(ctx context.Context, req *http.Request) (*http.Response, error) {
@@ -201,21 +636,57 @@ func (c *v2Client) do(ctx context.Context, req *http.Request) (*http.Response, e
 	if err != nil {
 		return nil, err
 	}
-	return c.httpClient.Do(ctx, req)
+	resp, err := c.httpClient.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	// a rejected token is refreshed and the request retried once, a second 401 is returned
+	if resp.StatusCode == http.StatusUnauthorized {
+		c.tokenCache.invalidate(tokenCacheKey(req))
+		if _, ok := c.bearerChallenge(resp.Header.Values("WWW-Authenticate")); ok {
+			resp, err = c.doWithBearerChallenge(ctx, req, resp)
+		} else if strings.HasPrefix(req.Header.Get("Authorization"), "Bearer ") {
+			resp, err = c.retryWithFreshToken(ctx, req, resp)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.record(resp.Header)
+	return resp, nil
+}
+
+// retryWithFreshToken repeats a request whose token got rejected without new challenge, e.g. expired in between.
+// The token was invalidated before, so addAuth fetches a new one.
+func (c *v2Client) retryWithFreshToken(ctx context.Context, req *http.Request, resp *http.Response) (*http.Response, error) {
+	resp.Body.Close()
+	c.debugf("token rejected by %s, retry with fresh token", req.URL.Host)
+	retry, err := cloneRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	retry.Header.Del("Authorization")
+	if err := c.addAuth(ctx, retry); err != nil {
+		return nil, err
+	}
+	return c.httpClient.Do(ctx, retry)
 }
 
 func (c *v2Client) doSuccess(ctx context.Context, req *http.Request) (*http.Response, error) {
-	err := c.addAuth(ctx, req)
+	resp, err := c.do(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-	return c.httpClient.DoSuccess(ctx, req)
+	if err := checkSuccess(req, resp, c.logger); err != nil {
+		return nil, err
+	}
+	return resp, nil
 }
 
 func (c *v2Client) doJSON(ctx context.Context, req *http.Request, data interface{}) error {
-	err := c.addAuth(ctx, req)
+	resp, err := c.doSuccess(ctx, req)
 	if err != nil {
 		return err
 	}
-	return c.httpClient.DoJSON(ctx, req, data)
+	return decodeJSON(resp, data, c.logger)
 }
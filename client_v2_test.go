@@ -0,0 +1,1084 @@
+package docker_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("V2Client", func() {
+	var server *httptest.Server
+	var mux sync.Mutex
+	var requests []*http.Request
+	var handler http.HandlerFunc
+	var client docker.V2Client
+	var options []docker.ClientOption
+	BeforeEach(func() {
+		requests = nil
+		options = nil
+		handler = func(resp http.ResponseWriter, req *http.Request) {
+			resp.WriteHeader(http.StatusNotFound)
+		}
+		server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			mux.Lock()
+			requests = append(requests, req)
+			mux.Unlock()
+			handler(resp, req)
+		}))
+	})
+	JustBeforeEach(func() {
+		client = docker.NewV2Client(docker.NewHttpClient(server.Client()), docker.Registry{Url: server.URL}, options...)
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	Context("ListRepositories", func() {
+		var repositories []docker.RepositoryName
+		var err error
+		BeforeEach(func() {
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				if req.URL.Query().Get("last") == "" {
+					resp.Header().Set("Link", fmt.Sprintf(`</v2/_catalog?last=b&n=%s>; rel="next"`, req.URL.Query().Get("n")))
+					fmt.Fprint(resp, `{"repositories":["a","b"]}`)
+					return
+				}
+				fmt.Fprint(resp, `{"repositories":["c"]}`)
+			}
+		})
+		JustBeforeEach(func() {
+			ch := make(chan docker.RepositoryName, 10)
+			err = client.ListRepositories(context.Background(), ch)
+			close(ch)
+			repositories = nil
+			for repository := range ch {
+				repositories = append(repositories, repository)
+			}
+		})
+		It("returns no error", func() {
+			Expect(err).To(BeNil())
+		})
+		It("follows next links", func() {
+			Expect(repositories).To(Equal([]docker.RepositoryName{"a", "b", "c"}))
+			Expect(requests).To(HaveLen(2))
+		})
+		It("sends default page size", func() {
+			Expect(requests[0].URL.Query().Get("n")).To(Equal("1000"))
+		})
+		Context("with page size", func() {
+			BeforeEach(func() {
+				options = append(options, docker.WithPageSize(2))
+			})
+			It("sends page size", func() {
+				Expect(requests[0].URL.Query().Get("n")).To(Equal("2"))
+				Expect(requests[1].URL.Query().Get("n")).To(Equal("2"))
+			})
+		})
+		Context("with invalid page size", func() {
+			BeforeEach(func() {
+				options = append(options, docker.WithPageSize(0))
+			})
+			It("returns error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(requests).To(HaveLen(0))
+			})
+		})
+	})
+	Context("Ping", func() {
+		var err error
+		var statusCode int
+		BeforeEach(func() {
+			statusCode = http.StatusOK
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				resp.WriteHeader(statusCode)
+			}
+		})
+		JustBeforeEach(func() {
+			err = client.Ping(context.Background())
+		})
+		It("succeeds for v2 registry", func() {
+			Expect(err).To(BeNil())
+			Expect(requests[0].URL.Path).To(Equal("/v2/"))
+		})
+		Context("with rejected credentials", func() {
+			BeforeEach(func() {
+				statusCode = http.StatusUnauthorized
+			})
+			It("returns unauthorized", func() {
+				Expect(errors.Cause(err)).To(Equal(docker.ErrUnauthorized))
+			})
+		})
+		Context("without v2 api", func() {
+			BeforeEach(func() {
+				statusCode = http.StatusNotFound
+			})
+			It("returns not v2 registry", func() {
+				Expect(errors.Cause(err)).To(Equal(docker.ErrNotV2Registry))
+			})
+		})
+		Context("with unavailable registry", func() {
+			BeforeEach(func() {
+				statusCode = http.StatusServiceUnavailable
+			})
+			It("returns unavailable", func() {
+				Expect(errors.Cause(err)).To(Equal(docker.ErrUnavailable))
+			})
+		})
+	})
+	Context("LastRateLimit", func() {
+		BeforeEach(func() {
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/v2/bborbe/app/manifests/1.0.0" {
+					resp.Header().Set("RateLimit-Limit", "100;w=21600")
+					resp.Header().Set("RateLimit-Remaining", "76;w=21600")
+					resp.Header().Set("Docker-Content-Digest", testDigest)
+				}
+				resp.WriteHeader(http.StatusOK)
+			}
+		})
+		It("returns false before any response reported a rate limit", func() {
+			Expect(client.Ping(context.Background())).To(BeNil())
+			_, ok := client.LastRateLimit()
+			Expect(ok).To(BeFalse())
+		})
+		It("returns rate limit of last response", func() {
+			_, err := client.Digest(context.Background(), "bborbe/app", "1.0.0")
+			Expect(err).To(BeNil())
+			Expect(client.Ping(context.Background())).To(BeNil())
+			rateLimit, ok := client.LastRateLimit()
+			Expect(ok).To(BeTrue())
+			Expect(rateLimit).To(Equal(docker.RateLimit{Limit: 100, Remaining: 76, Window: 6 * time.Hour}))
+		})
+	})
+	Context("Capabilities", func() {
+		var allow string
+		var optionsStatusCode int
+		BeforeEach(func() {
+			allow = "GET, HEAD, PUT"
+			optionsStatusCode = http.StatusOK
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				switch {
+				case req.URL.Path == "/v2/":
+					resp.WriteHeader(http.StatusOK)
+				case req.Method == http.MethodOptions:
+					resp.Header().Set("Allow", allow)
+					resp.WriteHeader(optionsStatusCode)
+				case req.Method == http.MethodDelete:
+					resp.WriteHeader(http.StatusMethodNotAllowed)
+				default:
+					resp.Header().Set("Content-Type", "text/plain")
+					resp.WriteHeader(http.StatusNotFound)
+				}
+			}
+		})
+		It("detects capabilities", func() {
+			capabilities, err := client.Capabilities(context.Background())
+			Expect(err).To(BeNil())
+			Expect(*capabilities).To(Equal(docker.Capabilities{V2: true, Referrers: false, Delete: docker.DeleteNotSupported}))
+		})
+		It("probes delete without deleting", func() {
+			_, err := client.Capabilities(context.Background())
+			Expect(err).To(BeNil())
+			for _, req := range requests {
+				Expect(req.Method).NotTo(Equal(http.MethodDelete))
+			}
+		})
+		It("detects delete from the allow header", func() {
+			allow = "GET, HEAD, PUT, DELETE"
+			capabilities, err := client.Capabilities(context.Background())
+			Expect(err).To(BeNil())
+			Expect(capabilities.Delete).To(Equal(docker.DeleteSupported))
+		})
+		It("does not know delete if the probe is rejected", func() {
+			optionsStatusCode = http.StatusForbidden
+			capabilities, err := client.Capabilities(context.Background())
+			Expect(err).To(BeNil())
+			Expect(capabilities.Delete).To(Equal(docker.DeleteUnknown))
+		})
+		It("caches capabilities", func() {
+			_, err := client.Capabilities(context.Background())
+			Expect(err).To(BeNil())
+			_, err = client.Capabilities(context.Background())
+			Expect(err).To(BeNil())
+			Expect(requests).To(HaveLen(3))
+		})
+		It("fails fast on delete", func() {
+			err := client.DeleteTag(context.Background(), "bborbe/app", "1.0.0")
+			Expect(err).To(Equal(docker.ErrDeleteNotSupported))
+			Expect(requests).To(HaveLen(3))
+		})
+	})
+	Context("StreamRepositories", func() {
+		BeforeEach(func() {
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				if req.URL.Query().Get("last") == "" {
+					resp.Header().Set("Link", `</v2/_catalog?last=b>; rel="next"`)
+					fmt.Fprint(resp, `{"repositories":["a","b"]}`)
+					return
+				}
+				resp.WriteHeader(http.StatusInternalServerError)
+			}
+		})
+		It("emits repositories of fetched pages and the error", func() {
+			repositories, errs := client.StreamRepositories(context.Background())
+			var result []docker.RepositoryName
+			for repository := range repositories {
+				result = append(result, repository)
+			}
+			Expect(result).To(Equal([]docker.RepositoryName{"a", "b"}))
+			err := <-errs
+			Expect(errors.Cause(err)).To(Equal(docker.ErrUnavailable))
+			_, open := <-errs
+			Expect(open).To(BeFalse())
+		})
+	})
+	Context("ListRepositoriesFiltered", func() {
+		var filter docker.RepositoryFilter
+		var repositories []docker.RepositoryName
+		var err error
+		BeforeEach(func() {
+			filter = docker.RepositoryFilter{}
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				if req.URL.Query().Get("last") == "" {
+					resp.Header().Set("Link", `</v2/_catalog?last=team%2Fb>; rel="next"`)
+					fmt.Fprint(resp, `{"repositories":["other/a","team/a","team/b"]}`)
+					return
+				}
+				fmt.Fprint(resp, `{"repositories":["team/c1","team/d"]}`)
+			}
+		})
+		JustBeforeEach(func() {
+			ch := make(chan docker.RepositoryName, 10)
+			err = client.ListRepositoriesFiltered(context.Background(), filter, ch)
+			close(ch)
+			repositories = nil
+			for repository := range ch {
+				repositories = append(repositories, repository)
+			}
+		})
+		It("returns all repositories without filter", func() {
+			Expect(err).To(BeNil())
+			Expect(repositories).To(HaveLen(5))
+		})
+		Context("with prefix", func() {
+			BeforeEach(func() {
+				filter.Prefix = "team/"
+			})
+			It("returns matching repositories of all pages", func() {
+				Expect(err).To(BeNil())
+				Expect(repositories).To(Equal([]docker.RepositoryName{"team/a", "team/b", "team/c1", "team/d"}))
+			})
+		})
+		Context("with prefix and regexp", func() {
+			BeforeEach(func() {
+				filter.Prefix = "team/"
+				filter.Regexp = regexp.MustCompile(`[0-9]$`)
+			})
+			It("returns repositories matching both", func() {
+				Expect(err).To(BeNil())
+				Expect(repositories).To(Equal([]docker.RepositoryName{"team/c1"}))
+			})
+		})
+	})
+	Context("ListTagsForRepositories", func() {
+		BeforeEach(func() {
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/v2/bborbe/app/tags/list":
+					fmt.Fprint(resp, `{"name":"bborbe/app","tags":["1.0.0","1.1.0"]}`)
+				case "/v2/bborbe/empty/tags/list":
+					fmt.Fprint(resp, `{"name":"bborbe/empty","tags":[]}`)
+				default:
+					resp.WriteHeader(http.StatusNotFound)
+				}
+			}
+		})
+		It("returns tags of successful repositories and combined errors", func() {
+			result, err := client.ListTagsForRepositories(context.Background(), []docker.RepositoryName{"bborbe/app", "bborbe/empty", "bborbe/missing"}, docker.DefaultConcurrency)
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("bborbe/missing"))
+			Expect(err.Error()).NotTo(ContainSubstring("bborbe/app"))
+			Expect(result).To(Equal(map[docker.RepositoryName][]docker.TagName{
+				"bborbe/app":   {"1.0.0", "1.1.0"},
+				"bborbe/empty": {},
+			}))
+		})
+		It("returns error for invalid concurrency", func() {
+			_, err := client.ListTagsForRepositories(context.Background(), nil, 0)
+			Expect(err).NotTo(BeNil())
+		})
+		It("runs at most concurrency requests in parallel", func() {
+			var running, maxRunning int32
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				current := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					old := atomic.LoadInt32(&maxRunning)
+					if current <= old || atomic.CompareAndSwapInt32(&maxRunning, old, current) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				fmt.Fprint(resp, `{"tags":["1.0.0"]}`)
+			}
+			var repositoryNames []docker.RepositoryName
+			for i := 0; i < 10; i++ {
+				repositoryNames = append(repositoryNames, docker.RepositoryName(fmt.Sprintf("bborbe/app%d", i)))
+			}
+			result, err := client.ListTagsForRepositories(context.Background(), repositoryNames, 2)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(10))
+			Expect(atomic.LoadInt32(&maxRunning)).To(BeNumerically("<=", 2))
+		})
+		It("does not start repositories after the context is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			result, err := client.ListTagsForRepositories(ctx, []docker.RepositoryName{"bborbe/app", "bborbe/empty"}, 1)
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("context canceled"))
+			Expect(result).To(BeEmpty())
+		})
+	})
+	Context("PinAll", func() {
+		BeforeEach(func() {
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/v2/bborbe/app/manifests/1.0.0" {
+					resp.Header().Set("Docker-Content-Digest", testDigest)
+					resp.WriteHeader(http.StatusOK)
+					return
+				}
+				resp.WriteHeader(http.StatusNotFound)
+			}
+		})
+		It("returns pinned digests and combined errors", func() {
+			result, err := client.PinAll(context.Background(), []docker.Repository{
+				{Name: "bborbe/app", Tag: "1.0.0"},
+				{Name: "bborbe/app", Tag: "missing"},
+			}, 2)
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("bborbe/app:missing"))
+			Expect(result).To(Equal(map[docker.Repository]docker.Digest{
+				{Name: "bborbe/app", Tag: "1.0.0"}: testDigest,
+			}))
+		})
+		It("returns error for invalid concurrency", func() {
+			_, err := client.PinAll(context.Background(), nil, 0)
+			Expect(err).NotTo(BeNil())
+		})
+	})
+	Context("DeleteTag", func() {
+		var err error
+		BeforeEach(func() {
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/v2/bborbe/app/manifests/1.0.0" {
+					resp.Header().Set("Docker-Content-Digest", testDigest)
+				}
+				resp.WriteHeader(http.StatusAccepted)
+			}
+		})
+		JustBeforeEach(func() {
+			err = client.DeleteTag(context.Background(), "bborbe/app", "1.0.0")
+		})
+		It("deletes manifest by digest", func() {
+			Expect(err).To(BeNil())
+			Expect(requests[len(requests)-1].Method).To(Equal(http.MethodDelete))
+			Expect(requests[len(requests)-1].URL.Path).To(Equal("/v2/bborbe/app/manifests/" + testDigest))
+		})
+		Context("with delete disabled for repository", func() {
+			BeforeEach(func() {
+				handler = func(resp http.ResponseWriter, req *http.Request) {
+					switch {
+					case req.URL.Path == "/v2/bborbe/app/manifests/1.0.0":
+						resp.Header().Set("Docker-Content-Digest", testDigest)
+					case req.URL.Path == "/v2/bborbe/app/manifests/"+testDigest:
+						resp.WriteHeader(http.StatusMethodNotAllowed)
+						return
+					}
+					resp.WriteHeader(http.StatusAccepted)
+				}
+			})
+			It("returns delete not supported", func() {
+				Expect(errors.Cause(err)).To(Equal(docker.ErrDeleteNotSupported))
+			})
+		})
+		Context("with unknown tag", func() {
+			BeforeEach(func() {
+				handler = func(resp http.ResponseWriter, req *http.Request) {
+					if req.URL.Path == "/v2/bborbe/app/manifests/1.0.0" {
+						resp.WriteHeader(http.StatusNotFound)
+						return
+					}
+					resp.WriteHeader(http.StatusAccepted)
+				}
+			})
+			It("returns not found", func() {
+				Expect(errors.Cause(err)).To(Equal(docker.ErrNotFound))
+			})
+		})
+		Context("with dry run", func() {
+			BeforeEach(func() {
+				options = append(options, docker.WithDryRun(true))
+			})
+			It("issues no mutating request", func() {
+				Expect(err).To(BeNil())
+				Expect(requests).NotTo(BeEmpty())
+				for _, req := range requests {
+					Expect(req.Method).To(Or(Equal(http.MethodGet), Equal(http.MethodHead)))
+				}
+			})
+		})
+	})
+	Context("ImageConfig", func() {
+		BeforeEach(func() {
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/v2/team/app/manifests/multi":
+					fmt.Fprint(resp, `{"schemaVersion":2,"mediaType":"`+docker.MediaTypeDockerManifestList+`","manifests":[`+
+						`{"digest":"sha256:arm","platform":{"os":"linux","architecture":"arm64"}},`+
+						`{"digest":"sha256:amd","platform":{"os":"linux","architecture":"amd64"}}]}`)
+				case "/v2/team/app/manifests/1.0.0", "/v2/team/app/manifests/sha256:amd":
+					fmt.Fprint(resp, `{"schemaVersion":2,"config":{"digest":"sha256:config-amd"}}`)
+				case "/v2/team/app/manifests/sha256:arm":
+					fmt.Fprint(resp, `{"schemaVersion":2,"config":{"digest":"sha256:config-arm"}}`)
+				case "/v2/team/app/blobs/sha256:config-amd":
+					fmt.Fprint(resp, `{"created":"2020-01-02T03:04:05Z","config":{"Entrypoint":["/app"],"ExposedPorts":{"8080/tcp":{}},"Labels":{"org.opencontainers.image.revision":"abc"}}}`)
+				case "/v2/team/app/blobs/sha256:config-arm":
+					fmt.Fprint(resp, `{"created":"2021-01-02T03:04:05Z"}`)
+				default:
+					resp.WriteHeader(http.StatusNotFound)
+				}
+			}
+		})
+		It("reads created from the image config", func() {
+			created, err := client.Created(context.Background(), "team/app", "1.0.0")
+			Expect(err).To(BeNil())
+			Expect(created).To(Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+		})
+		It("returns the container config", func() {
+			config, err := client.ImageConfig(context.Background(), "team/app", "1.0.0")
+			Expect(err).To(BeNil())
+			Expect(config.Config.Entrypoint).To(Equal([]string{"/app"}))
+			Expect(config.Config.ExposedPorts).To(HaveKey("8080/tcp"))
+		})
+		It("returns the labels", func() {
+			labels, err := client.Labels(context.Background(), "team/app", "1.0.0")
+			Expect(err).To(BeNil())
+			Expect(labels).To(Equal(map[string]string{"org.opencontainers.image.revision": "abc"}))
+		})
+		It("uses the default platform of manifest lists", func() {
+			created, err := client.Created(context.Background(), "team/app", "multi")
+			Expect(err).To(BeNil())
+			Expect(created).To(Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+		})
+		Context("with platform", func() {
+			BeforeEach(func() {
+				options = append(options, docker.WithPlatform(docker.Platform{OS: "linux", Architecture: "arm64"}))
+			})
+			It("uses the given platform", func() {
+				created, err := client.Created(context.Background(), "team/app", "multi")
+				Expect(err).To(BeNil())
+				Expect(created).To(Equal(time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)))
+			})
+			It("returns empty labels for images without labels", func() {
+				labels, err := client.Labels(context.Background(), "team/app", "multi")
+				Expect(err).To(BeNil())
+				Expect(labels).NotTo(BeNil())
+				Expect(labels).To(BeEmpty())
+			})
+		})
+		Context("with platform missing in manifest list", func() {
+			BeforeEach(func() {
+				options = append(options, docker.WithPlatform(docker.Platform{OS: "windows", Architecture: "amd64"}))
+			})
+			It("returns not found", func() {
+				_, err := client.Created(context.Background(), "team/app", "multi")
+				Expect(errors.Cause(err)).To(Equal(docker.ErrNotFound))
+			})
+		})
+	})
+	Context("Manifests", func() {
+		singleArchManifest := `{"schemaVersion":2,"mediaType":"` + docker.MediaTypeDockerManifest + `","config":{"digest":"sha256:config"}}`
+		BeforeEach(func() {
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/v2/team/app/manifests/multi":
+					resp.Header().Set("Content-Type", docker.MediaTypeOCIIndex)
+					fmt.Fprint(resp, `{"schemaVersion":2,"manifests":[`+
+						`{"mediaType":"`+docker.MediaTypeOCIManifest+`","digest":"sha256:arm","platform":{"os":"linux","architecture":"arm64","variant":"v8"}},`+
+						`{"mediaType":"`+docker.MediaTypeOCIManifest+`","digest":"sha256:attestation"},`+
+						`{"mediaType":"`+docker.MediaTypeOCIManifest+`","digest":"sha256:amd","platform":{"os":"linux","architecture":"amd64"}}]}`)
+				case "/v2/team/app/manifests/1.0.0":
+					resp.Header().Set("Content-Type", docker.MediaTypeDockerManifest)
+					resp.Header().Set("Docker-Content-Digest", sha256Digest([]byte(singleArchManifest)))
+					fmt.Fprint(resp, singleArchManifest)
+				case "/v2/team/app/manifests/" + sha256Digest([]byte(singleArchManifest)), "/v2/team/app/manifests/" + testDigest:
+					resp.Header().Set("Content-Type", docker.MediaTypeDockerManifest)
+					fmt.Fprint(resp, singleArchManifest)
+				case "/v2/team/app/manifests/sha256:amd":
+					resp.Header().Set("Content-Type", docker.MediaTypeOCIManifest)
+					fmt.Fprint(resp, singleArchManifest)
+				case "/v2/team/app/manifests/tampered":
+					resp.Header().Set("Docker-Content-Digest", testDigest)
+					fmt.Fprint(resp, singleArchManifest)
+				case "/v2/team/app/blobs/sha256:config":
+					fmt.Fprint(resp, `{"os":"linux","architecture":"arm","variant":"v7"}`)
+				case "/v2/team/chart/manifests/1.0.0":
+					if !strings.Contains(req.Header.Get("Accept"), docker.MediaTypeOCIManifest) {
+						resp.WriteHeader(http.StatusNotFound)
+						return
+					}
+					resp.Header().Set("Content-Type", docker.MediaTypeOCIManifest)
+					fmt.Fprint(resp, `{"schemaVersion":2,"mediaType":"`+docker.MediaTypeOCIManifest+`","config":{"mediaType":"`+docker.MediaTypeHelmChartConfig+`","digest":"sha256:chart","size":100},"layers":[{"mediaType":"application/vnd.cncf.helm.chart.content.v1.tar+gzip","size":2000}]}`)
+				case "/v2/team/app/manifests/sbom":
+					resp.Header().Set("Content-Type", docker.MediaTypeOCIArtifactManifest)
+					fmt.Fprint(resp, `{"mediaType":"`+docker.MediaTypeOCIArtifactManifest+`","artifactType":"application/spdx+json","blobs":[{"size":300}],"subject":{"digest":"sha256:amd"}}`)
+				default:
+					resp.WriteHeader(http.StatusNotFound)
+				}
+			}
+		})
+		It("returns the platforms of a manifest list", func() {
+			manifests, err := client.Manifests(context.Background(), "team/app", "multi")
+			Expect(err).To(BeNil())
+			Expect(manifests).To(Equal([]docker.PlatformManifest{
+				{Platform: docker.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, MediaType: docker.MediaTypeOCIManifest, Digest: "sha256:arm"},
+				{Platform: docker.Platform{OS: "linux", Architecture: "amd64"}, MediaType: docker.MediaTypeOCIManifest, Digest: "sha256:amd"},
+			}))
+		})
+		It("returns one element for single-arch tags", func() {
+			manifests, err := client.Manifests(context.Background(), "team/app", "1.0.0")
+			Expect(err).To(BeNil())
+			Expect(manifests).To(Equal([]docker.PlatformManifest{
+				{Platform: docker.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, MediaType: docker.MediaTypeDockerManifest, Digest: docker.Digest(sha256Digest([]byte(singleArchManifest)))},
+			}))
+		})
+		It("returns the raw manifest as served", func() {
+			content, mediaType, err := client.RawManifest(context.Background(), "team/app", "1.0.0")
+			Expect(err).To(BeNil())
+			Expect(string(content)).To(Equal(singleArchManifest))
+			Expect(mediaType).To(Equal(docker.MediaTypeDockerManifest))
+			Expect(requests[0].Header.Get("Accept")).To(ContainSubstring(docker.MediaTypeOCIIndex))
+		})
+		It("returns the manifest by tag with config and layer digests", func() {
+			manifest, digest, err := client.ManifestByReference(context.Background(), "team/app", "1.0.0")
+			Expect(err).To(BeNil())
+			Expect(digest).To(Equal(docker.Digest(sha256Digest([]byte(singleArchManifest)))))
+			Expect(manifest.MediaType).To(Equal(docker.MediaTypeDockerManifest))
+			Expect(manifest.ConfigDigest()).To(Equal(docker.Digest("sha256:config")))
+			Expect(manifest.LayerDigests()).To(BeEmpty())
+		})
+		It("returns the manifest by digest", func() {
+			_, digest, err := client.ManifestByReference(context.Background(), "team/app", sha256Digest([]byte(singleArchManifest)))
+			Expect(err).To(BeNil())
+			Expect(digest).To(Equal(docker.Digest(sha256Digest([]byte(singleArchManifest)))))
+		})
+		It("rejects a manifest not matching the requested digest", func() {
+			_, _, err := client.ManifestByReference(context.Background(), "team/app", testDigest)
+			Expect(err).NotTo(BeNil())
+		})
+		It("rejects invalid digests without request", func() {
+			_, _, err := client.ManifestByReference(context.Background(), "team/app", "sha256:abc")
+			Expect(err).NotTo(BeNil())
+			Expect(requests).To(BeEmpty())
+		})
+		It("returns manifest lists by reference with media type", func() {
+			manifest, _, err := client.ManifestByReference(context.Background(), "team/app", "multi")
+			Expect(err).To(BeNil())
+			Expect(manifest.MediaType).To(Equal(docker.MediaTypeOCIIndex))
+			Expect(manifest.Manifests).To(HaveLen(3))
+		})
+		It("finds platforms of manifest lists", func() {
+			for platform, expected := range map[docker.Platform]bool{
+				{OS: "linux", Architecture: "arm64"}:                true,
+				{OS: "linux", Architecture: "arm64", Variant: "v8"}: true,
+				{OS: "windows", Architecture: "amd64"}:              false,
+			} {
+				found, err := client.HasPlatform(context.Background(), "team/app", "multi", platform)
+				Expect(err).To(BeNil())
+				Expect(found).To(Equal(expected), platform.String())
+			}
+		})
+		It("finds the platform of single-arch tags", func() {
+			found, err := client.HasPlatform(context.Background(), "team/app", "1.0.0", docker.Platform{OS: "linux", Architecture: "arm"})
+			Expect(err).To(BeNil())
+			Expect(found).To(BeTrue())
+		})
+		It("resolves the manifest of a platform", func() {
+			manifest, digest, err := client.ManifestForPlatform(context.Background(), "team/app", "multi", docker.Platform{OS: "linux", Architecture: "amd64"})
+			Expect(err).To(BeNil())
+			Expect(digest).To(Equal(docker.Digest(sha256Digest([]byte(singleArchManifest)))))
+			Expect(manifest.ConfigDigest()).To(Equal(docker.Digest("sha256:config")))
+			Expect(requests[1].URL.Path).To(Equal("/v2/team/app/manifests/sha256:amd"))
+		})
+		It("returns not found for a missing platform", func() {
+			_, _, err := client.ManifestForPlatform(context.Background(), "team/app", "multi", docker.Platform{OS: "windows", Architecture: "amd64"})
+			Expect(errors.Cause(err)).To(Equal(docker.ErrNotFound))
+			_, _, err = client.ManifestForPlatform(context.Background(), "team/app", "1.0.0", docker.Platform{OS: "linux", Architecture: "amd64"})
+			Expect(errors.Cause(err)).To(Equal(docker.ErrNotFound))
+		})
+		It("parses platforms", func() {
+			platform, err := docker.ParsePlatform("linux/arm/v7")
+			Expect(err).To(BeNil())
+			Expect(platform).To(Equal(docker.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}))
+			for _, value := range []string{"", "linux", "linux/", "linux/arm/v7/x", "linux/ arm"} {
+				_, err := docker.ParsePlatform(value)
+				Expect(err).NotTo(BeNil(), value)
+			}
+		})
+		It("returns raw manifest lists", func() {
+			content, mediaType, err := client.RawManifest(context.Background(), "team/app", "multi")
+			Expect(err).To(BeNil())
+			Expect(string(content)).To(HavePrefix(`{"schemaVersion":2,"manifests":[`))
+			Expect(mediaType).To(Equal(docker.MediaTypeOCIIndex))
+		})
+		It("rejects content not matching the announced digest", func() {
+			_, _, err := client.RawManifest(context.Background(), "team/app", "tampered")
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("registry announced " + testDigest))
+		})
+		It("returns the config media type of OCI artifacts", func() {
+			manifest, err := client.Manifest(context.Background(), "team/chart", "1.0.0")
+			Expect(err).To(BeNil())
+			Expect(manifest.Type()).To(Equal(docker.MediaTypeHelmChartConfig))
+			Expect(manifest.Size()).To(Equal(int64(2100)))
+		})
+		It("returns the artifact type of artifact manifests", func() {
+			manifest, err := client.Manifest(context.Background(), "team/app", "sbom")
+			Expect(err).To(BeNil())
+			Expect(manifest.Type()).To(Equal("application/spdx+json"))
+			Expect(manifest.Subject.Digest).To(Equal("sha256:amd"))
+			Expect(manifest.Size()).To(Equal(int64(300)))
+			Expect(requests[0].Header.Get("Accept")).To(ContainSubstring(docker.MediaTypeOCIArtifactManifest))
+			Expect(requests[0].Header.Get("Accept")).NotTo(ContainSubstring(docker.MediaTypeOCIIndex))
+		})
+		It("returns empty type for attestations using the empty config", func() {
+			Expect(docker.Manifest{Config: docker.ManifestConfig{MediaType: docker.MediaTypeOCIEmpty}}.Type()).To(Equal(""))
+		})
+		It("sends the manifest list media types", func() {
+			_, err := client.Manifests(context.Background(), "team/app", "multi")
+			Expect(err).To(BeNil())
+			Expect(requests[0].Header.Get("Accept")).To(ContainSubstring(docker.MediaTypeOCIIndex))
+			Expect(requests[0].Header.Get("Accept")).To(ContainSubstring(docker.MediaTypeDockerManifestList))
+		})
+	})
+	Context("Size", func() {
+		BeforeEach(func() {
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/v2/team/app/manifests/multi":
+					fmt.Fprint(resp, `{"schemaVersion":2,"mediaType":"`+docker.MediaTypeDockerManifestList+`","manifests":[`+
+						`{"digest":"sha256:arm","platform":{"os":"linux","architecture":"arm64"}},`+
+						`{"digest":"sha256:amd","platform":{"os":"linux","architecture":"amd64"}}]}`)
+				case "/v2/team/app/manifests/1.0.0", "/v2/team/app/manifests/sha256:amd":
+					fmt.Fprint(resp, `{"schemaVersion":2,"config":{"size":10},"layers":[{"size":100},{"size":1000}]}`)
+				case "/v2/team/app/manifests/sha256:arm":
+					fmt.Fprint(resp, `{"schemaVersion":2,"config":{"size":20},"layers":[{"size":200}]}`)
+				default:
+					resp.WriteHeader(http.StatusNotFound)
+				}
+			}
+		})
+		It("sums config and layers", func() {
+			size, err := client.Size(context.Background(), "team/app", "1.0.0")
+			Expect(err).To(BeNil())
+			Expect(size).To(Equal(int64(1110)))
+		})
+		It("sums all platforms of manifest lists", func() {
+			size, err := client.Size(context.Background(), "team/app", "multi")
+			Expect(err).To(BeNil())
+			Expect(size).To(Equal(int64(1330)))
+		})
+	})
+	Context("ExistsTag", func() {
+		BeforeEach(func() {
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/v2/team/app/manifests/1.0.0":
+					resp.Header().Set("Docker-Content-Digest", testDigest)
+				case "/v2/team/app/manifests/broken":
+					resp.WriteHeader(http.StatusInternalServerError)
+				default:
+					resp.WriteHeader(http.StatusNotFound)
+				}
+			}
+		})
+		It("returns true for existing tag", func() {
+			exists, err := client.ExistsTag(context.Background(), "team/app", "1.0.0")
+			Expect(err).To(BeNil())
+			Expect(exists).To(BeTrue())
+			Expect(requests[0].Method).To(Equal(http.MethodHead))
+			Expect(requests[0].Header.Get("Accept")).To(ContainSubstring(docker.MediaTypeOCIIndex))
+		})
+		It("returns false for missing tag", func() {
+			exists, err := client.ExistsTag(context.Background(), "team/app", "2.0.0")
+			Expect(err).To(BeNil())
+			Expect(exists).To(BeFalse())
+		})
+		It("returns error for other status codes", func() {
+			_, err := client.ExistsTag(context.Background(), "team/app", "broken")
+			Expect(errors.Cause(err)).To(Equal(docker.ErrUnavailable))
+		})
+	})
+	Context("docker hub", func() {
+		var tokenRequests []*http.Request
+		var registryRequests int
+		var hubToken, validHubToken string
+		var hubClient docker.HttpClient
+		BeforeEach(func() {
+			tokenRequests = nil
+			registryRequests = 0
+			hubToken = "hub-token"
+			validHubToken = "hub-token"
+			handler := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				switch req.URL.Host + req.URL.Path {
+				case "auth.docker.io/token":
+					tokenRequests = append(tokenRequests, req)
+					fmt.Fprintf(resp, `{"token":"%s","expires_in":300}`, hubToken)
+				case "registry-1.docker.io/v2/bborbe/app/tags/list", "registry-1.docker.io/v2/library/nginx/tags/list":
+					registryRequests++
+					if req.Header.Get("Authorization") != "Bearer "+validHubToken {
+						resp.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					fmt.Fprint(resp, `{"tags":["1.0.0"]}`)
+				default:
+					resp.WriteHeader(http.StatusNotFound)
+				}
+			})
+			hubClient = docker.NewHttpClient(&http.Client{Transport: handlerTransport{handler: handler}})
+		})
+		JustBeforeEach(func() {
+			client = docker.NewV2Client(hubClient, docker.Registry{Url: "docker.io", Username: "bborbe", Password: "secret"})
+		})
+		It("uses the registry token service with credentials and scope", func() {
+			tags, err := client.ListTagsSortedSemver(context.Background(), "bborbe/app")
+			Expect(err).To(BeNil())
+			Expect(tags).To(Equal([]docker.TagName{"1.0.0"}))
+			Expect(tokenRequests).To(HaveLen(1))
+			Expect(tokenRequests[0].URL.Query().Get("service")).To(Equal("registry.docker.io"))
+			Expect(tokenRequests[0].URL.Query().Get("scope")).To(Equal("repository:bborbe/app:pull"))
+			username, password, ok := tokenRequests[0].BasicAuth()
+			Expect(ok).To(BeTrue())
+			Expect(username).To(Equal("bborbe"))
+			Expect(password).To(Equal("secret"))
+		})
+		It("adds the library namespace to official images", func() {
+			tags, err := client.ListTagsSortedSemver(context.Background(), "nginx")
+			Expect(err).To(BeNil())
+			Expect(tags).To(Equal([]docker.TagName{"1.0.0"}))
+			Expect(tokenRequests[0].URL.Query().Get("scope")).To(Equal("repository:library/nginx:pull"))
+		})
+		It("refreshes a token rejected without challenge once", func() {
+			_, err := client.ListTagsSortedSemver(context.Background(), "bborbe/app")
+			Expect(err).To(BeNil())
+			hubToken = "rotated"
+			validHubToken = "rotated"
+			tags, err := client.ListTagsSortedSemver(context.Background(), "bborbe/app")
+			Expect(err).To(BeNil())
+			Expect(tags).To(Equal([]docker.TagName{"1.0.0"}))
+			Expect(tokenRequests).To(HaveLen(2))
+			Expect(registryRequests).To(Equal(3))
+		})
+		It("returns the second 401 without further retries", func() {
+			validHubToken = "other"
+			_, err := client.ListTagsSortedSemver(context.Background(), "bborbe/app")
+			Expect(errors.Cause(err)).To(Equal(docker.ErrUnauthorized))
+			Expect(tokenRequests).To(HaveLen(2))
+			Expect(registryRequests).To(Equal(2))
+		})
+	})
+	Context("bearer challenge", func() {
+		var tags []docker.TagName
+		var err error
+		var registry docker.Registry
+		var tokenResponse string
+		var validToken string
+		var challenges func(host string) []string
+		var listTags func() ([]docker.TagName, error)
+		BeforeEach(func() {
+			registry = docker.Registry{Username: "user", Password: "pass"}
+			tokenResponse = `{"token":"secret","expires_in":300}`
+			validToken = "secret"
+			challenges = func(host string) []string {
+				return []string{fmt.Sprintf(`Bearer realm="http://%s/token",service="registry.example.com",scope="repository:bborbe/app:pull"`, host)}
+			}
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/token":
+					username, password, _ := req.BasicAuth()
+					if username != "user" || password != "pass" || req.URL.Query().Get("scope") != "repository:bborbe/app:pull" || req.URL.Query().Get("service") != "registry.example.com" {
+						resp.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					fmt.Fprint(resp, tokenResponse)
+				default:
+					if req.Header.Get("Authorization") != "Bearer "+validToken {
+						for _, challenge := range challenges(req.Host) {
+							resp.Header().Add("WWW-Authenticate", challenge)
+						}
+						resp.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					fmt.Fprint(resp, `{"tags":["1.0.0"]}`)
+				}
+			}
+		})
+		JustBeforeEach(func() {
+			registry.Url = server.URL
+			client = docker.NewV2Client(docker.NewHttpClient(server.Client()), registry, options...)
+			listTags = func() ([]docker.TagName, error) {
+				ch := make(chan docker.TagName, 10)
+				err := client.ListTags(context.Background(), "bborbe/app", ch)
+				close(ch)
+				var tags []docker.TagName
+				for tag := range ch {
+					tags = append(tags, tag)
+				}
+				return tags, err
+			}
+			tags, err = listTags()
+		})
+		It("fetches token and retries request", func() {
+			Expect(err).To(BeNil())
+			Expect(tags).To(Equal([]docker.TagName{"1.0.0"}))
+			Expect(requests).To(HaveLen(3))
+		})
+		It("reuses cached token", func() {
+			_, err = listTags()
+			Expect(err).To(BeNil())
+			Expect(requests).To(HaveLen(4))
+			Expect(requests[3].Header.Get("Authorization")).To(Equal("Bearer secret"))
+		})
+		It("refreshes token rejected by registry", func() {
+			mux.Lock()
+			validToken = "rotated"
+			tokenResponse = `{"token":"rotated","expires_in":300}`
+			mux.Unlock()
+			tags, err = listTags()
+			Expect(err).To(BeNil())
+			Expect(tags).To(Equal([]docker.TagName{"1.0.0"}))
+			Expect(requests).To(HaveLen(6))
+		})
+		Context("with token about to expire", func() {
+			BeforeEach(func() {
+				tokenResponse = `{"token":"secret","expires_in":1}`
+			})
+			It("fetches new token", func() {
+				_, err = listTags()
+				Expect(err).To(BeNil())
+				Expect(requests).To(HaveLen(6))
+			})
+		})
+		Context("with basic and bearer challenge in one header", func() {
+			BeforeEach(func() {
+				challenges = func(host string) []string {
+					return []string{fmt.Sprintf(`Basic realm="registry, basic", Bearer realm="http://%s/token",service="registry.example.com",scope="repository:bborbe/app:pull"`, host)}
+				}
+			})
+			It("completes the bearer challenge", func() {
+				Expect(err).To(BeNil())
+				Expect(tags).To(Equal([]docker.TagName{"1.0.0"}))
+			})
+		})
+		Context("with basic and bearer challenge in separate headers", func() {
+			BeforeEach(func() {
+				challenges = func(host string) []string {
+					return []string{`Basic realm="registry"`, fmt.Sprintf(`Bearer realm="http://%s/token",service="registry.example.com",scope="repository:bborbe/app:pull"`, host)}
+				}
+			})
+			It("completes the bearer challenge", func() {
+				Expect(err).To(BeNil())
+				Expect(tags).To(Equal([]docker.TagName{"1.0.0"}))
+			})
+		})
+		Context("with basic challenge only", func() {
+			BeforeEach(func() {
+				challenges = func(host string) []string {
+					return []string{`Basic realm="registry"`}
+				}
+			})
+			It("returns unauthorized without token request", func() {
+				Expect(errors.Cause(err)).To(Equal(docker.ErrUnauthorized))
+				Expect(requests).To(HaveLen(1))
+			})
+		})
+		Context("with access_token and issued_at", func() {
+			BeforeEach(func() {
+				tokenResponse = `{"access_token":"secret","expires_in":300,"issued_at":"2000-01-01T00:00:00Z"}`
+			})
+			It("treats token issued long ago as expired", func() {
+				_, err = listTags()
+				Expect(err).To(BeNil())
+				Expect(requests).To(HaveLen(6))
+			})
+		})
+		Context("with empty token", func() {
+			BeforeEach(func() {
+				tokenResponse = `{"token":"","expires_in":300}`
+			})
+			It("fails before sending the request", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(ContainSubstring("no valid token"))
+				Expect(requests).To(HaveLen(2))
+			})
+		})
+		Context("with wrong credentials", func() {
+			BeforeEach(func() {
+				registry.Password = "wrong"
+			})
+			It("returns unauthorized", func() {
+				Expect(docker.ExitCode(err)).To(Equal(docker.ExitCodeUnauthorized))
+			})
+		})
+	})
+	Context("pagination", func() {
+		var repositories []docker.RepositoryName
+		var err error
+		JustBeforeEach(func() {
+			ch := make(chan docker.RepositoryName, 10)
+			err = client.ListRepositories(context.Background(), ch)
+			close(ch)
+			repositories = nil
+			for repository := range ch {
+				repositories = append(repositories, repository)
+			}
+		})
+		Context("with absolute next link without n", func() {
+			BeforeEach(func() {
+				handler = func(resp http.ResponseWriter, req *http.Request) {
+					if req.URL.Query().Get("last") == "" {
+						resp.Header().Set("Link", fmt.Sprintf(`<http://%s/v2/_catalog?last=a>; rel="next"`, req.Host))
+						fmt.Fprint(resp, `{"repositories":["a"]}`)
+						return
+					}
+					fmt.Fprint(resp, `{"repositories":["b"]}`)
+				}
+			})
+			It("follows link and keeps page size", func() {
+				Expect(err).To(BeNil())
+				Expect(repositories).To(Equal([]docker.RepositoryName{"a", "b"}))
+				Expect(requests[1].URL.Query().Get("n")).To(Equal("1000"))
+			})
+		})
+		Context("with multiple links", func() {
+			BeforeEach(func() {
+				handler = func(resp http.ResponseWriter, req *http.Request) {
+					if req.URL.Query().Get("last") == "" {
+						resp.Header().Set("Link", `</v2/_catalog?last=0>; rel="prev", </v2/_catalog?last=a,b>; rel="next"`)
+						fmt.Fprint(resp, `{"repositories":["a"]}`)
+						return
+					}
+					fmt.Fprint(resp, `{"repositories":["b"]}`)
+				}
+			})
+			It("selects next link", func() {
+				Expect(err).To(BeNil())
+				Expect(requests[1].URL.Query().Get("last")).To(Equal("a,b"))
+			})
+		})
+		Context("with self referential next link", func() {
+			BeforeEach(func() {
+				handler = func(resp http.ResponseWriter, req *http.Request) {
+					resp.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, req.URL.String()))
+					fmt.Fprint(resp, `{"repositories":["a"]}`)
+				}
+			})
+			It("stops with error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(requests).To(HaveLen(1))
+			})
+		})
+	})
+	Context("with canceled context", func() {
+		It("returns context error", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			err := client.ListRepositories(ctx, make(chan docker.RepositoryName))
+			Expect(errors.Cause(err)).To(Equal(context.Canceled))
+		})
+		It("stops sending if consumer is gone", func() {
+			handler = func(resp http.ResponseWriter, req *http.Request) {
+				fmt.Fprint(resp, `{"tags":["a","b"]}`)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				defer GinkgoRecover()
+				Eventually(func() int {
+					mux.Lock()
+					defer mux.Unlock()
+					return len(requests)
+				}).Should(Equal(1))
+				cancel()
+			}()
+			err := client.ListTags(ctx, "bborbe/app", make(chan docker.TagName))
+			Expect(errors.Cause(err)).To(Equal(context.Canceled))
+		})
+	})
+	Context("Digest", func() {
+		var digest docker.Digest
+		var err error
+		JustBeforeEach(func() {
+			digest, err = client.Digest(context.Background(), "bborbe/app", "1.0.0")
+		})
+		Context("with digest header on head", func() {
+			BeforeEach(func() {
+				handler = func(resp http.ResponseWriter, req *http.Request) {
+					resp.Header().Set("Docker-Content-Digest", testDigest)
+				}
+			})
+			It("returns digest of single head request", func() {
+				Expect(err).To(BeNil())
+				Expect(digest).To(Equal(docker.Digest(testDigest)))
+				Expect(requests).To(HaveLen(1))
+				Expect(requests[0].Method).To(Equal(http.MethodHead))
+				Expect(requests[0].Header.Get("Accept")).To(ContainSubstring("application/vnd.oci.image.manifest.v1+json"))
+			})
+		})
+		Context("without digest header", func() {
+			BeforeEach(func() {
+				handler = func(resp http.ResponseWriter, req *http.Request) {
+					fmt.Fprint(resp, "foo")
+				}
+			})
+			It("computes digest of manifest", func() {
+				Expect(err).To(BeNil())
+				Expect(digest).To(Equal(docker.Digest(testDigest)))
+				Expect(requests).To(HaveLen(2))
+				Expect(requests[1].Method).To(Equal(http.MethodGet))
+			})
+		})
+		Context("with invalid digest header", func() {
+			BeforeEach(func() {
+				handler = func(resp http.ResponseWriter, req *http.Request) {
+					resp.Header().Set("Docker-Content-Digest", "banana")
+				}
+			})
+			It("returns error", func() {
+				Expect(err).NotTo(BeNil())
+			})
+		})
+	})
+})
+
+// handlerTransport serves all requests by the handler regardless of their host.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (h handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	h.handler.ServeHTTP(recorder, req)
+	resp := recorder.Result()
+	resp.Request = req
+	return resp, nil
+}
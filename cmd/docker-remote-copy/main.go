@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/bborbe/docker-utils"
+	flag "github.com/bborbe/flagenv"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+var (
+	srcRegistryFlags = docker.NewRegistryFlags("src-", "source registry")
+	srcRepositoryPtr = flag.String("src-repository", "", "Source repository")
+	srcTagPtr        = flag.String("src-tag", "", "Source tag or digest")
+	dstRegistryFlags = docker.NewRegistryFlags("dst-", "destination registry")
+	dstRepositoryPtr = flag.String("dst-repository", "", "Destination repository, defaults to the source repository")
+	dstTagPtr        = flag.String("dst-tag", "", "Destination tag, defaults to the source tag")
+	clientFlags      = docker.NewClientFlags(0)
+	headerTimeoutPtr = flag.Duration("response-header-timeout", docker.DefaultTimeout, "Timeout until the registry starts to respond")
+	dryRunPtr        = flag.Bool("dry-run", false, "Only print what would be copied")
+)
+
+func main() {
+	defer glog.Flush()
+	glog.CopyStandardLogTo("info")
+	flag.Parse()
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	docker.RunCommand(do)
+}
+
+func do(ctx context.Context) error {
+	if len(*srcRepositoryPtr) == 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter src-repository missing")
+	}
+	if len(*srcTagPtr) == 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter src-tag missing")
+	}
+	srcRepository := docker.Repository{
+		Name: docker.RepositoryName(*srcRepositoryPtr),
+		Tag:  docker.TagName(*srcTagPtr),
+	}
+	dstRepository := srcRepository
+	if len(*dstRepositoryPtr) > 0 {
+		dstRepository.Name = docker.RepositoryName(*dstRepositoryPtr)
+	}
+	if len(*dstTagPtr) > 0 {
+		dstRepository.Tag = docker.TagName(*dstTagPtr)
+	}
+	src, err := srcRegistryFlags.Registry(clientFlags.DockerConfig())
+	if err != nil {
+		return errors.Wrap(err, "source registry")
+	}
+	dst, err := dstRegistryFlags.Registry(clientFlags.DockerConfig())
+	if err != nil {
+		return errors.Wrap(err, "destination registry")
+	}
+	glog.V(2).Infof("copy %v %v to %v %v", src, srcRepository, dst, dstRepository)
+	httpClient, err := clientFlags.HttpClientBuilder(*src, *dst).
+		WithResponseHeaderTimeout(*headerTimeoutPtr).
+		Build()
+	if err != nil {
+		return errors.Wrap(err, "build http client failed")
+	}
+	plan := docker.NewPlan()
+	if err := docker.Copy(
+		ctx,
+		docker.NewHttpClient(httpClient),
+		*src, srcRepository,
+		*dst, dstRepository,
+		clientFlags.ClientOptions(
+			docker.WithDryRun(*dryRunPtr),
+			docker.WithPlan(plan),
+		)...,
+	); err != nil {
+		return errors.Wrap(err, "copy failed")
+	}
+	for _, action := range plan.Actions() {
+		fmt.Printf("%v\n", action)
+	}
+	return nil
+}
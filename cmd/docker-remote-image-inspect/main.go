@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"runtime"
+
+	"github.com/bborbe/docker-utils"
+	flag "github.com/bborbe/flagenv"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+var (
+	registryFlags = docker.NewRegistryFlags("", "registry")
+	clientFlags   = docker.NewClientFlags(docker.DefaultTimeout)
+	repositoryPtr = flag.String("repository", "", "Repository")
+	tagPtr        = flag.String("tag", "", "Tag")
+	platformPtr   = flag.String("platform", "", "Image of os/architecture[/variant] used for multi-arch tags, e.g. linux/arm64")
+)
+
+func main() {
+	defer glog.Flush()
+	glog.CopyStandardLogTo("info")
+	flag.Parse()
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	docker.RunCommand(do)
+}
+
+func do(ctx context.Context) error {
+	if len(*repositoryPtr) == 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter repository missing")
+	}
+	if len(*tagPtr) == 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter tag missing")
+	}
+	var platform docker.Platform
+	if len(*platformPtr) > 0 {
+		var err error
+		if platform, err = docker.ParsePlatform(*platformPtr); err != nil {
+			return errors.Wrap(docker.ErrUsage, err.Error())
+		}
+	}
+	registry, err := registryFlags.Registry(clientFlags.DockerConfig())
+	if err != nil {
+		return err
+	}
+	glog.V(2).Infof("use registry %v, repo %v and tag %v", registry, docker.RepositoryName(*repositoryPtr), docker.TagName(*tagPtr))
+	httpClient, err := clientFlags.HttpClientBuilder(*registry).Build()
+	if err != nil {
+		return errors.Wrap(err, "build http client failed")
+	}
+	options := clientFlags.ClientOptions()
+	if len(*platformPtr) > 0 {
+		options = append(options, docker.WithPlatform(platform))
+	}
+	client := docker.NewV2Client(docker.NewHttpClient(httpClient), *registry, options...)
+	config, err := client.ImageConfig(ctx, docker.RepositoryName(*repositoryPtr), docker.TagName(*tagPtr))
+	if err != nil {
+		return errors.Wrap(err, "get image config failed")
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(config); err != nil {
+		return errors.Wrap(err, "encode image config failed")
+	}
+	return nil
+}
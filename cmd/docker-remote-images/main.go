@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/bborbe/docker-utils"
+	flag "github.com/bborbe/flagenv"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+var (
+	registryFlags  = docker.NewRegistryFlags("", "registry")
+	clientFlags    = docker.NewClientFlags(docker.DefaultTimeout)
+	pageSizePtr    = flag.Int("page-size", docker.DefaultPageSize, "Page-Size")
+	harborPtr      = flag.Bool("harbor", false, "List repositories per project with the harbor api instead of the catalog")
+	prefixPtr      = flag.String("prefix", "", "Only list repositories starting with prefix")
+	regexPtr       = flag.String("regex", "", "Only list repositories matching regular expression")
+	concurrencyPtr = flag.Int("concurrency", docker.DefaultConcurrency, "Number of repositories whose tags are listed in parallel")
+	formatPtr      = flag.String("format", docker.FormatPlain, "Output format plain, json or template")
+	templatePtr    = flag.String("template", "{{.}}", "Go template applied per repository:tag if format is template")
+	countPtr       = flag.Bool("count", false, "Only print the number of repositories and tags")
+)
+
+func main() {
+	defer glog.Flush()
+	glog.CopyStandardLogTo("info")
+	flag.Parse()
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	writer := docker.NewFlushWriter(os.Stdout, time.Second)
+	docker.RunCommand(func(ctx context.Context) error {
+		err := do(ctx, writer)
+		if closeErr := writer.Close(); closeErr != nil && err == nil {
+			err = errors.Wrap(closeErr, "flush output failed")
+		}
+		return err
+	})
+}
+
+func do(ctx context.Context, writer io.Writer) error {
+	if *pageSizePtr <= 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter page-size must be > 0")
+	}
+	if *concurrencyPtr <= 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter concurrency must be > 0")
+	}
+	formatter, err := docker.NewFormatter(writer, *formatPtr, *templatePtr)
+	if err != nil {
+		return err
+	}
+	filter := docker.RepositoryFilter{
+		Prefix: *prefixPtr,
+	}
+	if len(*regexPtr) > 0 {
+		if filter.Regexp, err = regexp.Compile(*regexPtr); err != nil {
+			return errors.Wrapf(docker.ErrUsage, "parameter regex invalid: %v", err)
+		}
+	}
+	registry, err := registryFlags.Registry(clientFlags.DockerConfig())
+	if err != nil {
+		return err
+	}
+	glog.V(2).Infof("use registry %v", registry)
+	crawlStats := docker.NewCrawlStats()
+	defer func() {
+		fmt.Fprintf(os.Stderr, "%s\n", crawlStats.Snapshot())
+	}()
+	builder := clientFlags.HttpClientBuilder(*registry)
+	defer builder.Close()
+	httpClient, err := builder.
+		WithCrawlStats(crawlStats).
+		WithMaxIdleConnsPerHost(*concurrencyPtr).
+		Build()
+	if err != nil {
+		return errors.Wrap(err, "build http client failed")
+	}
+	client := docker.NewV2Client(docker.NewHttpClient(httpClient), *registry, clientFlags.ClientOptions(docker.WithPageSize(*pageSizePtr), docker.WithHarbor(*harborPtr))...)
+	if err := client.Ping(ctx); err != nil {
+		return err
+	}
+	if *countPtr {
+		summary, err := client.Summary(ctx, docker.SummaryOptions{Filter: filter, CountTags: true, Concurrency: *concurrencyPtr})
+		failed := skipNotFound(err)
+		if summary == nil {
+			return failed
+		}
+		if err := formatter.Format(summary); err != nil {
+			return errors.Wrap(err, "write output failed")
+		}
+		if err := formatter.Close(); err != nil {
+			return errors.Wrap(err, "write output failed")
+		}
+		return errors.Wrap(failed, "count tags failed")
+	}
+	repositories := make(chan docker.RepositoryName, runtime.NumCPU())
+	var listErr error
+	go func() {
+		defer close(repositories)
+		listErr = client.ListRepositoriesFiltered(ctx, filter, repositories)
+	}()
+	var repositoryNames []docker.RepositoryName
+	for repository := range repositories {
+		crawlStats.AddRepositories(1)
+		repositoryNames = append(repositoryNames, repository)
+	}
+	if listErr != nil {
+		return errors.Wrap(listErr, "list repositories failed")
+	}
+	tags, err := client.ListTagsForRepositories(ctx, repositoryNames, *concurrencyPtr)
+	failed := skipNotFound(err)
+	sort.Sort(docker.RepositoryNamesByName(repositoryNames))
+	for _, repositoryName := range repositoryNames {
+		for _, tag := range tags[repositoryName] {
+			if err := formatter.Format(docker.Repository{Name: repositoryName, Tag: tag}); err != nil {
+				return errors.Wrap(err, "write output failed")
+			}
+		}
+	}
+	if err := formatter.Close(); err != nil {
+		return errors.Wrap(err, "write output failed")
+	}
+	if failed != nil {
+		return errors.Wrap(failed, "list tags failed")
+	}
+	return nil
+}
+
+// skipNotFound logs repositories deleted since the catalog was listed and returns the remaining errors.
+func skipNotFound(err error) error {
+	errs, ok := err.(docker.Errors)
+	if !ok {
+		return err
+	}
+	var remaining docker.Errors
+	for _, err := range errs {
+		if errors.Cause(err) == docker.ErrNotFound {
+			glog.Warningf("skip repository: %v", err)
+			continue
+		}
+		remaining = append(remaining, err)
+	}
+	if len(remaining) == 0 {
+		return nil
+	}
+	return remaining
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/bborbe/docker-utils"
+	flag "github.com/bborbe/flagenv"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+var (
+	registryFlags = docker.NewRegistryFlags("", "registry")
+	clientFlags   = docker.NewClientFlags(docker.DefaultTimeout)
+	repositoryPtr = flag.String("repository", "", "Repository")
+	keepPtr       = flag.Int("keep", 10, "Number of newest tags to keep")
+	maxAgePtr     = flag.Duration("max-age", 0, "Only delete tags older than max age, e.g. 2160h for 90 days")
+	orderPtr      = flag.String("order", string(docker.PruneOrderSemver), "Order of the tags, semver or created")
+	dryRunPtr     = flag.Bool("dry-run", false, "Only print what would be deleted")
+	tagFilter     docker.TagFilter
+)
+
+func init() {
+	flag.Var(&tagFilter.Include, "keep-pattern", "Never delete tags matching glob (repeatable)")
+	flag.Var(&tagFilter.Exclude, "delete-pattern", "Delete tags matching glob regardless of keep and max-age (repeatable)")
+}
+
+func main() {
+	defer glog.Flush()
+	glog.CopyStandardLogTo("info")
+	flag.Parse()
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	docker.RunCommand(do)
+}
+
+func do(ctx context.Context) error {
+	if len(*repositoryPtr) == 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter repository missing")
+	}
+	if *keepPtr < 0 {
+		return errors.Wrapf(docker.ErrUsage, "invalid keep %d", *keepPtr)
+	}
+	if err := tagFilter.Validate(); err != nil {
+		return errors.Wrap(docker.ErrUsage, err.Error())
+	}
+	options := docker.PruneOptions{
+		Order:     docker.PruneOrder(*orderPtr),
+		TagFilter: tagFilter,
+		MaxAge:    *maxAgePtr,
+		DryRun:    *dryRunPtr,
+	}
+	switch options.Order {
+	case docker.PruneOrderSemver, docker.PruneOrderCreated:
+	default:
+		return errors.Wrapf(docker.ErrUsage, "unknown order '%s'", *orderPtr)
+	}
+	registry, err := registryFlags.Registry(clientFlags.DockerConfig())
+	if err != nil {
+		return err
+	}
+	glog.V(2).Infof("use registry %v and repo %v", registry, docker.RepositoryName(*repositoryPtr))
+	httpClient, err := clientFlags.HttpClientBuilder(*registry).Build()
+	if err != nil {
+		return errors.Wrap(err, "build http client failed")
+	}
+	client := docker.NewV2Client(docker.NewHttpClient(httpClient), *registry, clientFlags.ClientOptions(docker.WithDryRun(*dryRunPtr))...)
+	deleted, err := client.Prune(ctx, docker.RepositoryName(*repositoryPtr), *keepPtr, options)
+	for _, tag := range deleted {
+		fmt.Printf("%s\n", tag)
+	}
+	if err != nil {
+		return errors.Wrap(err, "prune failed")
+	}
+	return nil
+}
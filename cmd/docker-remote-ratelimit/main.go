@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/bborbe/docker-utils"
+	flag "github.com/bborbe/flagenv"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+var (
+	registryFlags = docker.NewRegistryFlags("", "registry")
+	clientFlags   = docker.NewClientFlags(docker.DefaultTimeout)
+	repositoryPtr = flag.String("repository", "ratelimitpreview/test", "Repository whose manifest is checked to read the rate limit")
+	tagPtr        = flag.String("tag", "latest", "Tag")
+)
+
+func main() {
+	defer glog.Flush()
+	glog.CopyStandardLogTo("info")
+	flag.Parse()
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	docker.RunCommand(do)
+}
+
+func do(ctx context.Context) error {
+	if len(*repositoryPtr) == 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter repository missing")
+	}
+	if len(*tagPtr) == 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter tag missing")
+	}
+	registry, err := registryFlags.Registry(clientFlags.DockerConfig())
+	if err != nil {
+		return err
+	}
+	glog.V(2).Infof("check rate limit of registry %v with repo %v and tag %v", registry, docker.RepositoryName(*repositoryPtr), docker.TagName(*tagPtr))
+	httpClient, err := clientFlags.HttpClientBuilder(*registry).Build()
+	if err != nil {
+		return errors.Wrap(err, "build http client failed")
+	}
+	client := docker.NewV2Client(docker.NewHttpClient(httpClient), *registry, clientFlags.ClientOptions()...)
+	// a HEAD request on the manifest reports the rate limit without counting as pull
+	if _, err := client.ExistsTag(ctx, docker.RepositoryName(*repositoryPtr), docker.TagName(*tagPtr)); err != nil {
+		return errors.Wrap(err, "check tag failed")
+	}
+	rateLimit, ok := client.LastRateLimit()
+	if !ok {
+		fmt.Printf("unlimited\n")
+		return nil
+	}
+	fmt.Printf("%v\n", rateLimit)
+	return nil
+}
@@ -3,19 +3,29 @@ package main
 import (
 	"context"
 	"fmt"
-	"net/http"
+	"io"
+	"os"
+	"regexp"
 	"runtime"
+	"time"
 
 	"github.com/bborbe/docker-utils"
 	flag "github.com/bborbe/flagenv"
 	"github.com/golang/glog"
+	"github.com/pkg/errors"
 )
 
 var (
-	registryPtr     = flag.String("registry", "", "Registry")
-	usernamePtr     = flag.String("username", "", "Username")
-	passwordPtr     = flag.String("password", "", "Password")
-	passwordFilePtr = flag.String("passwordfile", "", "Password-File")
+	registryFlags = docker.NewRegistryFlags("", "registry")
+	clientFlags   = docker.NewClientFlags(docker.DefaultTimeout)
+	pageSizePtr   = flag.Int("page-size", docker.DefaultPageSize, "Page-Size")
+	harborPtr     = flag.Bool("harbor", false, "List repositories per project with the harbor api instead of the catalog")
+	prefixPtr     = flag.String("prefix", "", "Only list repositories starting with prefix")
+	regexPtr      = flag.String("regex", "", "Only list repositories matching regular expression")
+	formatPtr     = flag.String("format", docker.FormatPlain, "Output format plain, json or template")
+	templatePtr   = flag.String("template", "{{.}}", "Go template applied per repository if format is template")
+	countPtr      = flag.Bool("count", false, "Only print the number of repositories")
+	maxResultsPtr = flag.Int("max-results", 0, "Stop after printing max results repositories, 0 lists all")
 )
 
 func main() {
@@ -23,33 +33,95 @@ func main() {
 	glog.CopyStandardLogTo("info")
 	flag.Parse()
 	runtime.GOMAXPROCS(runtime.NumCPU())
-	if err := do(context.Background()); err != nil {
-		glog.Exitf("%+v", err)
-	}
+	writer := docker.NewFlushWriter(os.Stdout, time.Second)
+	docker.RunCommand(func(ctx context.Context) error {
+		err := do(ctx, writer)
+		if closeErr := writer.Close(); closeErr != nil && err == nil {
+			err = errors.Wrap(closeErr, "flush output failed")
+		}
+		return err
+	})
 }
 
-func do(ctx context.Context) error {
-	registry := &docker.Registry{
-		Url:      *registryPtr,
-		Username: *usernamePtr,
-		Password: *passwordPtr,
-	}
-	if len(*passwordFilePtr) > 0 {
-		if err := registry.RegistryPasswordFromFile(*passwordFilePtr); err != nil {
-			return err
+func do(ctx context.Context, writer io.Writer) error {
+	if *pageSizePtr <= 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter page-size must be > 0")
+	}
+	formatter, err := docker.NewFormatter(writer, *formatPtr, *templatePtr)
+	if err != nil {
+		return err
+	}
+	filter := docker.RepositoryFilter{
+		Prefix: *prefixPtr,
+	}
+	if len(*regexPtr) > 0 {
+		if filter.Regexp, err = regexp.Compile(*regexPtr); err != nil {
+			return errors.Wrapf(docker.ErrUsage, "parameter regex invalid: %v", err)
 		}
 	}
+	registry, err := registryFlags.Registry(clientFlags.DockerConfig())
+	if err != nil {
+		return err
+	}
 	glog.V(2).Infof("use registry %v", registry)
-	client := docker.NewV2Client(docker.NewHttpClient(http.DefaultClient), *registry)
+	crawlStats := docker.NewCrawlStats()
+	defer func() {
+		fmt.Fprintf(os.Stderr, "%s\n", crawlStats.Snapshot())
+	}()
+	httpClient, err := clientFlags.HttpClientBuilder(*registry).
+		WithCrawlStats(crawlStats).
+		Build()
+	if err != nil {
+		return errors.Wrap(err, "build http client failed")
+	}
+	pageSize := *pageSizePtr
+	if *maxResultsPtr > 0 && *maxResultsPtr < pageSize && filter.IsEmpty() {
+		// without filter the first page already holds all results
+		pageSize = *maxResultsPtr
+	}
+	client := docker.NewV2Client(docker.NewHttpClient(httpClient), *registry, clientFlags.ClientOptions(docker.WithPageSize(pageSize), docker.WithHarbor(*harborPtr))...)
+	if err := client.Ping(ctx); err != nil {
+		return err
+	}
+	if *countPtr {
+		summary, err := client.Summary(ctx, docker.SummaryOptions{Filter: filter})
+		if err != nil {
+			return err
+		}
+		if err := formatter.Format(summary); err != nil {
+			return errors.Wrap(err, "write output failed")
+		}
+		if err := formatter.Close(); err != nil {
+			return errors.Wrap(err, "write output failed")
+		}
+		return nil
+	}
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	repositories := make(chan docker.RepositoryName, runtime.NumCPU())
+	var listErr error
 	go func() {
 		defer close(repositories)
-		if err := client.ListRepositories(ctx, repositories); err != nil {
-			glog.Warningf("read repos failed: %v", err)
-		}
+		listErr = client.ListRepositoriesFiltered(listCtx, filter, repositories)
 	}()
+	count := 0
 	for repository := range repositories {
-		fmt.Printf("%s\n", repository.String())
+		if *maxResultsPtr > 0 && count >= *maxResultsPtr {
+			// stop requesting further pages and drain what is already listed
+			cancel()
+			continue
+		}
+		count++
+		crawlStats.AddRepositories(1)
+		if err := formatter.Format(repository); err != nil {
+			return errors.Wrap(err, "write output failed")
+		}
+	}
+	if listErr != nil && !(listCtx.Err() != nil && ctx.Err() == nil) {
+		return errors.Wrap(listErr, "list repositories failed")
+	}
+	if err := formatter.Close(); err != nil {
+		return errors.Wrap(err, "write output failed")
 	}
 	return nil
 }
@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"net/http"
 	"runtime"
 
 	"github.com/bborbe/docker-utils"
@@ -13,12 +12,11 @@ import (
 )
 
 var (
-	registryPtr     = flag.String("registry", "", "Registry")
-	usernamePtr     = flag.String("username", "", "Username")
-	passwordPtr     = flag.String("password", "", "Password")
-	passwordFilePtr = flag.String("passwordfile", "", "Password-File")
-	repositoryPtr   = flag.String("repository", "", "Repository")
-	tagPtr          = flag.String("tag", "", "Tag")
+	registryFlags = docker.NewRegistryFlags("", "registry")
+	clientFlags   = docker.NewClientFlags(docker.DefaultTimeout)
+	repositoryPtr = flag.String("repository", "", "Repository")
+	tagPtr        = flag.String("tag", "", "Tag")
+	pinnedPtr     = flag.Bool("pinned", false, "Print repository@digest instead of the digest only")
 )
 
 func main() {
@@ -26,28 +24,34 @@ func main() {
 	glog.CopyStandardLogTo("info")
 	flag.Parse()
 	runtime.GOMAXPROCS(runtime.NumCPU())
-	if err := do(context.Background()); err != nil {
-		glog.Exitf("%+v", err)
-	}
+	docker.RunCommand(do)
 }
 
 func do(ctx context.Context) error {
-	registry := &docker.Registry{
-		Url:      *registryPtr,
-		Username: *usernamePtr,
-		Password: *passwordPtr,
+	if len(*repositoryPtr) == 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter repository missing")
+	}
+	if len(*tagPtr) == 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter tag missing")
 	}
-	if len(*passwordFilePtr) > 0 {
-		if err := registry.RegistryPasswordFromFile(*passwordFilePtr); err != nil {
-			return err
-		}
+	registry, err := registryFlags.Registry(clientFlags.DockerConfig())
+	if err != nil {
+		return err
 	}
 	glog.V(2).Infof("use registry %v, repo %v and tag %v", registry, docker.RepositoryName(*repositoryPtr), docker.TagName(*tagPtr))
-	client := docker.NewV2Client(docker.NewHttpClient(http.DefaultClient), *registry)
-	sha, err := client.Sha(ctx, docker.RepositoryName(*repositoryPtr), docker.TagName(*tagPtr))
+	httpClient, err := clientFlags.HttpClientBuilder(*registry).Build()
+	if err != nil {
+		return errors.Wrap(err, "build http client failed")
+	}
+	client := docker.NewV2Client(docker.NewHttpClient(httpClient), *registry, clientFlags.ClientOptions()...)
+	digest, err := client.Digest(ctx, docker.RepositoryName(*repositoryPtr), docker.TagName(*tagPtr))
 	if err != nil {
 		return errors.Wrap(err, "get sha failed")
 	}
-	fmt.Printf("%v\n", sha)
+	if *pinnedPtr {
+		fmt.Printf("%s@%s\n", *repositoryPtr, digest)
+		return nil
+	}
+	fmt.Printf("%v\n", digest)
 	return nil
 }
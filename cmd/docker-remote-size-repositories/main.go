@@ -3,19 +3,22 @@ package main
 import (
 	"context"
 	"fmt"
-	"net/http"
+	"io"
+	"os"
 	"runtime"
+	"time"
 
 	"github.com/bborbe/docker-utils"
 	flag "github.com/bborbe/flagenv"
 	"github.com/golang/glog"
+	"github.com/pkg/errors"
 )
 
 var (
-	registryPtr     = flag.String("registry", "", "Registry")
-	usernamePtr     = flag.String("username", "", "Username")
-	passwordPtr     = flag.String("password", "", "Password")
-	passwordFilePtr = flag.String("passwordfile", "", "Password-File")
+	registryFlags = docker.NewRegistryFlags("", "registry")
+	clientFlags   = docker.NewClientFlags(docker.DefaultTimeout)
+	pageSizePtr   = flag.Int("page-size", docker.DefaultPageSize, "Page-Size")
+	harborPtr     = flag.Bool("harbor", false, "List repositories per project with the harbor api instead of the catalog")
 )
 
 func main() {
@@ -23,52 +26,73 @@ func main() {
 	glog.CopyStandardLogTo("info")
 	flag.Parse()
 	runtime.GOMAXPROCS(runtime.NumCPU())
-	if err := do(context.Background()); err != nil {
-		glog.Exitf("%+v", err)
-	}
+	writer := docker.NewFlushWriter(os.Stdout, time.Second)
+	docker.RunCommand(func(ctx context.Context) error {
+		err := do(ctx, writer)
+		if closeErr := writer.Close(); closeErr != nil && err == nil {
+			err = errors.Wrap(closeErr, "flush output failed")
+		}
+		return err
+	})
 }
 
-func do(ctx context.Context) error {
-	registry := &docker.Registry{
-		Url:      *registryPtr,
-		Username: *usernamePtr,
-		Password: *passwordPtr,
+func do(ctx context.Context, writer io.Writer) error {
+	if *pageSizePtr <= 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter page-size must be > 0")
 	}
-	if len(*passwordFilePtr) > 0 {
-		if err := registry.RegistryPasswordFromFile(*passwordFilePtr); err != nil {
-			return err
-		}
+	registry, err := registryFlags.Registry(clientFlags.DockerConfig())
+	if err != nil {
+		return err
 	}
 	glog.V(2).Infof("use registry %v", registry)
-	client := docker.NewV2Client(docker.NewHttpClient(http.DefaultClient), *registry)
+	crawlStats := docker.NewCrawlStats()
+	defer func() {
+		fmt.Fprintf(os.Stderr, "%s\n", crawlStats.Snapshot())
+	}()
+	httpClient, err := clientFlags.HttpClientBuilder(*registry).
+		WithCrawlStats(crawlStats).
+		Build()
+	if err != nil {
+		return errors.Wrap(err, "build http client failed")
+	}
+	client := docker.NewV2Client(docker.NewHttpClient(httpClient), *registry, clientFlags.ClientOptions(docker.WithPageSize(*pageSizePtr), docker.WithHarbor(*harborPtr))...)
+	if err := client.Ping(ctx); err != nil {
+		return err
+	}
 	repositories := make(chan docker.RepositoryName, runtime.NumCPU())
+	var listErr error
 	go func() {
 		defer close(repositories)
-		if err := client.ListRepositories(ctx, repositories); err != nil {
-			glog.Warningf("read repos failed: %v", err)
-		}
+		listErr = client.ListRepositories(ctx, repositories)
 	}()
+	var errs []error
 	for repository := range repositories {
+		crawlStats.AddRepositories(1)
 		tags := make(chan docker.TagName, runtime.NumCPU())
+		var tagsErr error
 		go func() {
 			defer close(tags)
-			if err := client.ListTags(ctx, repository, tags); err != nil {
-				glog.Warningf("list tags %s failed\n", repository.String())
-			}
+			tagsErr = client.ListTags(ctx, repository, tags)
 		}()
-		var size int
+		var size int64
 		for tag := range tags {
-			manifest, err := client.Manifest(ctx, repository, tag)
+			crawlStats.AddTags(1)
+			tagSize, err := client.Size(ctx, repository, tag)
 			if err != nil {
-				glog.Warningf("get manifest %s %s failed\n", repository.String(), tag.String())
+				errs = append(errs, errors.Wrapf(err, "get manifest %s %s failed", repository.String(), tag.String()))
 				continue
 			}
-			size += manifest.Config.Size
-			for _, layer := range manifest.Layers {
-				size += layer.Size
-			}
+			size += tagSize
 		}
-		fmt.Printf("%s %d MB\n", repository.String(), size/1024/1024)
+		if tagsErr != nil {
+			errs = append(errs, errors.Wrapf(tagsErr, "list tags %s failed", repository.String()))
+		}
+		if _, err := fmt.Fprintf(writer, "%s %d MB\n", repository.String(), size/1024/1024); err != nil {
+			return errors.Wrap(err, "write output failed")
+		}
+	}
+	if listErr != nil {
+		errs = append(errs, errors.Wrap(listErr, "list repositories failed"))
 	}
-	return nil
+	return docker.CombineErrors(errs)
 }
@@ -3,20 +3,22 @@ package main
 import (
 	"context"
 	"fmt"
-	"net/http"
+	"io"
+	"os"
 	"runtime"
+	"time"
 
 	"github.com/bborbe/docker-utils"
 	flag "github.com/bborbe/flagenv"
 	"github.com/golang/glog"
+	"github.com/pkg/errors"
 )
 
 var (
-	registryPtr     = flag.String("registry", "", "Registry")
-	usernamePtr     = flag.String("username", "", "Username")
-	passwordPtr     = flag.String("password", "", "Password")
-	passwordFilePtr = flag.String("passwordfile", "", "Password-File")
-	repositoryPtr   = flag.String("repository", "", "Repository")
+	registryFlags = docker.NewRegistryFlags("", "registry")
+	clientFlags   = docker.NewClientFlags(docker.DefaultTimeout)
+	pageSizePtr   = flag.Int("page-size", docker.DefaultPageSize, "Page-Size")
+	repositoryPtr = flag.String("repository", "", "Repository")
 )
 
 func main() {
@@ -24,43 +26,62 @@ func main() {
 	glog.CopyStandardLogTo("info")
 	flag.Parse()
 	runtime.GOMAXPROCS(runtime.NumCPU())
-	if err := do(context.Background()); err != nil {
-		glog.Exitf("%+v", err)
-	}
+	writer := docker.NewFlushWriter(os.Stdout, time.Second)
+	docker.RunCommand(func(ctx context.Context) error {
+		err := do(ctx, writer)
+		if closeErr := writer.Close(); closeErr != nil && err == nil {
+			err = errors.Wrap(closeErr, "flush output failed")
+		}
+		return err
+	})
 }
 
-func do(ctx context.Context) error {
-	registry := &docker.Registry{
-		Url:      *registryPtr,
-		Username: *usernamePtr,
-		Password: *passwordPtr,
+func do(ctx context.Context, writer io.Writer) error {
+	if len(*repositoryPtr) == 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter repository missing")
 	}
-	if len(*passwordFilePtr) > 0 {
-		if err := registry.RegistryPasswordFromFile(*passwordFilePtr); err != nil {
-			return err
-		}
+	if *pageSizePtr <= 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter page-size must be > 0")
+	}
+	registry, err := registryFlags.Registry(clientFlags.DockerConfig())
+	if err != nil {
+		return err
 	}
 	glog.V(2).Infof("use registry %v", registry)
-	client := docker.NewV2Client(docker.NewHttpClient(http.DefaultClient), *registry)
+	crawlStats := docker.NewCrawlStats()
+	defer func() {
+		fmt.Fprintf(os.Stderr, "%s\n", crawlStats.Snapshot())
+	}()
+	httpClient, err := clientFlags.HttpClientBuilder(*registry).
+		WithCrawlStats(crawlStats).
+		Build()
+	if err != nil {
+		return errors.Wrap(err, "build http client failed")
+	}
+	client := docker.NewV2Client(docker.NewHttpClient(httpClient), *registry, clientFlags.ClientOptions(docker.WithPageSize(*pageSizePtr))...)
+	if err := client.Ping(ctx); err != nil {
+		return err
+	}
 	tags := make(chan docker.TagName, runtime.NumCPU())
+	var listErr error
 	go func() {
 		defer close(tags)
-		if err := client.ListTags(ctx, docker.RepositoryName(*repositoryPtr), tags); err != nil {
-			glog.Warningf("list tags failed: %v", err)
-		}
+		listErr = client.ListTags(ctx, docker.RepositoryName(*repositoryPtr), tags)
 	}()
+	var errs []error
 	for tag := range tags {
-		manifest, err := client.Manifest(ctx, docker.RepositoryName(*repositoryPtr), tag)
+		crawlStats.AddTags(1)
+		size, err := client.Size(ctx, docker.RepositoryName(*repositoryPtr), tag)
 		if err != nil {
-			glog.Warningf("get manifest %s %s failed\n", docker.RepositoryName(*repositoryPtr).String(), tag.String())
+			errs = append(errs, errors.Wrapf(err, "get manifest %s %s failed", docker.RepositoryName(*repositoryPtr).String(), tag.String()))
 			continue
 		}
-		var size int
-		size += manifest.Config.Size
-		for _, layer := range manifest.Layers {
-			size += layer.Size
+		if _, err := fmt.Fprintf(writer, "%s:%s %d MB\n", docker.RepositoryName(*repositoryPtr).String(), tag.String(), size/1024/1024); err != nil {
+			return errors.Wrap(err, "write output failed")
 		}
-		fmt.Printf("%s:%s %d MB\n", docker.RepositoryName(*repositoryPtr).String(), tag.String(), size/1024/1024)
 	}
-	return nil
+	if listErr != nil {
+		errs = append(errs, errors.Wrap(listErr, "list tags failed"))
+	}
+	return docker.CombineErrors(errs)
 }
@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"net/http"
 	"runtime"
 
 	"github.com/bborbe/docker-utils"
@@ -13,12 +12,13 @@ import (
 )
 
 var (
-	registryPtr     = flag.String("registry", "", "Registry")
-	usernamePtr     = flag.String("username", "", "Username")
-	passwordPtr     = flag.String("password", "", "Password")
-	passwordFilePtr = flag.String("passwordfile", "", "Password-File")
-	repositoryPtr   = flag.String("repository", "", "Repository")
-	tagPtr          = flag.String("tag", "", "Tag")
+	registryFlags = docker.NewRegistryFlags("", "registry")
+	clientFlags   = docker.NewClientFlags(docker.DefaultTimeout)
+	repositoryPtr = flag.String("repository", "", "Repository")
+	tagPtr        = flag.String("tag", "", "Tag")
+	patternPtr    = flag.String("pattern", "", "Delete all tags matching the glob instead of a single tag")
+	regexPtr      = flag.String("regex", "", "Delete all tags matching the regexp instead of a single tag")
+	dryRunPtr     = flag.Bool("dry-run", false, "Only print what would be deleted")
 )
 
 func main() {
@@ -26,27 +26,78 @@ func main() {
 	glog.CopyStandardLogTo("info")
 	flag.Parse()
 	runtime.GOMAXPROCS(runtime.NumCPU())
-	if err := do(context.Background()); err != nil {
-		glog.Exitf("%+v", err)
-	}
+	docker.RunCommand(do)
 }
 
 func do(ctx context.Context) error {
-	registry := &docker.Registry{
-		Url:      *registryPtr,
-		Username: *usernamePtr,
-		Password: *passwordPtr,
-	}
-	if len(*passwordFilePtr) > 0 {
-		if err := registry.RegistryPasswordFromFile(*passwordFilePtr); err != nil {
-			return err
-		}
+	if len(*repositoryPtr) == 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter repository missing")
+	}
+	matcher, err := tagMatcher()
+	if err != nil {
+		return err
+	}
+	registry, err := registryFlags.Registry(clientFlags.DockerConfig())
+	if err != nil {
+		return err
 	}
 	glog.V(2).Infof("use registry %v, repo %v and tag %v", registry, docker.RepositoryName(*repositoryPtr), docker.TagName(*tagPtr))
-	client := docker.NewV2Client(docker.NewHttpClient(http.DefaultClient), *registry)
+	httpClient, err := clientFlags.HttpClientBuilder(*registry).Build()
+	if err != nil {
+		return errors.Wrap(err, "build http client failed")
+	}
+	plan := docker.NewPlan()
+	client := docker.NewV2Client(docker.NewHttpClient(httpClient), *registry, clientFlags.ClientOptions(docker.WithDryRun(*dryRunPtr), docker.WithPlan(plan))...)
+	if matcher != nil {
+		deleted, err := client.DeleteMatching(ctx, docker.RepositoryName(*repositoryPtr), matcher, *dryRunPtr)
+		for _, tag := range deleted {
+			fmt.Printf("%s\n", tag)
+		}
+		if err != nil {
+			return errors.Wrap(err, "delete matching tags failed")
+		}
+		return nil
+	}
 	if err := client.DeleteTag(ctx, docker.RepositoryName(*repositoryPtr), docker.TagName(*tagPtr)); err != nil {
-		return errors.Wrap(err, "delete tag exists failed")
+		return errors.Wrap(err, "delete tag failed")
+	}
+	// the manifest is deleted by digest, other tags of the same digest are gone too
+	var digest docker.Digest
+	if actions := plan.Actions(); len(actions) > 0 {
+		digest = actions[0].Digest
 	}
-	fmt.Printf("tag deleted\n")
+	if *dryRunPtr {
+		fmt.Printf("tag would be deleted (%s)\n", digest)
+		return nil
+	}
+	fmt.Printf("tag deleted (%s)\n", digest)
 	return nil
 }
+
+// tagMatcher returns the matcher of -pattern or -regex, or nil if a single -tag is deleted.
+func tagMatcher() (docker.TagMatcher, error) {
+	given := 0
+	for _, value := range []string{*tagPtr, *patternPtr, *regexPtr} {
+		if len(value) > 0 {
+			given++
+		}
+	}
+	if given != 1 {
+		return nil, errors.Wrap(docker.ErrUsage, "exactly one of parameter tag, pattern or regex required")
+	}
+	switch {
+	case len(*patternPtr) > 0:
+		matcher, err := docker.NewTagGlob(*patternPtr)
+		if err != nil {
+			return nil, errors.Wrap(docker.ErrUsage, err.Error())
+		}
+		return matcher, nil
+	case len(*regexPtr) > 0:
+		matcher, err := docker.NewTagRegexp(*regexPtr)
+		if err != nil {
+			return nil, errors.Wrap(docker.ErrUsage, err.Error())
+		}
+		return matcher, nil
+	}
+	return nil, nil
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"net/http"
 	"runtime"
 
 	"github.com/bborbe/docker-utils"
@@ -13,12 +12,12 @@ import (
 )
 
 var (
-	registryPtr     = flag.String("registry", "", "Registry")
-	usernamePtr     = flag.String("username", "", "Username")
-	passwordPtr     = flag.String("password", "", "Password")
-	passwordFilePtr = flag.String("passwordfile", "", "Password-File")
-	repositoryPtr   = flag.String("repository", "", "Repository")
-	tagPtr          = flag.String("tag", "", "Tag")
+	registryFlags = docker.NewRegistryFlags("", "registry")
+	clientFlags   = docker.NewClientFlags(docker.DefaultTimeout)
+	repositoryPtr = flag.String("repository", "", "Repository")
+	tagPtr        = flag.String("tag", "", "Tag")
+	platformPtr   = flag.String("platform", "", "Only true if the tag has an image for os/architecture[/variant], e.g. linux/arm64")
+	exitCodePtr   = flag.Bool("exit-code", true, "Exit with 1 if the tag does not exist, with false a missing tag exits with 0")
 )
 
 func main() {
@@ -26,28 +25,46 @@ func main() {
 	glog.CopyStandardLogTo("info")
 	flag.Parse()
 	runtime.GOMAXPROCS(runtime.NumCPU())
-	if err := do(context.Background()); err != nil {
-		glog.Exitf("%+v", err)
-	}
+	docker.RunCommand(do)
 }
 
 func do(ctx context.Context) error {
-	registry := &docker.Registry{
-		Url:      *registryPtr,
-		Username: *usernamePtr,
-		Password: *passwordPtr,
-	}
-	if len(*passwordFilePtr) > 0 {
-		if err := registry.RegistryPasswordFromFile(*passwordFilePtr); err != nil {
-			return err
+	if len(*repositoryPtr) == 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter repository missing")
+	}
+	if len(*tagPtr) == 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter tag missing")
+	}
+	var platform docker.Platform
+	if len(*platformPtr) > 0 {
+		var err error
+		if platform, err = docker.ParsePlatform(*platformPtr); err != nil {
+			return errors.Wrap(docker.ErrUsage, err.Error())
 		}
 	}
+	registry, err := registryFlags.Registry(clientFlags.DockerConfig())
+	if err != nil {
+		return err
+	}
 	glog.V(2).Infof("use registry %v, repo %v and tag %v", registry, docker.RepositoryName(*repositoryPtr), docker.TagName(*tagPtr))
-	client := docker.NewV2Client(docker.NewHttpClient(http.DefaultClient), *registry)
+	httpClient, err := clientFlags.HttpClientBuilder(*registry).Build()
+	if err != nil {
+		return errors.Wrap(err, "build http client failed")
+	}
+	client := docker.NewV2Client(docker.NewHttpClient(httpClient), *registry, clientFlags.ClientOptions()...)
 	exists, err := client.ExistsTag(ctx, docker.RepositoryName(*repositoryPtr), docker.TagName(*tagPtr))
 	if err != nil {
 		return errors.Wrap(err, "check tag exists failed")
 	}
+	if exists && len(*platformPtr) > 0 {
+		exists, err = client.HasPlatform(ctx, docker.RepositoryName(*repositoryPtr), docker.TagName(*tagPtr), platform)
+		if err != nil {
+			return errors.Wrapf(err, "check platform %s failed", platform)
+		}
+	}
 	fmt.Printf("%v\n", exists)
+	if !exists && *exitCodePtr {
+		return docker.ErrTagNotExists
+	}
 	return nil
 }
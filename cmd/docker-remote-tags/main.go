@@ -3,54 +3,105 @@ package main
 import (
 	"context"
 	"fmt"
-	"net/http"
+	"io"
+	"os"
 	"runtime"
+	"time"
 
 	"github.com/bborbe/docker-utils"
 	flag "github.com/bborbe/flagenv"
 	"github.com/golang/glog"
+	"github.com/pkg/errors"
 )
 
 var (
-	registryPtr     = flag.String("registry", "", "Registry")
-	usernamePtr     = flag.String("username", "", "Username")
-	passwordPtr     = flag.String("password", "", "Password")
-	passwordFilePtr = flag.String("passwordfile", "", "Password-File")
-	repositoryPtr   = flag.String("repository", "", "Repository")
+	registryFlags = docker.NewRegistryFlags("", "registry")
+	clientFlags   = docker.NewClientFlags(docker.DefaultTimeout)
+	pageSizePtr   = flag.Int("page-size", docker.DefaultPageSize, "Page-Size")
+	repositoryPtr = flag.String("repository", "", "Repository")
+	maxResultsPtr = flag.Int("max-results", 0, "Stop after printing max results tags, 0 lists all")
+	tagFilter     docker.TagFilter
 )
 
+func init() {
+	flag.Var(&tagFilter.Include, "keep-pattern", "Only list tags matching glob (repeatable)")
+	flag.Var(&tagFilter.Exclude, "delete-pattern", "Skip tags matching glob (repeatable)")
+}
+
 func main() {
 	defer glog.Flush()
 	glog.CopyStandardLogTo("info")
 	flag.Parse()
 	runtime.GOMAXPROCS(runtime.NumCPU())
-	if err := do(context.Background()); err != nil {
-		glog.Exitf("%+v", err)
-	}
+	writer := docker.NewFlushWriter(os.Stdout, time.Second)
+	docker.RunCommand(func(ctx context.Context) error {
+		err := do(ctx, writer)
+		if closeErr := writer.Close(); closeErr != nil && err == nil {
+			err = errors.Wrap(closeErr, "flush output failed")
+		}
+		return err
+	})
 }
 
-func do(ctx context.Context) error {
-	registry := &docker.Registry{
-		Url:      *registryPtr,
-		Username: *usernamePtr,
-		Password: *passwordPtr,
-	}
-	if len(*passwordFilePtr) > 0 {
-		if err := registry.RegistryPasswordFromFile(*passwordFilePtr); err != nil {
-			return err
-		}
+func do(ctx context.Context, writer io.Writer) error {
+	if len(*repositoryPtr) == 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter repository missing")
+	}
+	if err := tagFilter.Validate(); err != nil {
+		return errors.Wrap(docker.ErrUsage, err.Error())
+	}
+	if *pageSizePtr <= 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter page-size must be > 0")
+	}
+	registry, err := registryFlags.Registry(clientFlags.DockerConfig())
+	if err != nil {
+		return err
 	}
 	glog.V(2).Infof("use registry %v and repo %v", registry, docker.RepositoryName(*repositoryPtr))
-	client := docker.NewV2Client(docker.NewHttpClient(http.DefaultClient), *registry)
+	crawlStats := docker.NewCrawlStats()
+	defer func() {
+		fmt.Fprintf(os.Stderr, "%s\n", crawlStats.Snapshot())
+	}()
+	httpClient, err := clientFlags.HttpClientBuilder(*registry).
+		WithCrawlStats(crawlStats).
+		Build()
+	if err != nil {
+		return errors.Wrap(err, "build http client failed")
+	}
+	client := docker.NewV2Client(docker.NewHttpClient(httpClient), *registry, clientFlags.ClientOptions(docker.WithPageSize(*pageSizePtr))...)
+	if err := client.Ping(ctx); err != nil {
+		return err
+	}
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	tags := make(chan docker.TagName, runtime.NumCPU())
+	var listErr error
 	go func() {
 		defer close(tags)
-		if err := client.ListTags(ctx, docker.RepositoryName(*repositoryPtr), tags); err != nil {
-			glog.Warningf("list tags failed: %v", err)
-		}
+		listErr = client.ListTags(listCtx, docker.RepositoryName(*repositoryPtr), tags)
 	}()
+	count := 0
 	for tag := range tags {
-		fmt.Printf("%s\n", tag.String())
+		if *maxResultsPtr > 0 && count >= *maxResultsPtr {
+			// stop requesting further pages and drain what is already listed
+			cancel()
+			continue
+		}
+		crawlStats.AddTags(1)
+		if !tagFilter.Match(tag) {
+			glog.V(2).Infof("skip tag %s", tag)
+			continue
+		}
+		count++
+		if _, err := fmt.Fprintf(writer, "%s\n", tag.String()); err != nil {
+			return errors.Wrap(err, "write output failed")
+		}
+	}
+	if errors.Cause(listErr) == docker.ErrNotFound {
+		return errors.Wrapf(listErr, "repository %s not found in registry %s", *repositoryPtr, registry.Url)
+	}
+	if listErr != nil && !(listCtx.Err() != nil && ctx.Err() == nil) {
+		return errors.Wrap(listErr, "list tags failed")
 	}
 	return nil
 }
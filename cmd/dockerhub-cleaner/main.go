@@ -3,12 +3,9 @@ package main
 import (
 	"context"
 	"fmt"
-	"net/http"
 	"os"
-	"os/signal"
 	"runtime"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/bborbe/argument"
@@ -26,70 +23,80 @@ func main() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 	_ = flag.Set("logtostderr", "true")
 
-	app := &application{}
+	app := &application{
+		ClientFlags: docker.NewClientFlags(docker.DefaultTimeout),
+	}
+	flag.Var(&app.TagFilter.Include, "keep-pattern", "Keep tags matching glob (repeatable)")
+	flag.Var(&app.TagFilter.Exclude, "delete-pattern", "Delete tags matching glob regardless of max-age and keep-pattern (repeatable)")
 	if err := argument.Parse(app); err != nil {
-		glog.Exitf("parse args failed: %v", err)
+		glog.Errorf("parse args failed: %v", err)
+		glog.Flush()
+		os.Exit(docker.ExitCodeUsage)
 	}
 
 	glog.V(0).Infof("application started")
-	if err := app.run(contextWithSig(context.Background())); err != nil {
-		glog.Exitf("application failed: %+v", err)
-	}
+	docker.RunCommand(app.run)
 	glog.V(0).Infof("application finished")
-	os.Exit(0)
-}
-
-func contextWithSig(ctx context.Context) context.Context {
-	ctxWithCancel, cancel := context.WithCancel(ctx)
-	go func() {
-		defer cancel()
-
-		signalCh := make(chan os.Signal, 1)
-		signal.Notify(signalCh, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-
-		select {
-		case <-signalCh:
-		case <-ctx.Done():
-		}
-		glog.V(2).Infof("cancled")
-	}()
-
-	return ctxWithCancel
 }
 
 type application struct {
 	Url          string        `required:"true" arg:"url" default:"https://registry-1.docker.io" usage:"Registry Url"`
-	Username     string        `required:"true" arg:"username" usage:"Registry Username"`
+	Username     string        `arg:"username" usage:"Registry Username, defaults to the Docker Hub user of the docker config"`
 	Password     string        `arg:"password" usage:"Registry Password" display:"length"`
 	PasswordFile string        `arg:"passwordfile" usage:"Password-File"`
+	PasswordEnv  string        `arg:"password-env" usage:"Environment variable with the password if password and passwordfile are empty" default:"DOCKER_PASSWORD"`
+	AuthUrl      string        `arg:"auth-url" usage:"Login url of a Docker Hub compatible service" default:"https://hub.docker.com/v2/users/login/"`
 	MaxAge       time.Duration `required:"true" arg:"max-age" usage:"Max age" default:"2400h"`
+	DryRun       bool          `arg:"dry-run" usage:"Only print tags that would be deleted"`
+	TagFilter    docker.TagFilter
+	ClientFlags  *docker.ClientFlags `display:"hidden"`
 }
 
 func (a *application) run(ctx context.Context) error {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	if err := a.TagFilter.Validate(); err != nil {
+		return errors.Wrap(docker.ErrUsage, err.Error())
+	}
 
 	registry := docker.Registry{
 		Url:      a.Url,
 		Username: a.Username,
 		Password: a.Password,
+		AuthUrl:  a.AuthUrl,
+	}
+	if err := registry.Validate(); err != nil {
+		return errors.Wrap(docker.ErrUsage, err.Error())
 	}
 
-	if len(a.PasswordFile) > 0 {
-		if err := registry.RegistryPasswordFromFile(a.PasswordFile); err != nil {
-			return err
-		}
+	if err := registry.ResolveCredentials(docker.CredentialOptions{
+		PasswordFile: a.PasswordFile,
+		PasswordEnv:  a.PasswordEnv,
+		DockerConfig: a.ClientFlags.DockerConfig(),
+	}); err != nil {
+		return err
+	}
+	if len(registry.Username) == 0 {
+		return errors.Wrap(docker.ErrUsage, "parameter username missing")
 	}
 	now := time.Now()
 
-	httpClient := docker.NewHttpClient(http.DefaultClient)
-	dockerHubClient := docker.NewDockerHubClient(httpClient, registry)
+	client, err := a.ClientFlags.HttpClientBuilder(registry).Build()
+	if err != nil {
+		return errors.Wrap(err, "build http client failed")
+	}
+	httpClient := docker.NewHttpClient(client)
+	dockerHubClient := docker.NewDockerHubClient(httpClient, registry, a.ClientFlags.ClientOptions(docker.WithDryRun(a.DryRun))...)
+	var mux sync.Mutex
+	var errs []error
+	addError := func(err error) {
+		mux.Lock()
+		defer mux.Unlock()
+		errs = append(errs, err)
+	}
 	repositories := make(chan docker.DockerHubTagRepository, runtime.NumCPU())
 	go func() {
 		defer close(repositories)
 		if err := dockerHubClient.ListRepositories(ctx, docker.RepositoryName(registry.Username), repositories); err != nil {
-			glog.Warningf("read repositories failed: %v", err)
-			cancel()
+			addError(errors.Wrap(err, "read repositories failed"))
 		}
 	}()
 	type entry struct {
@@ -98,54 +105,45 @@ func (a *application) run(ctx context.Context) error {
 	}
 	var wg sync.WaitGroup
 	for repository := range repositories {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-			var list []entry
-			tags := make(chan docker.DockerHubTag, runtime.NumCPU())
-			go func() {
-				defer close(tags)
-				if err := dockerHubClient.ListTags(ctx, repository.RepositoryName(), tags); err != nil {
-					glog.Warningf("list tags failed: %v", err)
-					cancel()
-				}
-			}()
-			for tag := range tags {
-				select {
-				case <-ctx.Done():
-					return nil
-				default:
-					date, err := time.Parse(time.RFC3339Nano, tag.LastUpdated)
-					if err != nil {
-						return errors.Wrapf(err, "parse date %s failed", tag.LastUpdated)
-					}
-					if now.Sub(date) > a.MaxAge {
-						list = append(list, entry{
-							Tag:  tag.Tag,
-							Repo: repository.RepositoryName(),
-						})
-					}
-				}
+		var list []entry
+		tags := make(chan docker.DockerHubTag, runtime.NumCPU())
+		go func() {
+			defer close(tags)
+			if err := dockerHubClient.ListTags(ctx, repository.RepositoryName(), tags); err != nil {
+				addError(errors.Wrapf(err, "list tags of %s failed", repository.RepositoryName()))
+			}
+		}()
+		for tag := range tags {
+			date, err := time.Parse(time.RFC3339Nano, tag.LastUpdated)
+			if err != nil {
+				addError(errors.Wrapf(err, "parse date %s failed", tag.LastUpdated))
+				continue
 			}
-			for _, rm := range list {
-				wg.Add(1)
-				go func(rm entry) {
-					defer wg.Done()
-					select {
-					case <-ctx.Done():
-						return
-					default:
-						if err := dockerHubClient.DeleteTag(ctx, rm.Repo, rm.Tag); err != nil {
-							cancel()
-							glog.Warningf("delete failed: %v", err)
-						}
-						fmt.Printf("deleted %s:%s\n", rm.Repo, rm.Tag)
-					}
-				}(rm)
+			if !a.TagFilter.ShouldDelete(tag.Tag, now.Sub(date), a.MaxAge) {
+				glog.V(2).Infof("keep %s:%s", repository.RepositoryName(), tag.Tag)
+				continue
 			}
+			list = append(list, entry{
+				Tag:  tag.Tag,
+				Repo: repository.RepositoryName(),
+			})
+		}
+		for _, rm := range list {
+			wg.Add(1)
+			go func(rm entry) {
+				defer wg.Done()
+				if err := dockerHubClient.DeleteTag(ctx, rm.Repo, rm.Tag); err != nil {
+					addError(errors.Wrapf(err, "delete %s:%s failed", rm.Repo, rm.Tag))
+					return
+				}
+				if a.DryRun {
+					fmt.Printf("would delete %s:%s\n", rm.Repo, rm.Tag)
+					return
+				}
+				fmt.Printf("deleted %s:%s\n", rm.Repo, rm.Tag)
+			}(rm)
 		}
 	}
 	wg.Wait()
-	return nil
+	return docker.CombineErrors(errs)
 }
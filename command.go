@@ -0,0 +1,27 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// RunCommand runs the main function of a command with a context cancelled on ctrl-c or SIGTERM,
+// so running requests stop. A returned error is logged and exits the process with its ExitCode,
+// ErrTagNotExists only exits.
+func RunCommand(fn func(ctx context.Context) error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := fn(ctx)
+	stop()
+	if err != nil {
+		if errors.Cause(err) != ErrTagNotExists {
+			glog.Errorf("%+v", err)
+		}
+		glog.Flush()
+		os.Exit(ExitCode(err))
+	}
+}
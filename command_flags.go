@@ -0,0 +1,124 @@
+package docker
+
+import (
+	"strings"
+	"time"
+
+	flag "github.com/bborbe/flagenv"
+	"github.com/pkg/errors"
+)
+
+// RegistryFlags are the flags of a registry and its credentials.
+type RegistryFlags struct {
+	prefix       string
+	url          *string
+	username     *string
+	password     *string
+	passwordFile *string
+	passwordEnv  *string
+	insecure     *bool
+	anonymous    *bool
+}
+
+// NewRegistryFlags registers -registry, -username, -password, -passwordfile, -password-env, -insecure and -anonymous.
+// The prefix like src- tells the registries of commands using more than one apart, name describes the registry in the usage.
+func NewRegistryFlags(prefix string, name string) *RegistryFlags {
+	return &RegistryFlags{
+		prefix:       prefix,
+		url:          flag.String(prefix+"registry", "", strings.ToUpper(name[:1])+name[1:]),
+		username:     flag.String(prefix+"username", "", "Username of the "+name),
+		password:     flag.String(prefix+"password", "", "Password of the "+name),
+		passwordFile: flag.String(prefix+"passwordfile", "", "File with the password of the "+name),
+		passwordEnv:  flag.String(prefix+"password-env", DefaultPasswordEnv, "Environment variable with the password of the "+name+" if password and passwordfile are empty"),
+		insecure:     flag.Bool(prefix+"insecure", false, "Use plain http for the "+name),
+		anonymous:    flag.Bool(prefix+"anonymous", false, "Access the "+name+" without credentials, only public repositories are visible"),
+	}
+}
+
+// Registry validates the flags and completes the credentials with ResolveCredentials.
+// Missing or invalid flags are returned as ErrUsage.
+func (r *RegistryFlags) Registry(dockerConfig string) (*Registry, error) {
+	if len(*r.url) == 0 {
+		return nil, errors.Wrapf(ErrUsage, "parameter %sregistry missing", r.prefix)
+	}
+	registry := &Registry{
+		Url:       *r.url,
+		Username:  *r.username,
+		Password:  *r.password,
+		Insecure:  *r.insecure,
+		Anonymous: *r.anonymous,
+	}
+	if err := registry.Validate(); err != nil {
+		return nil, errors.Wrap(ErrUsage, err.Error())
+	}
+	if err := registry.ResolveCredentials(CredentialOptions{
+		PasswordFile: *r.passwordFile,
+		PasswordEnv:  *r.passwordEnv,
+		DockerConfig: dockerConfig,
+	}); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// ClientFlags are the flags of the http client and the registry clients shared by all commands.
+type ClientFlags struct {
+	dockerConfig       *string
+	insecureSkipVerify *bool
+	clientCert         *string
+	clientKey          *string
+	caCert             *string
+	certsDir           *string
+	maxRetries         *int
+	retryDelay         *time.Duration
+	timeout            *time.Duration
+	dialTimeout        *time.Duration
+	proxy              *string
+	noCache            *bool
+}
+
+// NewClientFlags registers the flags of docker config, TLS, retries, timeouts, proxy and token cache.
+// timeout is the default of -timeout, commands transferring blobs use 0.
+func NewClientFlags(timeout time.Duration) *ClientFlags {
+	return &ClientFlags{
+		dockerConfig:       flag.String("docker-config", "", "Read credentials from docker config.json if username is empty, defaults to $DOCKER_CONFIG/config.json or ~/.docker/config.json"),
+		insecureSkipVerify: flag.Bool("insecure-skip-tls-verify", false, "Skip TLS certificate verification"),
+		clientCert:         flag.String("client-cert", "", "Client certificate file for mTLS"),
+		clientKey:          flag.String("client-key", "", "Client key file for mTLS"),
+		caCert:             flag.String("ca-cert", "", "CA certificate bundle trusted in addition to the system roots"),
+		certsDir:           flag.String("certs-dir", DefaultDockerCertsDir, "Directory with ca and client certificates per registry host like docker uses"),
+		maxRetries:         flag.Int("max-retries", DefaultMaxRetries, "Max retries on 429 and 5xx"),
+		retryDelay:         flag.Duration("retry-delay", DefaultRetryDelay, "Base delay between retries"),
+		timeout:            flag.Duration("timeout", timeout, "Timeout of a request to the registry, 0 for none"),
+		dialTimeout:        flag.Duration("dial-timeout", DefaultDialTimeout, "Timeout of connecting to the registry"),
+		proxy:              flag.String("proxy", "", "Proxy url, defaults to HTTP_PROXY and HTTPS_PROXY of the environment"),
+		noCache:            flag.Bool("no-cache", false, "Do not reuse tokens of previous runs from the token cache"),
+	}
+}
+
+// DockerConfig returns the path given by -docker-config, empty uses DockerConfigPath.
+func (c *ClientFlags) DockerConfig() string {
+	return *c.dockerConfig
+}
+
+// HttpClientBuilder returns a builder configured by the flags with the certificates of the certs dir for the given registries.
+// Commands add their own options like WithCrawlStats before Build.
+func (c *ClientFlags) HttpClientBuilder(registries ...Registry) HttpClientBuilder {
+	builder := NewHttpClientBuilder().
+		WithInsecureSkipVerify(*c.insecureSkipVerify).
+		WithClientCertificate(*c.clientCert, *c.clientKey).
+		WithCACertificate(*c.caCert).
+		WithRetry(*c.maxRetries, *c.retryDelay).
+		WithTimeout(*c.timeout).
+		WithDialTimeout(*c.dialTimeout).
+		WithProxy(*c.proxy)
+	for _, registry := range registries {
+		builder = builder.WithDockerCertsDir(*c.certsDir, registry)
+	}
+	return builder
+}
+
+// ClientOptions returns the options of the flags followed by the given options of the command.
+func (c *ClientFlags) ClientOptions(options ...ClientOption) []ClientOption {
+	return append([]ClientOption{WithTokenCache(!*c.noCache)}, options...)
+}
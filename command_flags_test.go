@@ -0,0 +1,73 @@
+package docker_test
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+// the flags are registered once in the global flag set like the commands do
+var (
+	testRegistryFlags = docker.NewRegistryFlags("test-", "test registry")
+	testClientFlags   = docker.NewClientFlags(docker.DefaultTimeout)
+)
+
+var _ = Describe("CommandFlags", func() {
+	set := func(name string, value string) {
+		Expect(flag.Set(name, value)).To(BeNil())
+	}
+	BeforeEach(func() {
+		set("test-registry", "")
+		set("test-username", "")
+		set("test-password", "")
+		set("test-anonymous", "false")
+		set("max-retries", "0")
+	})
+	It("returns usage error without registry", func() {
+		_, err := testRegistryFlags.Registry(testClientFlags.DockerConfig())
+		Expect(errors.Cause(err)).To(Equal(docker.ErrUsage))
+		Expect(err.Error()).To(ContainSubstring("test-registry"))
+	})
+	It("returns the registry of the flags", func() {
+		set("test-registry", "registry.example.com")
+		set("test-username", "bborbe")
+		set("test-password", "secret")
+		registry, err := testRegistryFlags.Registry(testClientFlags.DockerConfig())
+		Expect(err).To(BeNil())
+		Expect(registry.Url).To(Equal("registry.example.com"))
+		Expect(registry.Username).To(Equal("bborbe"))
+		Expect(registry.Password).To(Equal("secret"))
+	})
+	It("reads the password from the environment variable of the flags", func() {
+		os.Setenv("DOCKER_UTILS_TEST_PASSWORD", "env")
+		defer os.Unsetenv("DOCKER_UTILS_TEST_PASSWORD")
+		set("test-registry", "registry.example.com")
+		set("test-username", "bborbe")
+		set("test-password-env", "DOCKER_UTILS_TEST_PASSWORD")
+		defer set("test-password-env", docker.DefaultPasswordEnv)
+		registry, err := testRegistryFlags.Registry(testClientFlags.DockerConfig())
+		Expect(err).To(BeNil())
+		Expect(registry.Password).To(Equal("env"))
+	})
+	It("builds a http client with the flags", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+		client, err := testClientFlags.HttpClientBuilder(docker.Registry{Url: server.URL}).Build()
+		Expect(err).To(BeNil())
+		resp, err := client.Get(server.URL)
+		Expect(err).To(BeNil())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+	})
+	It("returns the token cache option before the options of the command", func() {
+		Expect(testClientFlags.ClientOptions(docker.WithDryRun(true))).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,245 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// Copy mirrors the image src points to into dst without changing its digest.
+// Blobs the destination already has are skipped, blobs within the same registry are mounted instead of uploaded.
+// Manifest lists are copied with all referenced platform manifests.
+func Copy(ctx context.Context, httpClient HttpClient, src Registry, srcRepository Repository, dst Registry, dstRepository Repository, options ...ClientOption) error {
+	o := newClientOptions(options)
+	httpClient = newUserAgentHttpClient(httpClient, o.userAgent, o.logger)
+	source := &v2Client{
+		clientOptions: o,
+		httpClient:    httpClient,
+		registry:      src,
+		tokenCache:    newTokenCache(o.tokenCacheDir, src.tokenCacheUsername(), o.logger),
+	}
+	destination := &v2Client{
+		clientOptions: o,
+		httpClient:    httpClient,
+		registry:      dst,
+		tokenCache:    newTokenCache(o.tokenCacheDir, dst.tokenCacheUsername(), o.logger),
+	}
+	copier := &copier{
+		source:      source,
+		destination: destination,
+		srcName:     srcRepository.Name,
+		dstName:     dstRepository.Name,
+		// mounting only works within one registry and with the same credentials
+		mount: src.BaseUrl() == dst.BaseUrl() && src.Username == dst.Username,
+	}
+	if err := copier.copyManifest(ctx, srcRepository.Tag.String(), dstRepository.Tag.String()); err != nil {
+		return errors.Wrapf(err, "copy %s/%s:%s to %s/%s:%s failed", src.Url, srcRepository.Name, srcRepository.Tag, dst.Url, dstRepository.Name, dstRepository.Tag)
+	}
+	return nil
+}
+
+type copier struct {
+	source      *v2Client
+	destination *v2Client
+	srcName     RepositoryName
+	dstName     RepositoryName
+	mount       bool
+}
+
+// copyManifest copies the blobs or child manifests first, so the destination accepts the manifest.
+func (c *copier) copyManifest(ctx context.Context, srcReference string, dstReference string) error {
+	content, contentType, digest, err := c.source.manifestContent(ctx, c.srcName, srcReference)
+	if err != nil {
+		return errors.Wrapf(err, "get manifest %s failed", srcReference)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return errors.Wrap(err, "decode manifest failed")
+	}
+	mediaType := manifest.MediaType
+	if mediaType == "" {
+		mediaType = contentType
+	}
+	if len(manifest.Manifests) > 0 {
+		for _, descriptor := range manifest.Manifests {
+			if err := c.copyManifest(ctx, descriptor.Digest, descriptor.Digest); err != nil {
+				return err
+			}
+		}
+	} else {
+		blobs := append(append([]ManifestConfig{manifest.Config}, manifest.Layers...), manifest.Blobs...)
+		for _, blob := range blobs {
+			if blob.Digest == "" {
+				continue
+			}
+			if err := c.copyBlob(ctx, blob); err != nil {
+				return errors.Wrapf(err, "copy blob %s failed", blob.Digest)
+			}
+		}
+	}
+	action := PlannedAction{
+		Type:       PlannedActionPutManifest,
+		Repository: c.dstName,
+		Digest:     digest,
+		Size:       int64(len(content)),
+	}
+	if dstReference != digest.String() {
+		action.Tag = TagName(dstReference)
+	}
+	if c.destination.dryRun {
+		c.destination.infof("dry run: would put manifest %s (%s) to %s:%s", digest, mediaType, c.dstName, dstReference)
+		c.destination.planned(c.destination.registry, action, true)
+		return nil
+	}
+	if err := c.destination.putManifest(ctx, c.dstName, dstReference, mediaType, content); err != nil {
+		return err
+	}
+	c.destination.planned(c.destination.registry, action, false)
+	return nil
+}
+
+func (c *copier) copyBlob(ctx context.Context, blob ManifestConfig) error {
+	exists, err := c.destination.blobExists(ctx, c.dstName, blob.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		c.destination.debugf("blob %s already exists in %s", blob.Digest, c.dstName)
+		return nil
+	}
+	action := PlannedAction{
+		Type:       PlannedActionUploadBlob,
+		Repository: c.dstName,
+		Digest:     Digest(blob.Digest),
+		Size:       int64(blob.Size),
+	}
+	if c.destination.dryRun {
+		c.destination.infof("dry run: would upload blob %s (%d bytes) to %s", blob.Digest, blob.Size, c.dstName)
+		if c.mount {
+			action.Type = PlannedActionMountBlob
+			action.From = c.srcName
+		}
+		c.destination.planned(c.destination.registry, action, true)
+		return nil
+	}
+	err = c.uploadBlob(ctx, blob, action)
+	if errors.Cause(err) == errBodyNotReplayable {
+		// the streamed blob can not be resent after a 401, the token of the challenge is cached now
+		c.destination.debugf("upload of blob %s rejected, start again: %v", blob.Digest, err)
+		err = c.uploadBlob(ctx, blob, action)
+	}
+	return err
+}
+
+// uploadBlob mounts the blob or streams it from the source in a monolithic upload.
+func (c *copier) uploadBlob(ctx context.Context, blob ManifestConfig, action PlannedAction) error {
+	query := url.Values{}
+	if c.mount {
+		query.Set("mount", blob.Digest)
+		query.Set("from", c.srcName.Normalize(c.source.registry).String())
+	}
+	// the upload start authenticates with the push scope right before the blob is streamed
+	location, mounted, err := c.destination.startUpload(ctx, c.dstName, query)
+	if err != nil {
+		return err
+	}
+	if mounted {
+		c.destination.debugf("blob %s mounted from %s to %s", blob.Digest, c.srcName, c.dstName)
+		action.Type = PlannedActionMountBlob
+		action.From = c.srcName
+		c.destination.planned(c.destination.registry, action, false)
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodGet, c.source.repositoryUrl(c.srcName, "blobs/"+blob.Digest), nil)
+	if err != nil {
+		return errors.Wrap(err, "build request failed")
+	}
+	resp, err := c.source.doSuccess(ctx, req)
+	if err != nil {
+		return errors.Wrap(err, "get blob failed")
+	}
+	defer resp.Body.Close()
+	values := location.Query()
+	values.Set("digest", blob.Digest)
+	location.RawQuery = values.Encode()
+	// the body streams the source blob, so a 401 returns errBodyNotReplayable instead of resending it
+	put, err := http.NewRequest(http.MethodPut, location.String(), resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "build request failed")
+	}
+	put.ContentLength = resp.ContentLength
+	put.Header.Set("Content-Type", "application/octet-stream")
+	putResp, err := c.destination.doSuccess(ctx, put)
+	if err != nil {
+		return errors.Wrap(err, "upload blob failed")
+	}
+	putResp.Body.Close()
+	c.destination.debugf("blob %s uploaded to %s", blob.Digest, c.dstName)
+	c.destination.planned(c.destination.registry, action, false)
+	return nil
+}
+
+func (c *v2Client) blobExists(ctx context.Context, repositoryName RepositoryName, digest string) (bool, error) {
+	req, err := http.NewRequest(http.MethodHead, c.repositoryUrl(repositoryName, "blobs/"+digest), nil)
+	if err != nil {
+		return false, errors.Wrap(err, "build request failed")
+	}
+	resp, err := c.doSuccess(ctx, req)
+	if errors.Cause(err) == ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "check blob failed")
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// startUpload starts a blob upload and returns its location.
+// If a mount was requested and the registry mounted the blob, no location is returned.
+func (c *v2Client) startUpload(ctx context.Context, repositoryName RepositoryName, query url.Values) (*url.URL, bool, error) {
+	u := c.repositoryUrl(repositoryName, "blobs/uploads/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodPost, u, nil)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "build request failed")
+	}
+	resp, err := c.doSuccess(ctx, req)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "start upload failed")
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusCreated && query.Get("mount") != "" {
+		return nil, true, nil
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, false, errors.New("start upload returned no location")
+	}
+	// the location may be relative to the registry
+	result, err := req.URL.Parse(location)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "parse location %s failed", location)
+	}
+	return result, false, nil
+}
+
+func (c *v2Client) putManifest(ctx context.Context, repositoryName RepositoryName, reference string, mediaType string, content []byte) error {
+	req, err := http.NewRequest(http.MethodPut, c.repositoryUrl(repositoryName, "manifests/"+reference), bytes.NewReader(content))
+	if err != nil {
+		return errors.Wrap(err, "build request failed")
+	}
+	req.Header.Set("Content-Type", mediaType)
+	resp, err := c.doSuccess(ctx, req)
+	if err != nil {
+		return errors.Wrapf(err, "put manifest %s:%s failed", repositoryName, reference)
+	}
+	resp.Body.Close()
+	return nil
+}
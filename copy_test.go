@@ -0,0 +1,262 @@
+package docker_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// memoryRegistry stores blobs and manifests pushed with the v2 upload flow.
+type memoryRegistry struct {
+	mux       sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	requests  []string
+}
+
+func newMemoryRegistry() *memoryRegistry {
+	return &memoryRegistry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+	}
+}
+
+func sha256Digest(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+func (m *memoryRegistry) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.requests = append(m.requests, req.Method+" "+req.URL.Path)
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(path, "/blobs/uploads/"):
+		if req.Method == http.MethodPost {
+			if digest := req.URL.Query().Get("mount"); digest != "" && m.blobs[digest] != nil {
+				resp.WriteHeader(http.StatusCreated)
+				return
+			}
+			resp.Header().Set("Location", "/v2/"+path+"upload-1?state=abc")
+			resp.WriteHeader(http.StatusAccepted)
+			return
+		}
+		content, _ := ioutil.ReadAll(req.Body)
+		if req.URL.Query().Get("state") != "abc" || sha256Digest(content) != req.URL.Query().Get("digest") {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.blobs[sha256Digest(content)] = content
+		resp.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/blobs/"):
+		content, ok := m.blobs[path[strings.LastIndex(path, "/")+1:]]
+		if !ok {
+			resp.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if req.Method == http.MethodGet {
+			resp.Write(content)
+		}
+	case strings.Contains(path, "/manifests/"):
+		if req.Method == http.MethodPut {
+			content, _ := ioutil.ReadAll(req.Body)
+			m.manifests[path] = content
+			m.manifests[path[:strings.LastIndex(path, "/")+1]+sha256Digest(content)] = content
+			resp.WriteHeader(http.StatusCreated)
+			return
+		}
+		content, ok := m.manifests[path]
+		if !ok {
+			resp.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resp.Header().Set("Content-Type", docker.MediaTypeDockerManifest)
+		resp.Write(content)
+	default:
+		resp.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (m *memoryRegistry) addImage(repositoryName string, tag string, blobs ...string) []byte {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	var layers []string
+	for _, blob := range blobs {
+		m.blobs[sha256Digest([]byte(blob))] = []byte(blob)
+		layers = append(layers, fmt.Sprintf(`{"size":%d,"digest":"%s"}`, len(blob), sha256Digest([]byte(blob))))
+	}
+	content := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","config":%s,"layers":[%s]}`, docker.MediaTypeDockerManifest, layers[0], strings.Join(layers[1:], ",")))
+	m.manifests[repositoryName+"/manifests/"+tag] = content
+	return content
+}
+
+var _ = Describe("Copy", func() {
+	var src, dst *memoryRegistry
+	var srcServer, dstServer *httptest.Server
+	BeforeEach(func() {
+		src = newMemoryRegistry()
+		dst = newMemoryRegistry()
+		srcServer = httptest.NewServer(src)
+		dstServer = httptest.NewServer(dst)
+	})
+	AfterEach(func() {
+		srcServer.Close()
+		dstServer.Close()
+	})
+	It("uploads blobs and manifest", func() {
+		content := src.addImage("team/app", "1.0.0", "config", "layer-1", "layer-2")
+		err := docker.Copy(
+			context.Background(),
+			docker.NewHttpClient(http.DefaultClient),
+			docker.Registry{Url: srcServer.URL}, docker.Repository{Name: "team/app", Tag: "1.0.0"},
+			docker.Registry{Url: dstServer.URL}, docker.Repository{Name: "mirror/app", Tag: "latest"},
+		)
+		Expect(err).To(BeNil())
+		Expect(dst.blobs).To(HaveLen(3))
+		Expect(dst.blobs[sha256Digest([]byte("layer-1"))]).To(Equal([]byte("layer-1")))
+		Expect(dst.manifests["mirror/app/manifests/latest"]).To(Equal(content))
+	})
+	It("skips blobs the destination has", func() {
+		src.addImage("team/app", "1.0.0", "config", "layer-1")
+		dst.addImage("other/app", "1.0.0", "layer-1", "layer-1")
+		err := docker.Copy(
+			context.Background(),
+			docker.NewHttpClient(http.DefaultClient),
+			docker.Registry{Url: srcServer.URL}, docker.Repository{Name: "team/app", Tag: "1.0.0"},
+			docker.Registry{Url: dstServer.URL}, docker.Repository{Name: "mirror/app", Tag: "1.0.0"},
+		)
+		Expect(err).To(BeNil())
+		Expect(dst.requests).To(ContainElement("PUT /v2/mirror/app/blobs/uploads/upload-1"))
+		Expect(src.requests).NotTo(ContainElement("GET /v2/team/app/blobs/" + sha256Digest([]byte("layer-1"))))
+	})
+	It("mounts blobs within the same registry", func() {
+		src.addImage("team/app", "1.0.0", "config", "layer-1")
+		err := docker.Copy(
+			context.Background(),
+			docker.NewHttpClient(http.DefaultClient),
+			docker.Registry{Url: srcServer.URL}, docker.Repository{Name: "team/app", Tag: "1.0.0"},
+			docker.Registry{Url: srcServer.URL}, docker.Repository{Name: "team/copy", Tag: "1.0.0"},
+		)
+		Expect(err).To(BeNil())
+		Expect(src.requests).NotTo(ContainElement(ContainSubstring("PUT /v2/team/copy/blobs/")))
+		Expect(src.manifests).To(HaveKey("team/copy/manifests/1.0.0"))
+	})
+	Context("with bearer auth", func() {
+		var tokenScopes [][]string
+		var rejectMultipleScopes bool
+		var rejectUploads int
+		var server *httptest.Server
+		BeforeEach(func() {
+			tokenScopes = nil
+			rejectMultipleScopes = false
+			rejectUploads = 0
+			server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/token" {
+					scopes := req.URL.Query()["scope"]
+					tokenScopes = append(tokenScopes, scopes)
+					if rejectMultipleScopes && len(scopes) > 1 {
+						resp.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					fmt.Fprintf(resp, `{"token":"%s"}`, strings.Join(scopes, "|"))
+					return
+				}
+				token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+				if token == "" {
+					resp.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, server.URL))
+					resp.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				// like an expired token the upload is rejected with a new challenge after the body was read
+				if req.Method == http.MethodPut && strings.Contains(req.URL.Path, "/blobs/uploads/") && rejectUploads > 0 {
+					rejectUploads--
+					ioutil.ReadAll(req.Body)
+					resp.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:team/copy:push"`, server.URL))
+					resp.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				if strings.HasPrefix(req.URL.Path, "/v2/team/app/") {
+					src.ServeHTTP(resp, req)
+					return
+				}
+				// like a real registry the blob is only mounted with pull access to the source
+				if digest := req.URL.Query().Get("mount"); digest != "" {
+					if strings.Contains(token, "repository:team/app:pull") {
+						dst.mux.Lock()
+						dst.blobs[digest] = src.blobs[digest]
+						dst.mux.Unlock()
+						resp.WriteHeader(http.StatusCreated)
+						return
+					}
+					req.URL.RawQuery = ""
+				}
+				dst.ServeHTTP(resp, req)
+			}))
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		copy := func() error {
+			return docker.Copy(
+				context.Background(),
+				docker.NewHttpClient(http.DefaultClient),
+				docker.Registry{Url: server.URL}, docker.Repository{Name: "team/app", Tag: "1.0.0"},
+				docker.Registry{Url: server.URL}, docker.Repository{Name: "team/copy", Tag: "1.0.0"},
+			)
+		}
+		It("requests one token for destination and source of a mount", func() {
+			src.addImage("team/app", "1.0.0", "config", "layer-1")
+			Expect(copy()).To(BeNil())
+			Expect(tokenScopes).To(ContainElement([]string{"repository:team/copy:pull,push", "repository:team/app:pull"}))
+			Expect(dst.requests).NotTo(ContainElement(ContainSubstring("PUT /v2/team/copy/blobs/")))
+		})
+		It("falls back to a single scope token and uploads", func() {
+			rejectMultipleScopes = true
+			src.addImage("team/app", "1.0.0", "config", "layer-1")
+			Expect(copy()).To(BeNil())
+			Expect(tokenScopes).To(ContainElement([]string{"repository:team/copy:pull,push"}))
+			Expect(dst.requests).To(ContainElement("PUT /v2/team/copy/blobs/uploads/upload-1"))
+			Expect(dst.manifests).To(HaveKey("team/copy/manifests/1.0.0"))
+		})
+		It("starts the upload again if the streamed blob is rejected", func() {
+			rejectMultipleScopes = true
+			rejectUploads = 1
+			src.addImage("team/app", "1.0.0", "config", "layer-1")
+			Expect(copy()).To(BeNil())
+			Expect(tokenScopes).To(ContainElement([]string{"repository:team/copy:push"}))
+			Expect(dst.blobs[sha256Digest([]byte("layer-1"))]).To(Equal([]byte("layer-1")))
+			Expect(dst.manifests).To(HaveKey("team/copy/manifests/1.0.0"))
+		})
+		It("returns an error if the streamed blob is rejected again", func() {
+			rejectMultipleScopes = true
+			rejectUploads = 2
+			src.addImage("team/app", "1.0.0", "config", "layer-1")
+			err := copy()
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("request body can not be sent again"))
+			Expect(dst.manifests).To(BeEmpty())
+		})
+	})
+	It("puts nothing on dry run", func() {
+		src.addImage("team/app", "1.0.0", "config", "layer-1")
+		err := docker.Copy(
+			context.Background(),
+			docker.NewHttpClient(http.DefaultClient),
+			docker.Registry{Url: srcServer.URL}, docker.Repository{Name: "team/app", Tag: "1.0.0"},
+			docker.Registry{Url: dstServer.URL}, docker.Repository{Name: "mirror/app", Tag: "1.0.0"},
+			docker.WithDryRun(true),
+		)
+		Expect(err).To(BeNil())
+		Expect(dst.blobs).To(BeEmpty())
+		Expect(dst.manifests).To(BeEmpty())
+	})
+})
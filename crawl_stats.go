@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// CrawlStats summarizes the cost of a run against a registry.
+type CrawlStats struct {
+	Repositories int64
+	Tags         int64
+	Requests     int64
+	RateLimited  int64
+	Retries      int64
+	Duration     time.Duration
+
+	started time.Time
+}
+
+func NewCrawlStats() *CrawlStats {
+	return &CrawlStats{
+		started: time.Now(),
+	}
+}
+
+func (c *CrawlStats) AddRepositories(count int64) {
+	atomic.AddInt64(&c.Repositories, count)
+}
+
+func (c *CrawlStats) AddTags(count int64) {
+	atomic.AddInt64(&c.Tags, count)
+}
+
+func (c *CrawlStats) addResponse(statusCode int) {
+	atomic.AddInt64(&c.Requests, 1)
+	if statusCode == http.StatusTooManyRequests {
+		atomic.AddInt64(&c.RateLimited, 1)
+	}
+}
+
+// Snapshot returns a copy of the current stats with the duration since creation.
+func (c *CrawlStats) Snapshot() CrawlStats {
+	return CrawlStats{
+		Repositories: atomic.LoadInt64(&c.Repositories),
+		Tags:         atomic.LoadInt64(&c.Tags),
+		Requests:     atomic.LoadInt64(&c.Requests),
+		RateLimited:  atomic.LoadInt64(&c.RateLimited),
+		Retries:      atomic.LoadInt64(&c.Retries),
+		Duration:     time.Since(c.started),
+		started:      c.started,
+	}
+}
+
+func (c CrawlStats) String() string {
+	return fmt.Sprintf("repositories: %d tags: %d requests: %d rate limited: %d retries: %d duration: %v", c.Repositories, c.Tags, c.Requests, c.RateLimited, c.Retries, c.Duration)
+}
+
+// crawlStatsRoundTripper counts all requests send to the registry.
+type crawlStatsRoundTripper struct {
+	roundTripper http.RoundTripper
+	crawlStats   *CrawlStats
+}
+
+func (c *crawlStatsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := c.roundTripper.RoundTrip(req)
+	if err != nil {
+		atomic.AddInt64(&c.crawlStats.Requests, 1)
+		return nil, err
+	}
+	c.crawlStats.addResponse(resp.StatusCode)
+	return resp, nil
+}
@@ -0,0 +1,39 @@
+package docker_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CrawlStats", func() {
+	It("counts requests and rate limited responses", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/limited" {
+				resp.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			resp.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		crawlStats := docker.NewCrawlStats()
+		client, err := docker.NewHttpClientBuilder().WithCrawlStats(crawlStats).Build()
+		Expect(err).To(BeNil())
+		for _, path := range []string{"/", "/limited", "/"} {
+			resp, err := client.Get(server.URL + path)
+			Expect(err).To(BeNil())
+			resp.Body.Close()
+		}
+		crawlStats.AddRepositories(2)
+		crawlStats.AddTags(5)
+		snapshot := crawlStats.Snapshot()
+		Expect(snapshot.Requests).To(Equal(int64(3)))
+		Expect(snapshot.RateLimited).To(Equal(int64(1)))
+		Expect(snapshot.Repositories).To(Equal(int64(2)))
+		Expect(snapshot.Tags).To(Equal(int64(5)))
+		Expect(snapshot.Duration).To(BeNumerically(">", 0))
+	})
+})
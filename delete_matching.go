@@ -0,0 +1,72 @@
+package docker
+
+import (
+	"context"
+	"path"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// TagMatcher selects tags, e.g. a TagFilter, TagPatterns or the result of NewTagGlob and NewTagRegexp.
+type TagMatcher interface {
+	Match(tag TagName) bool
+}
+
+// NewTagGlob returns a matcher for a shell glob like pr-*.
+func NewTagGlob(pattern string) (TagMatcher, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, errors.Wrapf(err, "invalid tag pattern %s", pattern)
+	}
+	return TagPatterns{pattern}, nil
+}
+
+// NewTagRegexp returns a matcher for a regular expression like ^pr-[0-9]+$.
+func NewTagRegexp(pattern string) (TagMatcher, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid tag regexp %s", pattern)
+	}
+	return tagMatcherRegexp{re}, nil
+}
+
+type tagMatcherRegexp struct {
+	*regexp.Regexp
+}
+
+func (t tagMatcherRegexp) Match(tag TagName) bool {
+	return t.MatchString(tag.String())
+}
+
+// DeleteMatching deletes all tags of the repository selected by the matcher.
+// A manifest shared with a not matching tag is not deleted, because that would remove the other tag too.
+// The deleted tags are returned, errors of single tags are combined into the returned error.
+func (c *v2Client) DeleteMatching(ctx context.Context, repositoryName RepositoryName, matcher TagMatcher, dryRun bool) ([]TagName, error) {
+	dryRun = dryRun || c.dryRun
+	if !dryRun {
+		if err := c.checkDeleteSupported(ctx); err != nil {
+			return nil, err
+		}
+	}
+	tags, err := c.listAllTags(ctx, repositoryName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list tags of %s failed", repositoryName)
+	}
+	var kept, candidates []TagName
+	for _, tag := range tags {
+		if matcher.Match(tag) {
+			candidates = append(candidates, tag)
+		} else {
+			kept = append(kept, tag)
+		}
+	}
+	if len(candidates) == 0 {
+		c.debugf("no tag of %s matches", repositoryName)
+		return []TagName{}, nil
+	}
+	deleted, errs, err := c.deleteTagsKeeping(ctx, repositoryName, kept, candidates, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	return deleted, CombineErrors(errs)
+}
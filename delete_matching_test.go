@@ -0,0 +1,56 @@
+package docker_test
+
+import (
+	"context"
+
+	"github.com/bborbe/docker-utils"
+	"github.com/bborbe/docker-utils/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DeleteMatching", func() {
+	var registry *fake.Registry
+	BeforeEach(func() {
+		registry = fake.NewRegistry(map[docker.RepositoryName][]docker.TagName{
+			"team/app": {"1.0.0", "pr-1", "pr-12", "pr-x", "latest"},
+		})
+	})
+	It("deletes tags matching glob", func() {
+		matcher, err := docker.NewTagGlob("pr-*")
+		Expect(err).To(BeNil())
+		deleted, err := registry.NewV2Client().DeleteMatching(context.Background(), "team/app", matcher, false)
+		Expect(err).To(BeNil())
+		Expect(deleted).To(Equal([]docker.TagName{"pr-1", "pr-12", "pr-x"}))
+		Expect(registry.Repositories()["team/app"]).To(Equal([]docker.TagName{"1.0.0", "latest"}))
+	})
+	It("deletes tags matching regexp", func() {
+		matcher, err := docker.NewTagRegexp(`^pr-[0-9]+$`)
+		Expect(err).To(BeNil())
+		deleted, err := registry.NewV2Client().DeleteMatching(context.Background(), "team/app", matcher, false)
+		Expect(err).To(BeNil())
+		Expect(deleted).To(Equal([]docker.TagName{"pr-1", "pr-12"}))
+		Expect(registry.Repositories()["team/app"]).To(Equal([]docker.TagName{"1.0.0", "latest", "pr-x"}))
+	})
+	It("only returns tags on dry run", func() {
+		matcher, err := docker.NewTagGlob("pr-*")
+		Expect(err).To(BeNil())
+		deleted, err := registry.NewV2Client().DeleteMatching(context.Background(), "team/app", matcher, true)
+		Expect(err).To(BeNil())
+		Expect(deleted).To(HaveLen(3))
+		Expect(registry.Repositories()["team/app"]).To(HaveLen(5))
+	})
+	It("returns empty list without match", func() {
+		matcher, err := docker.NewTagGlob("release-*")
+		Expect(err).To(BeNil())
+		deleted, err := registry.NewV2Client().DeleteMatching(context.Background(), "team/app", matcher, false)
+		Expect(err).To(BeNil())
+		Expect(deleted).To(BeEmpty())
+	})
+	It("rejects invalid patterns", func() {
+		_, err := docker.NewTagGlob("[")
+		Expect(err).NotTo(BeNil())
+		_, err = docker.NewTagRegexp("(")
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	digestAlgorithmRegexp = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*$`)
+	digestEncodedRegexp   = regexp.MustCompile(`^[a-zA-Z0-9=_-]+$`)
+	sha256EncodedRegexp   = regexp.MustCompile(`^[a-f0-9]{64}$`)
+)
+
+type Digest string
+
+func (d Digest) String() string {
+	return string(d)
+}
+
+// Validate checks the algorithm:hex shape, e.g. sha256:0123...
+func (d Digest) Validate() error {
+	parts := strings.SplitN(d.String(), ":", 2)
+	if len(parts) != 2 {
+		return errors.Errorf("digest '%s' is not of form algorithm:hex", d)
+	}
+	if !digestAlgorithmRegexp.MatchString(parts[0]) {
+		return errors.Errorf("digest '%s' has invalid algorithm", d)
+	}
+	if !digestEncodedRegexp.MatchString(parts[1]) {
+		return errors.Errorf("digest '%s' has invalid encoding", d)
+	}
+	if parts[0] == "sha256" && !sha256EncodedRegexp.MatchString(parts[1]) {
+		return errors.Errorf("digest '%s' is not a valid sha256", d)
+	}
+	return nil
+}
+
+// Digest resolves the tag to the content digest of its manifest using a HEAD request.
+// Registries not returning the Docker-Content-Digest header on HEAD are asked with GET.
+func (c *v2Client) Digest(ctx context.Context, repositoryName RepositoryName, tag TagName) (Digest, error) {
+	digest, err := c.digest(ctx, http.MethodHead, repositoryName, tag)
+	if err != nil {
+		return "", err
+	}
+	if digest == "" {
+		c.debugf("no digest header returned on head, fallback to get")
+		digest, err = c.digest(ctx, http.MethodGet, repositoryName, tag)
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := digest.Validate(); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+func (c *v2Client) digest(ctx context.Context, method string, repositoryName RepositoryName, tag TagName) (Digest, error) {
+	url := c.repositoryUrl(repositoryName, "manifests/"+tag.String())
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "build request failed")
+	}
+	req.Header.Add("Accept", acceptManifestMediaTypes())
+	resp, err := c.doSuccess(ctx, req)
+	if err != nil {
+		return "", errors.Wrap(err, "perform http request failed")
+	}
+	defer resp.Body.Close()
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return Digest(digest), nil
+	}
+	if method == http.MethodHead {
+		return "", nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, resp.Body); err != nil {
+		return "", errors.Wrap(err, "read manifest failed")
+	}
+	return Digest("sha256:" + hex.EncodeToString(hash.Sum(nil))), nil
+}
@@ -0,0 +1,25 @@
+package docker_test
+
+import (
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Digest", func() {
+	It("accepts sha256 digest", func() {
+		Expect(docker.Digest(testDigest).Validate()).To(BeNil())
+	})
+	It("accepts other algorithms", func() {
+		Expect(docker.Digest("sha512+b64:abc_-=").Validate()).To(BeNil())
+	})
+	It("rejects missing algorithm", func() {
+		Expect(docker.Digest("2c26b46b").Validate()).NotTo(BeNil())
+	})
+	It("rejects short sha256", func() {
+		Expect(docker.Digest("sha256:abc").Validate()).NotTo(BeNil())
+	})
+	It("rejects uppercase algorithm", func() {
+		Expect(docker.Digest("SHA256:abc").Validate()).NotTo(BeNil())
+	})
+})
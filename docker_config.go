@@ -0,0 +1,185 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DockerHubServerURL is the key docker login uses for Docker Hub credentials.
+const DockerHubServerURL = "https://index.docker.io/v1/"
+
+// DockerConfigPath returns $DOCKER_CONFIG/config.json like docker does
+// and falls back to ~/.docker/config.json if DOCKER_CONFIG is unset.
+func DockerConfigPath() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "get home dir failed")
+	}
+	return filepath.Join(home, ".docker", "config.json"), nil
+}
+
+// DockerConfig is the subset of ~/.docker/config.json needed to find registry credentials.
+type DockerConfig struct {
+	Auths       map[string]DockerConfigAuth `json:"auths"`
+	CredsStore  string                      `json:"credsStore,omitempty"`
+	CredHelpers map[string]string           `json:"credHelpers,omitempty"`
+}
+
+type DockerConfigAuth struct {
+	Auth     string `json:"auth,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+func ReadDockerConfig(path string) (*DockerConfig, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read docker config failed")
+	}
+	var config DockerConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, errors.Wrap(err, "parse docker config failed")
+	}
+	return &config, nil
+}
+
+// ReadCredentialsFromDockerConfig returns username and password stored for the given domain in the docker config at path.
+func ReadCredentialsFromDockerConfig(path string, domain string) (string, string, error) {
+	config, err := ReadDockerConfig(path)
+	if err != nil {
+		return "", "", err
+	}
+	return config.Credentials(domain)
+}
+
+// Credentials uses the credential helper configured for the domain in credHelpers or credsStore
+// and falls back to the inline auth if no helper is configured or the helper has no credentials for the domain.
+func (d DockerConfig) Credentials(domain string) (string, string, error) {
+	serverURL := dockerConfigServerURL(domain)
+	if helper := d.credentialHelper(serverURL); helper != "" {
+		username, password, err := credentialsFromHelper(helper, serverURL)
+		if errors.Cause(err) != ErrNotFound {
+			return username, password, err
+		}
+		// like docker, the inline auth written before the helper was configured is still used
+		if username, password, inlineErr := d.inlineCredentials(serverURL); inlineErr == nil && username != "" {
+			return username, password, nil
+		}
+		return "", "", err
+	}
+	username, password, err := d.inlineCredentials(serverURL)
+	if errors.Cause(err) == ErrNotFound {
+		return "", "", errors.Wrapf(ErrNotFound, "domain %s not found in docker config", domain)
+	}
+	return username, password, err
+}
+
+func (d DockerConfig) inlineCredentials(serverURL string) (string, string, error) {
+	for key, auth := range d.Auths {
+		if dockerConfigServerURL(key) != serverURL {
+			continue
+		}
+		return auth.credentials()
+	}
+	return "", "", ErrNotFound
+}
+
+func (d DockerConfig) credentialHelper(serverURL string) string {
+	for key, helper := range d.CredHelpers {
+		if dockerConfigServerURL(key) == serverURL {
+			return helper
+		}
+	}
+	return d.CredsStore
+}
+
+func (a DockerConfigAuth) credentials() (string, string, error) {
+	if a.Auth == "" {
+		return a.Username, a.Password, nil
+	}
+	content, err := base64.StdEncoding.DecodeString(a.Auth)
+	if err != nil {
+		return "", "", errors.Wrap(err, "decode auth failed")
+	}
+	parts := strings.SplitN(string(content), ":", 2)
+	if len(parts) != 2 {
+		return "", "", errors.New("auth is not in format username:password")
+	}
+	return parts[0], parts[1], nil
+}
+
+// credentialsFromHelper runs docker-credential-<helper> get with the server url on stdin.
+func credentialsFromHelper(helper string, serverURL string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if execErr, ok := err.(*exec.Error); ok && execErr.Err == exec.ErrNotFound {
+			return "", "", errors.Wrapf(err, "credential helper docker-credential-%s configured in docker config is not installed", helper)
+		}
+		message := strings.TrimSpace(stdout.String() + stderr.String())
+		if strings.Contains(message, "credentials not found") {
+			return "", "", errors.Wrapf(ErrNotFound, "credentials for %s not found in docker-credential-%s", serverURL, helper)
+		}
+		return "", "", errors.Wrapf(err, "docker-credential-%s get failed: %s", helper, message)
+	}
+	var data struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &data); err != nil {
+		return "", "", errors.Wrapf(err, "parse output of docker-credential-%s failed", helper)
+	}
+	return data.Username, data.Secret, nil
+}
+
+// dockerConfigServerURL normalizes keys like https://host/v1/ to the host,
+// all Docker Hub hosts map to DockerHubServerURL.
+func dockerConfigServerURL(domain string) string {
+	host := domain
+	if strings.Contains(host, "://") {
+		if u, err := url.Parse(host); err == nil {
+			host = u.Host
+		}
+	}
+	host = strings.SplitN(host, "/", 2)[0]
+	switch host {
+	case DockerHubDomain, "index.docker.io", "registry-1.docker.io":
+		return DockerHubServerURL
+	}
+	return host
+}
+
+// CredentialsFromDockerConfig sets username and password for the registry url from the docker config at path.
+func (r *Registry) CredentialsFromDockerConfig(path string) error {
+	username, password, err := ReadCredentialsFromDockerConfig(path, r.Url)
+	if err != nil {
+		return err
+	}
+	r.Username = username
+	r.Password = password
+	return nil
+}
+
+// CredentialsFromDefaultDockerConfig sets username and password for the registry url from the docker config at DockerConfigPath.
+func (r *Registry) CredentialsFromDefaultDockerConfig() error {
+	path, err := DockerConfigPath()
+	if err != nil {
+		return err
+	}
+	return r.CredentialsFromDockerConfig(path)
+}
@@ -0,0 +1,145 @@
+package docker_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DockerConfig", func() {
+	var dir string
+	var path string
+	var config string
+	var username, password string
+	var err error
+	var domain string
+	var oldPath string
+	BeforeEach(func() {
+		oldPath = os.Getenv("PATH")
+		dir, err = ioutil.TempDir("", "docker-utils")
+		Expect(err).To(BeNil())
+		path = filepath.Join(dir, "config.json")
+		domain = "registry.example.com"
+		helper := "#!/bin/sh\nread url\nif [ \"$url\" = \"registry.example.com\" ]; then echo '{\"ServerURL\":\"registry.example.com\",\"Username\":\"helper-user\",\"Secret\":\"helper-secret\"}'; exit 0; fi\necho 'credentials not found in native keychain'\nexit 1\n"
+		Expect(ioutil.WriteFile(filepath.Join(dir, "docker-credential-test"), []byte(helper), 0755)).To(BeNil())
+		os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	})
+	AfterEach(func() {
+		os.Setenv("PATH", oldPath)
+		os.RemoveAll(dir)
+	})
+	JustBeforeEach(func() {
+		Expect(ioutil.WriteFile(path, []byte(config), 0600)).To(BeNil())
+		username, password, err = docker.ReadCredentialsFromDockerConfig(path, domain)
+	})
+	Context("with inline auth", func() {
+		BeforeEach(func() {
+			config = `{"auths":{"https://registry.example.com/v1/":{"auth":"dXNlcjpzZWNyZXQ="}}}`
+		})
+		It("returns decoded credentials", func() {
+			Expect(err).To(BeNil())
+			Expect(username).To(Equal("user"))
+			Expect(password).To(Equal("secret"))
+		})
+	})
+	Context("with docker hub", func() {
+		BeforeEach(func() {
+			domain = "https://registry-1.docker.io"
+			config = `{"auths":{"https://index.docker.io/v1/":{"auth":"dXNlcjpzZWNyZXQ="}}}`
+		})
+		It("returns credentials of index.docker.io", func() {
+			Expect(err).To(BeNil())
+			Expect(username).To(Equal("user"))
+		})
+	})
+	Context("with credsStore", func() {
+		BeforeEach(func() {
+			config = `{"auths":{"registry.example.com":{}},"credsStore":"test"}`
+		})
+		It("returns credentials of helper", func() {
+			Expect(err).To(BeNil())
+			Expect(username).To(Equal("helper-user"))
+			Expect(password).To(Equal("helper-secret"))
+		})
+	})
+	Context("with credHelpers", func() {
+		BeforeEach(func() {
+			config = `{"credsStore":"missing","credHelpers":{"registry.example.com":"test"}}`
+		})
+		It("prefers registry specific helper", func() {
+			Expect(err).To(BeNil())
+			Expect(username).To(Equal("helper-user"))
+		})
+	})
+	Context("with helper without credentials", func() {
+		BeforeEach(func() {
+			domain = "other.example.com"
+			config = `{"credsStore":"test"}`
+		})
+		It("returns not found", func() {
+			Expect(docker.ExitCode(err)).To(Equal(docker.ExitCodeNotFound))
+		})
+	})
+	Context("with helper without credentials and inline auth", func() {
+		BeforeEach(func() {
+			domain = "other.example.com"
+			config = `{"auths":{"other.example.com":{"auth":"dXNlcjpzZWNyZXQ="}},"credsStore":"test"}`
+		})
+		It("returns inline credentials", func() {
+			Expect(err).To(BeNil())
+			Expect(username).To(Equal("user"))
+			Expect(password).To(Equal("secret"))
+		})
+	})
+	Context("with helper not installed", func() {
+		BeforeEach(func() {
+			config = `{"credsStore":"missing"}`
+		})
+		It("names the missing helper", func() {
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("docker-credential-missing"))
+			Expect(err.Error()).To(ContainSubstring("not installed"))
+		})
+	})
+	Context("with unknown domain", func() {
+		BeforeEach(func() {
+			config = `{"auths":{}}`
+		})
+		It("returns not found", func() {
+			Expect(docker.ExitCode(err)).To(Equal(docker.ExitCodeNotFound))
+		})
+	})
+	Context("DockerConfigPath", func() {
+		var oldDockerConfig string
+		BeforeEach(func() {
+			config = `{"auths":{"registry.example.com":{"auth":"dXNlcjpzZWNyZXQ="}}}`
+			oldDockerConfig = os.Getenv("DOCKER_CONFIG")
+		})
+		AfterEach(func() {
+			os.Setenv("DOCKER_CONFIG", oldDockerConfig)
+		})
+		It("uses DOCKER_CONFIG", func() {
+			os.Setenv("DOCKER_CONFIG", dir)
+			path, err := docker.DockerConfigPath()
+			Expect(err).To(BeNil())
+			Expect(path).To(Equal(filepath.Join(dir, "config.json")))
+		})
+		It("falls back to home dir", func() {
+			os.Unsetenv("DOCKER_CONFIG")
+			path, err := docker.DockerConfigPath()
+			Expect(err).To(BeNil())
+			Expect(path).To(HaveSuffix(filepath.Join(".docker", "config.json")))
+		})
+		It("reads credentials of registry from DOCKER_CONFIG", func() {
+			os.Setenv("DOCKER_CONFIG", dir)
+			registry := docker.Registry{Url: "https://registry.example.com"}
+			Expect(registry.CredentialsFromDefaultDockerConfig()).To(BeNil())
+			Expect(registry.Username).To(Equal("user"))
+			Expect(registry.Password).To(Equal("secret"))
+		})
+	})
+})
@@ -0,0 +1,75 @@
+package docker
+
+import (
+	"bytes"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ECRUsername is the fixed username of ECR authorization tokens.
+const ECRUsername = "AWS"
+
+// ECRTokenValidity is how long an ECR authorization token is valid.
+const ECRTokenValidity = 12 * time.Hour
+
+var ecrHostRegexp = regexp.MustCompile(`^[0-9]{12}\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// ECRRegion returns the region of an ECR registry url like https://123456789012.dkr.ecr.eu-central-1.amazonaws.com.
+func ECRRegion(registryUrl string) (string, bool) {
+	host := registryUrl
+	if strings.Contains(host, "://") {
+		if u, err := url.Parse(host); err == nil {
+			host = u.Host
+		}
+	}
+	host = strings.SplitN(host, "/", 2)[0]
+	matches := ecrHostRegexp.FindStringSubmatch(host)
+	if matches == nil {
+		return "", false
+	}
+	return matches[1], true
+}
+
+// IsECR returns true if the registry is hosted on Amazon ECR.
+func (r Registry) IsECR() bool {
+	_, ok := ECRRegion(r.Url)
+	return ok
+}
+
+// CredentialsFromECR sets the short-lived ECR authorization token as password.
+// The token is fetched with `aws ecr get-login-password`, so the ambient AWS credential chain is used.
+// PasswordExpires is set, so a V2Client renews the token before it expires.
+func (r *Registry) CredentialsFromECR() error {
+	region, ok := ECRRegion(r.Url)
+	if !ok {
+		return errors.Errorf("registry %s is not an ecr registry", r.Url)
+	}
+	password, err := ecrLoginPassword(region)
+	if err != nil {
+		return err
+	}
+	r.Username = ECRUsername
+	r.Password = password
+	r.PasswordExpires = time.Now().Add(ECRTokenValidity)
+	return nil
+}
+
+func ecrLoginPassword(region string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("aws", "ecr", "get-login-password", "--region", region)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(ErrUnauthorized, "aws ecr get-login-password failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	password := strings.TrimSpace(stdout.String())
+	if password == "" {
+		return "", errors.Wrap(ErrUnauthorized, "aws ecr get-login-password returned empty token")
+	}
+	return password, nil
+}
@@ -0,0 +1,89 @@
+package docker_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ECR", func() {
+	It("detects region of ecr registry", func() {
+		region, ok := docker.ECRRegion("https://123456789012.dkr.ecr.eu-central-1.amazonaws.com")
+		Expect(ok).To(BeTrue())
+		Expect(region).To(Equal("eu-central-1"))
+	})
+	It("detects region of ecr host without scheme", func() {
+		region, ok := docker.ECRRegion("123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn")
+		Expect(ok).To(BeTrue())
+		Expect(region).To(Equal("cn-north-1"))
+	})
+	It("ignores other registries", func() {
+		_, ok := docker.ECRRegion("https://registry-1.docker.io")
+		Expect(ok).To(BeFalse())
+	})
+	Context("CredentialsFromECR", func() {
+		var dir string
+		var oldPath string
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "docker-utils")
+			Expect(err).To(BeNil())
+			script := "#!/bin/sh\n[ \"$4\" = \"eu-west-1\" ] || exit 1\necho token\n"
+			Expect(ioutil.WriteFile(filepath.Join(dir, "aws"), []byte(script), 0755)).To(BeNil())
+			oldPath = os.Getenv("PATH")
+			os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+		})
+		AfterEach(func() {
+			os.Setenv("PATH", oldPath)
+			os.RemoveAll(dir)
+		})
+		It("sets token as password", func() {
+			registry := docker.Registry{Url: "https://123456789012.dkr.ecr.eu-west-1.amazonaws.com"}
+			Expect(registry.CredentialsFromECR()).To(BeNil())
+			Expect(registry.Username).To(Equal(docker.ECRUsername))
+			Expect(registry.Password).To(Equal("token"))
+		})
+		It("sets password expiry", func() {
+			registry := docker.Registry{Url: "https://123456789012.dkr.ecr.eu-west-1.amazonaws.com"}
+			Expect(registry.CredentialsFromECR()).To(BeNil())
+			Expect(registry.PasswordExpires).To(BeTemporally("~", time.Now().Add(docker.ECRTokenValidity), time.Minute))
+		})
+		Context("with client", func() {
+			var passwords []string
+			var client docker.V2Client
+			BeforeEach(func() {
+				passwords = nil
+			})
+			ping := func(expires time.Time) {
+				client = docker.NewV2Client(
+					docker.NewHttpClient(&http.Client{Transport: handlerTransport{http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+						_, password, _ := req.BasicAuth()
+						passwords = append(passwords, password)
+					})}}),
+					docker.Registry{Url: "https://123456789012.dkr.ecr.eu-west-1.amazonaws.com", Username: docker.ECRUsername, Password: "old", PasswordExpires: expires},
+				)
+				Expect(client.Ping(context.Background())).To(BeNil())
+			}
+			It("renews token before it expires", func() {
+				ping(time.Now().Add(time.Minute))
+				Expect(passwords).To(Equal([]string{"token"}))
+			})
+			It("keeps valid token", func() {
+				ping(time.Now().Add(time.Hour))
+				Expect(passwords).To(Equal([]string{"old"}))
+			})
+		})
+		It("returns unauthorized if token fails", func() {
+			registry := docker.Registry{Url: "https://123456789012.dkr.ecr.us-east-1.amazonaws.com"}
+			err := registry.CredentialsFromECR()
+			Expect(docker.ExitCode(err)).To(Equal(docker.ExitCodeUnauthorized))
+		})
+	})
+})
@@ -0,0 +1,110 @@
+package docker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrNotFound             = errors.New("not found")
+	ErrUnavailable          = errors.New("unavailable")
+	ErrUsage                = errors.New("usage error")
+	ErrUnexpectedStatusCode = errors.New("unexpected status code")
+	ErrDeleteNotSupported   = errors.New("delete not supported on this registry")
+	ErrNotV2Registry        = errors.New("not a v2 registry")
+	// ErrManifestUnknown matches registry errors with code MANIFEST_UNKNOWN, their cause stays ErrNotFound.
+	ErrManifestUnknown = errors.New("manifest unknown")
+	// ErrTagNotExists is returned by commands reporting a missing tag only by exit code 1, RunCommand does not log it.
+	ErrTagNotExists = errors.New("tag does not exist")
+)
+
+// Exit codes returned by the commands, see README.md.
+const (
+	ExitCodeFailure      = 1
+	ExitCodeUnauthorized = 2
+	ExitCodeNotFound     = 3
+	ExitCodeUnavailable  = 4
+	ExitCodeUsage        = 64
+)
+
+// Errors combines the errors of multiple operations.
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// CombineErrors returns nil for no errors and Errors otherwise.
+func CombineErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return Errors(errs)
+}
+
+func errorForStatusCode(method string, statusCode int) error {
+	switch {
+	case statusCode == http.StatusMethodNotAllowed && method == http.MethodDelete:
+		return ErrDeleteNotSupported
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case statusCode == http.StatusNotFound:
+		return ErrNotFound
+	case statusCode == http.StatusTooManyRequests || statusCode/100 == 5:
+		return ErrUnavailable
+	default:
+		return ErrUnexpectedStatusCode
+	}
+}
+
+// ExitCode classifies the given error into the exit code of the commands.
+func ExitCode(err error) int {
+	cause := errors.Cause(err)
+	switch cause {
+	case nil:
+		return 0
+	case ErrUnauthorized:
+		return ExitCodeUnauthorized
+	case ErrNotFound:
+		return ExitCodeNotFound
+	case ErrUnavailable, context.DeadlineExceeded:
+		return ExitCodeUnavailable
+	case ErrUsage:
+		return ExitCodeUsage
+	case ErrTagNotExists:
+		return ExitCodeFailure
+	}
+	if _, ok := cause.(*ErrRateLimited); ok {
+		return ExitCodeUnavailable
+	}
+	if errs, ok := cause.(Errors); ok {
+		return exitCodeOfErrors(errs)
+	}
+	if _, ok := cause.(net.Error); ok {
+		return ExitCodeUnavailable
+	}
+	return ExitCodeFailure
+}
+
+// exitCodeOfErrors returns the exit code shared by all errors and ExitCodeFailure if they differ.
+func exitCodeOfErrors(errs Errors) int {
+	if len(errs) == 0 {
+		return ExitCodeFailure
+	}
+	exitCode := ExitCode(errs[0])
+	for _, err := range errs[1:] {
+		if ExitCode(err) != exitCode {
+			return ExitCodeFailure
+		}
+	}
+	return exitCode
+}
@@ -0,0 +1,124 @@
+package docker_test
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("ExitCode", func() {
+	It("returns 0 without error", func() {
+		Expect(docker.ExitCode(nil)).To(Equal(0))
+	})
+	It("returns 1 for unknown errors", func() {
+		Expect(docker.ExitCode(errors.New("banana"))).To(Equal(docker.ExitCodeFailure))
+	})
+	It("returns exit code of wrapped sentinel", func() {
+		Expect(docker.ExitCode(errors.Wrap(docker.ErrUnauthorized, "get failed"))).To(Equal(docker.ExitCodeUnauthorized))
+		Expect(docker.ExitCode(errors.Wrap(docker.ErrNotFound, "get failed"))).To(Equal(docker.ExitCodeNotFound))
+		Expect(docker.ExitCode(errors.Wrap(docker.ErrUnavailable, "get failed"))).To(Equal(docker.ExitCodeUnavailable))
+		Expect(docker.ExitCode(errors.Wrap(docker.ErrUsage, "flag missing"))).To(Equal(docker.ExitCodeUsage))
+		Expect(docker.ExitCode(docker.ErrTagNotExists)).To(Equal(docker.ExitCodeFailure))
+	})
+	It("returns unavailable for network errors", func() {
+		err := errors.Wrap(&net.OpError{Op: "dial", Err: errors.New("refused")}, "get failed")
+		Expect(docker.ExitCode(err)).To(Equal(docker.ExitCodeUnavailable))
+	})
+	It("returns the exit code shared by combined errors", func() {
+		err := docker.CombineErrors([]error{
+			errors.Wrap(docker.ErrUnauthorized, "list tags failed"),
+			errors.Wrap(docker.ErrUnauthorized, "delete failed"),
+		})
+		Expect(docker.ExitCode(err)).To(Equal(docker.ExitCodeUnauthorized))
+	})
+	It("returns 1 for combined errors with different exit codes", func() {
+		err := docker.CombineErrors([]error{
+			errors.Wrap(docker.ErrUnauthorized, "list tags failed"),
+			errors.Wrap(docker.ErrUnavailable, "delete failed"),
+		})
+		Expect(docker.ExitCode(err)).To(Equal(docker.ExitCodeFailure))
+	})
+	It("returns nil for no combined errors", func() {
+		Expect(docker.CombineErrors(nil)).To(BeNil())
+	})
+})
+
+var _ = Describe("RegistryError", func() {
+	var server *httptest.Server
+	var client docker.V2Client
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/v2/team/app/manifests/missing":
+				resp.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(resp, `{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown","detail":{"Tag":"missing"}}]}`)
+			case "/v2/team/app/manifests/limited":
+				resp.Header().Set("Retry-After", "7")
+				resp.WriteHeader(http.StatusTooManyRequests)
+			default:
+				resp.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(resp, "forbidden")
+			}
+		}))
+		client = docker.NewV2Client(docker.NewHttpClient(server.Client()), docker.Registry{Url: server.URL})
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	It("exposes status code and error body", func() {
+		_, err := client.Manifest(context.Background(), "team/app", "missing")
+		Expect(docker.IsNotFound(err)).To(BeTrue())
+		registryError, ok := docker.AsRegistryError(err)
+		Expect(ok).To(BeTrue())
+		Expect(registryError.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(registryError.HasCode("MANIFEST_UNKNOWN")).To(BeTrue())
+		Expect(registryError.Errors[0].Message).To(Equal("manifest unknown"))
+		Expect(err.Error()).To(ContainSubstring("MANIFEST_UNKNOWN manifest unknown"))
+	})
+	It("keeps rate limit as cause", func() {
+		_, err := client.Digest(context.Background(), "team/app", "limited")
+		rateLimited, ok := docker.IsRateLimited(err)
+		Expect(ok).To(BeTrue())
+		Expect(rateLimited.RetryAfter).To(Equal(7 * time.Second))
+		registryError, ok := docker.AsRegistryError(err)
+		Expect(ok).To(BeTrue())
+		Expect(registryError.StatusCode).To(Equal(http.StatusTooManyRequests))
+	})
+	It("handles bodies without error schema", func() {
+		_, err := client.Digest(context.Background(), "team/app", "other")
+		Expect(docker.IsUnauthorized(err)).To(BeTrue())
+		registryError, ok := docker.AsRegistryError(err)
+		Expect(ok).To(BeTrue())
+		Expect(registryError.Errors).To(BeEmpty())
+	})
+	It("returns false for other errors", func() {
+		_, ok := docker.AsRegistryError(errors.Wrap(docker.ErrNotFound, "banana"))
+		Expect(ok).To(BeFalse())
+		Expect(docker.IsManifestUnknown(errors.Wrap(docker.ErrNotFound, "banana"))).To(BeFalse())
+	})
+	It("reports manifest unknown", func() {
+		_, err := client.Manifest(context.Background(), "team/app", "missing")
+		Expect(docker.IsManifestUnknown(err)).To(BeTrue())
+		registryError, _ := docker.AsRegistryError(err)
+		Expect(stderrors.Is(registryError, docker.ErrManifestUnknown)).To(BeTrue())
+		Expect(stderrors.Is(registryError, docker.ErrNotFound)).To(BeTrue())
+		Expect(stderrors.Is(registryError, docker.ErrUnauthorized)).To(BeFalse())
+	})
+	It("unwraps to the cause", func() {
+		_, err := client.Digest(context.Background(), "team/app", "limited")
+		registryError, _ := docker.AsRegistryError(err)
+		var rateLimited *docker.ErrRateLimited
+		Expect(stderrors.As(fmt.Errorf("check: %w", registryError), &rateLimited)).To(BeTrue())
+		Expect(rateLimited.RetryAfter).To(Equal(7 * time.Second))
+		Expect(stderrors.Is(registryError, docker.ErrManifestUnknown)).To(BeFalse())
+	})
+})
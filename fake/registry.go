@@ -0,0 +1,331 @@
+// Package fake provides an in-memory docker registry speaking enough of the v2 api to test code using the docker package.
+package fake
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bborbe/docker-utils"
+)
+
+const token = "fake-token"
+
+// Registry serves /v2/, the catalog, tag lists and manifests of the seeded repositories.
+// Optional bearer auth issues tokens from /token like a real token server.
+type Registry struct {
+	mux          sync.Mutex
+	repositories map[docker.RepositoryName]map[docker.TagName]time.Time
+	username     string
+	password     string
+	bearerAuth   bool
+}
+
+// NewRegistry returns a registry seeded with the given repositories and their tags.
+func NewRegistry(repositories map[docker.RepositoryName][]docker.TagName) *Registry {
+	r := &Registry{
+		repositories: make(map[docker.RepositoryName]map[docker.TagName]time.Time),
+	}
+	for repositoryName, tags := range repositories {
+		r.AddTags(repositoryName, tags...)
+	}
+	return r
+}
+
+// WithBearerAuth answers all v2 requests without token with a bearer challenge.
+// Tokens are only issued for the given credentials.
+func (r *Registry) WithBearerAuth(username string, password string) *Registry {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.bearerAuth = true
+	r.username = username
+	r.password = password
+	return r
+}
+
+// AddTags adds tags without creation time.
+func (r *Registry) AddTags(repositoryName docker.RepositoryName, tags ...docker.TagName) {
+	for _, tag := range tags {
+		r.AddTag(repositoryName, tag, time.Time{})
+	}
+}
+
+// AddTag adds a tag whose image config reports the given creation time.
+func (r *Registry) AddTag(repositoryName docker.RepositoryName, tag docker.TagName, created time.Time) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.repositories[repositoryName] == nil {
+		r.repositories[repositoryName] = make(map[docker.TagName]time.Time)
+	}
+	r.repositories[repositoryName][tag] = created
+}
+
+// Repositories returns the current repositories and their tags sorted by name.
+func (r *Registry) Repositories() map[docker.RepositoryName][]docker.TagName {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	result := make(map[docker.RepositoryName][]docker.TagName, len(r.repositories))
+	for repositoryName := range r.repositories {
+		result[repositoryName] = r.tags(repositoryName)
+	}
+	return result
+}
+
+// NewServer starts a httptest.Server serving the registry. The caller must close it.
+func (r *Registry) NewServer() *httptest.Server {
+	return httptest.NewServer(r)
+}
+
+// NewV2Client returns a docker.V2Client talking to the registry without network.
+func (r *Registry) NewV2Client(options ...docker.ClientOption) docker.V2Client {
+	return docker.NewV2Client(
+		docker.NewHttpClient(&http.Client{Transport: &handlerRoundTripper{handler: r}}),
+		docker.Registry{Url: "http://registry.fake", Username: r.username, Password: r.password},
+		options...,
+	)
+}
+
+func (r *Registry) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		r.serveToken(resp, req)
+		return
+	}
+	if !strings.HasPrefix(req.URL.Path, "/v2/") {
+		http.NotFound(resp, req)
+		return
+	}
+	if !r.authorized(req) {
+		host := req.Host
+		if host == "" {
+			host = req.URL.Host
+		}
+		resp.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="fake"`, host))
+		writeError(resp, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+	resp.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case path == "":
+		fmt.Fprint(resp, "{}")
+	case path == "_catalog":
+		r.serveCatalog(resp, req)
+	case strings.HasSuffix(path, "/tags/list"):
+		r.serveTags(resp, req, docker.RepositoryName(strings.TrimSuffix(path, "/tags/list")))
+	case strings.Contains(path, "/manifests/"):
+		i := strings.LastIndex(path, "/manifests/")
+		r.serveManifest(resp, req, docker.RepositoryName(path[:i]), path[i+len("/manifests/"):])
+	case strings.Contains(path, "/blobs/"):
+		i := strings.LastIndex(path, "/blobs/")
+		r.serveBlob(resp, req, docker.RepositoryName(path[:i]), path[i+len("/blobs/"):])
+	default:
+		http.NotFound(resp, req)
+	}
+}
+
+func (r *Registry) authorized(req *http.Request) bool {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return !r.bearerAuth || req.Header.Get("Authorization") == "Bearer "+token
+}
+
+func (r *Registry) serveToken(resp http.ResponseWriter, req *http.Request) {
+	username, password, _ := req.BasicAuth()
+	r.mux.Lock()
+	valid := username == r.username && password == r.password
+	r.mux.Unlock()
+	if !valid {
+		writeError(resp, http.StatusUnauthorized, "UNAUTHORIZED", "invalid credentials")
+		return
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(resp, `{"token":"%s","expires_in":300}`, token)
+}
+
+func (r *Registry) serveCatalog(resp http.ResponseWriter, req *http.Request) {
+	r.mux.Lock()
+	names := make([]string, 0, len(r.repositories))
+	for repositoryName := range r.repositories {
+		names = append(names, repositoryName.String())
+	}
+	r.mux.Unlock()
+	sort.Strings(names)
+	page, next := paginate(names, req)
+	if next != "" {
+		resp.Header().Set("Link", fmt.Sprintf(`</v2/_catalog?%s>; rel="next"`, next))
+	}
+	writeJSON(resp, map[string][]string{"repositories": page})
+}
+
+func (r *Registry) serveTags(resp http.ResponseWriter, req *http.Request, repositoryName docker.RepositoryName) {
+	r.mux.Lock()
+	_, ok := r.repositories[repositoryName]
+	tags := r.tags(repositoryName)
+	r.mux.Unlock()
+	if !ok {
+		writeError(resp, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		return
+	}
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.String()
+	}
+	page, next := paginate(names, req)
+	if next != "" {
+		resp.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?%s>; rel="next"`, repositoryName, next))
+	}
+	writeJSON(resp, map[string]interface{}{"name": repositoryName, "tags": page})
+}
+
+func (r *Registry) serveManifest(resp http.ResponseWriter, req *http.Request, repositoryName docker.RepositoryName, reference string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	tag, ok := r.resolve(repositoryName, reference)
+	if !ok {
+		writeError(resp, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+		return
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		content := r.manifest(repositoryName, tag)
+		resp.Header().Set("Content-Type", docker.MediaTypeDockerManifest)
+		resp.Header().Set("Docker-Content-Digest", digest(content).String())
+		resp.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		if req.Method == http.MethodGet {
+			resp.Write(content)
+		}
+	case http.MethodDelete:
+		if !strings.HasPrefix(reference, "sha256:") {
+			writeError(resp, http.StatusBadRequest, "DIGEST_INVALID", "manifests are deleted by digest")
+			return
+		}
+		delete(r.repositories[repositoryName], tag)
+		resp.WriteHeader(http.StatusAccepted)
+	default:
+		writeError(resp, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+// resolve returns the tag for a tag or digest reference. The caller must hold the lock.
+func (r *Registry) resolve(repositoryName docker.RepositoryName, reference string) (docker.TagName, bool) {
+	tags, ok := r.repositories[repositoryName]
+	if !ok {
+		return "", false
+	}
+	if _, ok := tags[docker.TagName(reference)]; ok {
+		return docker.TagName(reference), true
+	}
+	for tag := range tags {
+		if digest(r.manifest(repositoryName, tag)).String() == reference {
+			return tag, true
+		}
+	}
+	return "", false
+}
+
+// serveBlob serves the image config referenced by the manifests.
+func (r *Registry) serveBlob(resp http.ResponseWriter, req *http.Request, repositoryName docker.RepositoryName, reference string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for tag := range r.repositories[repositoryName] {
+		content := r.config(repositoryName, tag)
+		if digest(content).String() != reference {
+			continue
+		}
+		resp.Header().Set("Content-Type", "application/vnd.docker.container.image.v1+json")
+		resp.Header().Set("Docker-Content-Digest", reference)
+		resp.Write(content)
+		return
+	}
+	writeError(resp, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+}
+
+// tags returns the sorted tags of the repository. The caller must hold the lock.
+func (r *Registry) tags(repositoryName docker.RepositoryName) []docker.TagName {
+	tags := make([]docker.TagName, 0, len(r.repositories[repositoryName]))
+	for tag := range r.repositories[repositoryName] {
+		tags = append(tags, tag)
+	}
+	sort.Sort(docker.TagsByName(tags))
+	return tags
+}
+
+// paginate applies the n and last parameters and returns the query of the next page if there is one.
+func paginate(names []string, req *http.Request) ([]string, string) {
+	if last := req.URL.Query().Get("last"); last != "" {
+		i := sort.SearchStrings(names, last)
+		if i < len(names) && names[i] == last {
+			i++
+		}
+		names = names[i:]
+	}
+	n, err := strconv.Atoi(req.URL.Query().Get("n"))
+	if err != nil || n <= 0 || n >= len(names) {
+		return names, ""
+	}
+	return names[:n], url.Values{"last": {names[n-1]}, "n": {strconv.Itoa(n)}}.Encode()
+}
+
+// manifest returns a unique manifest per repository and tag, so every tag has its own digest.
+// The caller must hold the lock.
+func (r *Registry) manifest(repositoryName docker.RepositoryName, tag docker.TagName) []byte {
+	config := r.config(repositoryName, tag)
+	content, _ := json.Marshal(docker.Manifest{
+		SchemaVersion: 2,
+		MediaType:     docker.MediaTypeDockerManifest,
+		Config: docker.ManifestConfig{
+			MediaType: "application/vnd.docker.container.image.v1+json",
+			Size:      len(config),
+			Digest:    digest(config).String(),
+		},
+		Layers: []docker.ManifestConfig{},
+	})
+	return content
+}
+
+// config returns the image config with the creation time of the tag. The caller must hold the lock.
+func (r *Registry) config(repositoryName docker.RepositoryName, tag docker.TagName) []byte {
+	content, _ := json.Marshal(map[string]interface{}{
+		"created": r.repositories[repositoryName][tag].UTC().Format(time.RFC3339Nano),
+		"config": map[string]interface{}{
+			"Labels": map[string]string{"fake.image": repositoryName.String() + ":" + tag.String()},
+		},
+	})
+	return content
+}
+
+func digest(content []byte) docker.Digest {
+	return docker.Digest(fmt.Sprintf("sha256:%x", sha256.Sum256(content)))
+}
+
+func writeJSON(resp http.ResponseWriter, data interface{}) {
+	resp.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(resp).Encode(data)
+}
+
+func writeError(resp http.ResponseWriter, statusCode int, code string, message string) {
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(statusCode)
+	fmt.Fprintf(resp, `{"errors":[{"code":"%s","message":"%s"}]}`, code, message)
+}
+
+// handlerRoundTripper serves requests directly by the handler without network.
+type handlerRoundTripper struct {
+	handler http.Handler
+}
+
+func (h *handlerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	h.handler.ServeHTTP(recorder, req)
+	resp := recorder.Result()
+	resp.Request = req
+	return resp, nil
+}
@@ -0,0 +1,140 @@
+package fake_test
+
+import (
+	"context"
+
+	"github.com/bborbe/docker-utils"
+	"github.com/bborbe/docker-utils/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Registry", func() {
+	var registry *fake.Registry
+	var client docker.V2Client
+	BeforeEach(func() {
+		registry = fake.NewRegistry(map[docker.RepositoryName][]docker.TagName{
+			"team/app":   {"1.0.0", "1.1.0", "latest"},
+			"team/api":   {"2.0.0"},
+			"other/tool": {"0.1.0"},
+		})
+	})
+	JustBeforeEach(func() {
+		client = registry.NewV2Client(docker.WithPageSize(2))
+	})
+	listRepositories := func() []docker.RepositoryName {
+		ch := make(chan docker.RepositoryName, 10)
+		Expect(client.ListRepositories(context.Background(), ch)).To(BeNil())
+		close(ch)
+		var result []docker.RepositoryName
+		for repositoryName := range ch {
+			result = append(result, repositoryName)
+		}
+		return result
+	}
+	It("pings", func() {
+		Expect(client.Ping(context.Background())).To(BeNil())
+	})
+	It("lists catalog page by page", func() {
+		Expect(listRepositories()).To(Equal([]docker.RepositoryName{"other/tool", "team/api", "team/app"}))
+	})
+	It("resumes catalog after checkpoint", func() {
+		repositories, err := client.ListRepositoriesAfter(context.Background(), "", 1)
+		Expect(err).To(BeNil())
+		Expect(repositories).To(Equal([]docker.RepositoryName{"other/tool"}))
+		repositories, err = client.ListRepositoriesAfter(context.Background(), repositories[0], 5)
+		Expect(err).To(BeNil())
+		Expect(repositories).To(Equal([]docker.RepositoryName{"team/api", "team/app"}))
+		repositories, err = client.ListRepositoriesAfter(context.Background(), "team/app", 5)
+		Expect(err).To(BeNil())
+		Expect(repositories).To(BeEmpty())
+	})
+	It("lists all repositories after checkpoint", func() {
+		repositories, err := client.ListRepositoriesAfter(context.Background(), "other/tool", 0)
+		Expect(err).To(BeNil())
+		Expect(repositories).To(Equal([]docker.RepositoryName{"team/api", "team/app"}))
+	})
+	It("lists tags page by page", func() {
+		tags, err := client.ListTagsSortedSemver(context.Background(), "team/app")
+		Expect(err).To(BeNil())
+		Expect(tags).To(Equal([]docker.TagName{"1.1.0", "1.0.0", "latest"}))
+	})
+	It("resumes tags after checkpoint across pages", func() {
+		tags, err := client.ListTagsAfter(context.Background(), "team/app", "", 1)
+		Expect(err).To(BeNil())
+		Expect(tags).To(Equal([]docker.TagName{"1.0.0"}))
+		tags, err = client.ListTagsAfter(context.Background(), "team/app", tags[0], 0)
+		Expect(err).To(BeNil())
+		Expect(tags).To(Equal([]docker.TagName{"1.1.0", "latest"}))
+		tags, err = client.ListTagsAfter(context.Background(), "team/app", "latest", 5)
+		Expect(err).To(BeNil())
+		Expect(tags).To(BeEmpty())
+	})
+	It("calls fn for each repository across pages", func() {
+		var repositories []docker.RepositoryName
+		err := client.EachRepository(context.Background(), func(repositoryName docker.RepositoryName) error {
+			repositories = append(repositories, repositoryName)
+			return nil
+		})
+		Expect(err).To(BeNil())
+		Expect(repositories).To(Equal([]docker.RepositoryName{"other/tool", "team/api", "team/app"}))
+	})
+	It("stops listing on the first error of fn", func() {
+		stop := errors.New("stop")
+		var repositories []docker.RepositoryName
+		err := client.EachRepository(context.Background(), func(repositoryName docker.RepositoryName) error {
+			repositories = append(repositories, repositoryName)
+			return stop
+		})
+		Expect(errors.Cause(err)).To(Equal(stop))
+		Expect(repositories).To(Equal([]docker.RepositoryName{"other/tool"}))
+	})
+	It("calls fn for each tag across pages", func() {
+		var tags []docker.TagName
+		err := client.EachTag(context.Background(), "team/app", func(tag docker.TagName) error {
+			tags = append(tags, tag)
+			return nil
+		})
+		Expect(err).To(BeNil())
+		Expect(tags).To(Equal([]docker.TagName{"1.0.0", "1.1.0", "latest"}))
+	})
+	It("returns not found for unknown repository", func() {
+		err := client.ListTags(context.Background(), "team/missing", make(chan docker.TagName, 10))
+		Expect(errors.Cause(err)).To(Equal(docker.ErrNotFound))
+	})
+	It("returns distinct valid digests per tag", func() {
+		a, err := client.Digest(context.Background(), "team/app", "1.0.0")
+		Expect(err).To(BeNil())
+		b, err := client.Digest(context.Background(), "team/app", "1.1.0")
+		Expect(err).To(BeNil())
+		Expect(a.Validate()).To(BeNil())
+		Expect(a).NotTo(Equal(b))
+	})
+	It("deletes tag by digest", func() {
+		Expect(client.DeleteTag(context.Background(), "team/app", "1.0.0")).To(BeNil())
+		Expect(registry.Repositories()["team/app"]).To(Equal([]docker.TagName{"1.1.0", "latest"}))
+	})
+	Context("with bearer auth", func() {
+		BeforeEach(func() {
+			registry.WithBearerAuth("user", "pass")
+		})
+		It("completes bearer challenge", func() {
+			Expect(listRepositories()).To(HaveLen(3))
+		})
+		It("rejects wrong credentials", func() {
+			server := registry.NewServer()
+			defer server.Close()
+			client = docker.NewV2Client(docker.NewHttpClient(server.Client()), docker.Registry{Url: server.URL, Username: "user", Password: "wrong"})
+			Expect(docker.ExitCode(client.Ping(context.Background()))).To(Equal(docker.ExitCodeUnauthorized))
+		})
+	})
+	It("serves real http", func() {
+		server := registry.NewServer()
+		defer server.Close()
+		client = docker.NewV2Client(docker.NewHttpClient(server.Client()), docker.Registry{Url: server.URL})
+		exists, err := client.ExistsTag(context.Background(), "team/api", "2.0.0")
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeTrue())
+	})
+})
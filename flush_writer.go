@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"time"
+)
+
+// FlushWriter buffers writes and flushes them periodically in the background,
+// so a consumer of a long running stream isn't starved.
+type FlushWriter struct {
+	mux    sync.Mutex
+	writer *bufio.Writer
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func NewFlushWriter(writer io.Writer, interval time.Duration) *FlushWriter {
+	f := &FlushWriter{
+		writer: bufio.NewWriter(writer),
+		done:   make(chan struct{}),
+	}
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-f.done:
+				return
+			case <-ticker.C:
+				// errors are sticky in bufio and returned by Close
+				_ = f.Flush()
+			}
+		}
+	}()
+	return f
+}
+
+func (f *FlushWriter) Write(p []byte) (int, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.writer.Write(p)
+}
+
+func (f *FlushWriter) Flush() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.writer.Flush()
+}
+
+// Close stops the background flushing and flushes the remaining buffer.
+func (f *FlushWriter) Close() error {
+	close(f.done)
+	f.wg.Wait()
+	return f.Flush()
+}
@@ -0,0 +1,49 @@
+package docker_test
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type syncBuffer struct {
+	mux    sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.buffer.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.buffer.String()
+}
+
+var _ = Describe("FlushWriter", func() {
+	var buffer *syncBuffer
+	BeforeEach(func() {
+		buffer = &syncBuffer{}
+	})
+	It("buffers until close", func() {
+		writer := docker.NewFlushWriter(buffer, time.Hour)
+		fmt.Fprintf(writer, "a\n")
+		Expect(buffer.String()).To(Equal(""))
+		Expect(writer.Close()).To(BeNil())
+		Expect(buffer.String()).To(Equal("a\n"))
+	})
+	It("flushes periodically", func() {
+		writer := docker.NewFlushWriter(buffer, 10*time.Millisecond)
+		defer writer.Close()
+		fmt.Fprintf(writer, "a\n")
+		Eventually(buffer.String).Should(Equal("a\n"))
+	})
+})
@@ -0,0 +1,105 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// Output formats supported by the -format flag of the commands.
+const (
+	FormatPlain    = "plain"
+	FormatJSON     = "json"
+	FormatTemplate = "template"
+)
+
+// Formatter streams items to a writer. Close must be called after the last item.
+type Formatter interface {
+	Format(item interface{}) error
+	Close() error
+}
+
+// NewFormatter returns the formatter for the given format.
+// The template is only used for FormatTemplate and is executed once per item.
+func NewFormatter(writer io.Writer, format string, tmpl string) (Formatter, error) {
+	switch format {
+	case FormatPlain:
+		return &plainFormatter{writer: writer}, nil
+	case FormatJSON:
+		return &jsonFormatter{writer: writer}, nil
+	case FormatTemplate:
+		if tmpl == "" {
+			return nil, errors.Wrap(ErrUsage, "template missing for format template")
+		}
+		t, err := template.New("format").Parse(tmpl)
+		if err != nil {
+			return nil, errors.Wrapf(ErrUsage, "parse template failed: %v", err)
+		}
+		return &templateFormatter{writer: writer, template: t}, nil
+	default:
+		return nil, errors.Wrapf(ErrUsage, "unknown format '%s', expected one of %s", format, strings.Join([]string{FormatPlain, FormatJSON, FormatTemplate}, ", "))
+	}
+}
+
+type plainFormatter struct {
+	writer io.Writer
+}
+
+func (p *plainFormatter) Format(item interface{}) error {
+	_, err := fmt.Fprintf(p.writer, "%s\n", item)
+	return err
+}
+
+func (p *plainFormatter) Close() error {
+	return nil
+}
+
+// jsonFormatter writes a json array, one item per line, without buffering all items.
+type jsonFormatter struct {
+	writer io.Writer
+	count  int
+}
+
+func (j *jsonFormatter) Format(item interface{}) error {
+	content, err := json.Marshal(item)
+	if err != nil {
+		return errors.Wrap(err, "marshal json failed")
+	}
+	separator := ",\n"
+	if j.count == 0 {
+		separator = "[\n"
+	}
+	j.count++
+	_, err = fmt.Fprintf(j.writer, "%s%s", separator, content)
+	return err
+}
+
+func (j *jsonFormatter) Close() error {
+	if j.count == 0 {
+		_, err := fmt.Fprint(j.writer, "[]\n")
+		return err
+	}
+	_, err := fmt.Fprint(j.writer, "\n]\n")
+	return err
+}
+
+type templateFormatter struct {
+	writer   io.Writer
+	template *template.Template
+}
+
+func (t *templateFormatter) Format(item interface{}) error {
+	if err := t.template.Execute(t.writer, item); err != nil {
+		return errors.Wrap(err, "execute template failed")
+	}
+	_, err := fmt.Fprintln(t.writer)
+	return err
+}
+
+func (t *templateFormatter) Close() error {
+	return nil
+}
@@ -0,0 +1,46 @@
+package docker_test
+
+import (
+	"bytes"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Formatter", func() {
+	var buf *bytes.Buffer
+	format := func(format string, tmpl string, items ...interface{}) string {
+		formatter, err := docker.NewFormatter(buf, format, tmpl)
+		Expect(err).To(BeNil())
+		for _, item := range items {
+			Expect(formatter.Format(item)).To(BeNil())
+		}
+		Expect(formatter.Close()).To(BeNil())
+		return buf.String()
+	}
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+	})
+	It("prints plain lines", func() {
+		Expect(format(docker.FormatPlain, "", docker.RepositoryName("bborbe/a"), docker.RepositoryName("bborbe/b"))).To(Equal("bborbe/a\nbborbe/b\n"))
+	})
+	It("prints json array", func() {
+		Expect(format(docker.FormatJSON, "", docker.RepositoryName("bborbe/a"), docker.RepositoryName("bborbe/b"))).To(MatchJSON(`["bborbe/a","bborbe/b"]`))
+	})
+	It("prints empty json array", func() {
+		Expect(format(docker.FormatJSON, "")).To(MatchJSON(`[]`))
+	})
+	It("executes template per item", func() {
+		Expect(format(docker.FormatTemplate, "repo={{.}}", docker.RepositoryName("bborbe/a"))).To(Equal("repo=bborbe/a\n"))
+	})
+	It("rejects unknown format", func() {
+		_, err := docker.NewFormatter(buf, "yaml", "")
+		Expect(errors.Cause(err)).To(Equal(docker.ErrUsage))
+	})
+	It("rejects invalid template", func() {
+		_, err := docker.NewFormatter(buf, docker.FormatTemplate, "{{.")
+		Expect(errors.Cause(err)).To(Equal(docker.ErrUsage))
+	})
+})
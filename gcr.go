@@ -0,0 +1,83 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GoogleUsername is the username registries of Google accept for OAuth2 access tokens.
+const GoogleUsername = "oauth2accesstoken"
+
+// GoogleJSONKeyUsername is the username registries of Google accept with a service account key as password.
+const GoogleJSONKeyUsername = "_json_key"
+
+// GoogleTokenValidity is how long an access token of gcloud is valid.
+const GoogleTokenValidity = time.Hour
+
+// IsGoogle returns true if the registry is hosted on Google Container Registry or Artifact Registry.
+func (r Registry) IsGoogle() bool {
+	host := r.host()
+	return host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") || strings.HasSuffix(host, "-docker.pkg.dev")
+}
+
+// CredentialsFromGoogle uses the service account key GOOGLE_APPLICATION_CREDENTIALS points to
+// or sets an OAuth2 access token of the Application Default Credentials as password.
+// The token is fetched with `gcloud auth application-default print-access-token`, PasswordExpires is set so a V2Client renews it.
+func (r *Registry) CredentialsFromGoogle() error {
+	if !r.IsGoogle() {
+		return errors.Errorf("registry %s is not a google registry", r.Url)
+	}
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		err := r.CredentialsFromGoogleKeyFile(path)
+		if err == nil {
+			return nil
+		}
+		// user credentials of gcloud auth application-default login are no service account key
+		debugf("use gcloud, %v", err)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("gcloud", "auth", "application-default", "print-access-token")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(ErrUnauthorized, "gcloud auth application-default print-access-token failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	token := strings.TrimSpace(stdout.String())
+	if token == "" {
+		return errors.Wrap(ErrUnauthorized, "gcloud returned empty access token")
+	}
+	r.Username = GoogleUsername
+	r.Password = token
+	r.PasswordExpires = time.Now().Add(GoogleTokenValidity)
+	return nil
+}
+
+// CredentialsFromGoogleKeyFile uses the JSON key of a service account as password, no gcloud is needed.
+func (r *Registry) CredentialsFromGoogleKeyFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "read google key file failed")
+	}
+	var key struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+	}
+	if err := json.Unmarshal(content, &key); err != nil {
+		return errors.Wrapf(err, "parse google key file %s failed", path)
+	}
+	if key.Type != "service_account" {
+		return errors.Errorf("google key file %s is of type '%s' instead of service_account", path, key.Type)
+	}
+	debugf("use key of service account %s", key.ClientEmail)
+	r.Username = GoogleJSONKeyUsername
+	r.Password = strings.TrimSpace(string(content))
+	r.PasswordExpires = time.Time{}
+	return nil
+}
@@ -0,0 +1,71 @@
+package docker_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Google", func() {
+	for _, url := range []string{"https://gcr.io", "eu.gcr.io", "https://europe-docker.pkg.dev"} {
+		url := url
+		It("detects "+url, func() {
+			Expect(docker.Registry{Url: url}.IsGoogle()).To(BeTrue())
+		})
+	}
+	It("ignores other registries", func() {
+		Expect(docker.Registry{Url: "https://registry-1.docker.io"}.IsGoogle()).To(BeFalse())
+	})
+	Context("CredentialsFromGoogle", func() {
+		var dir string
+		var oldPath string
+		var oldCredentials string
+		BeforeEach(func() {
+			oldCredentials = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+			os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+			var err error
+			dir, err = ioutil.TempDir("", "docker-utils")
+			Expect(err).To(BeNil())
+			script := "#!/bin/sh\necho access-token\n"
+			Expect(ioutil.WriteFile(filepath.Join(dir, "gcloud"), []byte(script), 0755)).To(BeNil())
+			oldPath = os.Getenv("PATH")
+			os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+		})
+		AfterEach(func() {
+			os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", oldCredentials)
+			os.Setenv("PATH", oldPath)
+			os.RemoveAll(dir)
+		})
+		It("sets access token as password", func() {
+			registry := docker.Registry{Url: "https://europe-docker.pkg.dev"}
+			Expect(registry.CredentialsFromGoogle()).To(BeNil())
+			Expect(registry.Username).To(Equal(docker.GoogleUsername))
+			Expect(registry.Password).To(Equal("access-token"))
+			Expect(registry.PasswordExpires).To(BeTemporally("~", time.Now().Add(docker.GoogleTokenValidity), time.Minute))
+		})
+		It("uses service account key of GOOGLE_APPLICATION_CREDENTIALS", func() {
+			key := `{"type":"service_account","client_email":"ci@project.iam.gserviceaccount.com"}`
+			path := filepath.Join(dir, "key.json")
+			Expect(ioutil.WriteFile(path, []byte(key), 0600)).To(BeNil())
+			os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+			registry := docker.Registry{Url: "https://gcr.io"}
+			Expect(registry.CredentialsFromGoogle()).To(BeNil())
+			Expect(registry.Username).To(Equal(docker.GoogleJSONKeyUsername))
+			Expect(registry.Password).To(Equal(key))
+			Expect(registry.PasswordExpires.IsZero()).To(BeTrue())
+		})
+		It("uses gcloud for user credentials", func() {
+			path := filepath.Join(dir, "application_default_credentials.json")
+			Expect(ioutil.WriteFile(path, []byte(`{"type":"authorized_user"}`), 0600)).To(BeNil())
+			os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+			registry := docker.Registry{Url: "https://gcr.io"}
+			Expect(registry.CredentialsFromGoogle()).To(BeNil())
+			Expect(registry.Username).To(Equal(docker.GoogleUsername))
+		})
+	})
+})
@@ -0,0 +1,38 @@
+package docker
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// GitHubDomain is the host of the GitHub Container Registry.
+const GitHubDomain = "ghcr.io"
+
+// IsGitHub returns true if the registry is the GitHub Container Registry.
+func (r Registry) IsGitHub() bool {
+	return r.host() == GitHubDomain
+}
+
+// CredentialsFromGitHub sets the token of GITHUB_TOKEN or GH_TOKEN as password.
+// ghcr.io exchanges it for a bearer token in the usual challenge flow, the username is GITHUB_ACTOR if set
+// because ghcr.io accepts any username for a token.
+func (r *Registry) CredentialsFromGitHub() error {
+	if !r.IsGitHub() {
+		return errors.Errorf("registry %s is not ghcr.io", r.Url)
+	}
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		token = os.Getenv("GH_TOKEN")
+	}
+	if token == "" {
+		return errors.Wrap(ErrNotFound, "GITHUB_TOKEN and GH_TOKEN are empty")
+	}
+	username := os.Getenv("GITHUB_ACTOR")
+	if username == "" {
+		username = "token"
+	}
+	r.Username = username
+	r.Password = token
+	return nil
+}
@@ -0,0 +1,87 @@
+package docker_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("GitHub", func() {
+	It("detects ghcr.io", func() {
+		Expect(docker.Registry{Url: "https://ghcr.io"}.IsGitHub()).To(BeTrue())
+		Expect(docker.Registry{Url: "ghcr.io"}.IsGitHub()).To(BeTrue())
+	})
+	It("ignores other registries", func() {
+		Expect(docker.Registry{Url: "https://registry-1.docker.io"}.IsGitHub()).To(BeFalse())
+	})
+	Context("CredentialsFromGitHub", func() {
+		var env map[string]string
+		BeforeEach(func() {
+			env = make(map[string]string)
+			for _, key := range []string{"GITHUB_TOKEN", "GH_TOKEN", "GITHUB_ACTOR"} {
+				env[key] = os.Getenv(key)
+				os.Unsetenv(key)
+			}
+		})
+		AfterEach(func() {
+			for key, value := range env {
+				os.Setenv(key, value)
+			}
+		})
+		It("uses GITHUB_TOKEN and GITHUB_ACTOR", func() {
+			os.Setenv("GITHUB_TOKEN", "pat")
+			os.Setenv("GITHUB_ACTOR", "octocat")
+			registry := docker.Registry{Url: "ghcr.io"}
+			Expect(registry.CredentialsFromGitHub()).To(BeNil())
+			Expect(registry.Username).To(Equal("octocat"))
+			Expect(registry.Password).To(Equal("pat"))
+		})
+		It("falls back to GH_TOKEN", func() {
+			os.Setenv("GH_TOKEN", "pat")
+			registry := docker.Registry{Url: "ghcr.io"}
+			Expect(registry.CredentialsFromGitHub()).To(BeNil())
+			Expect(registry.Username).To(Equal("token"))
+			Expect(registry.Password).To(Equal("pat"))
+		})
+		It("returns not found without token", func() {
+			registry := docker.Registry{Url: "ghcr.io"}
+			Expect(errors.Cause(registry.CredentialsFromGitHub())).To(Equal(docker.ErrNotFound))
+		})
+	})
+	It("exchanges the token in the bearer challenge like ghcr.io", func() {
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/token":
+				if _, password, _ := req.BasicAuth(); password != "pat" {
+					resp.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				Expect(req.URL.Query().Get("service")).To(Equal("ghcr.io"))
+				Expect(req.URL.Query().Get("scope")).To(Equal("repository:octocat/app:pull"))
+				fmt.Fprint(resp, `{"token":"registry-token"}`)
+			case "/v2/octocat/app/tags/list":
+				if req.Header.Get("Authorization") != "Bearer registry-token" {
+					resp.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="ghcr.io",scope="repository:octocat/app:pull"`, server.URL))
+					resp.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprint(resp, `{"name":"octocat/app","tags":["1.0.0"]}`)
+			default:
+				resp.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+		client := docker.NewV2Client(docker.NewHttpClient(server.Client()), docker.Registry{Url: server.URL, Username: "octocat", Password: "pat"})
+		tags, err := client.ListTagsSortedSemver(context.Background(), "octocat/app")
+		Expect(err).To(BeNil())
+		Expect(tags).To(Equal([]docker.TagName{"1.0.0"}))
+	})
+})
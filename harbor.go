@@ -0,0 +1,92 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// harborMaxPageSize is the largest page_size the harbor api accepts.
+const harborMaxPageSize = 100
+
+// WithHarbor lists repositories per project through the harbor api instead of the _catalog api.
+// Harbor only serves the catalog to system admins, the project api works with the credentials of every project member.
+func WithHarbor(harbor bool) ClientOption {
+	return func(o *clientOptions) {
+		o.harbor = harbor
+	}
+}
+
+// eachHarborRepository calls fn for the repositories of all projects visible to the credentials as project/repo.
+func (c *v2Client) eachHarborRepository(ctx context.Context, fn func(repositoryName RepositoryName) error) error {
+	var projects []string
+	err := c.harborPages(ctx, "/api/v2.0/projects", func(names []string) error {
+		projects = append(projects, names...)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "list harbor projects failed")
+	}
+	for _, project := range projects {
+		prefix := project + "/"
+		err := c.harborPages(ctx, fmt.Sprintf("/api/v2.0/projects/%s/repositories", url.PathEscape(project)), func(names []string) error {
+			for _, name := range names {
+				// harbor returns project/repo, older versions may omit the project
+				if !strings.HasPrefix(name, prefix) {
+					name = prefix + name
+				}
+				if err := fn(RepositoryName(name)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "list repositories of harbor project %s failed", project)
+		}
+	}
+	return nil
+}
+
+// harborPages requests the names of a project or repository list page by page until a page is not full.
+func (c *v2Client) harborPages(ctx context.Context, path string, handle func(names []string) error) error {
+	pageSize := c.pageSize
+	if pageSize <= 0 {
+		return errors.Errorf("invalid page size %d", pageSize)
+	}
+	if pageSize > harborMaxPageSize {
+		pageSize = harborMaxPageSize
+	}
+	for page := 1; ; page++ {
+		values := url.Values{}
+		values.Set("page", strconv.Itoa(page))
+		values.Set("page_size", strconv.Itoa(pageSize))
+		u := fmt.Sprintf("%s%s?%s", c.registry.BaseUrl(), path, values.Encode())
+		c.debugf("request url: %v", u)
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return errors.Wrap(err, "create http request failed")
+		}
+		var response []struct {
+			Name string `json:"name"`
+		}
+		if err := c.doJSON(ctx, req, &response); err != nil {
+			return errors.Wrap(err, "perform http request failed")
+		}
+		names := make([]string, len(response))
+		for i, entry := range response {
+			names[i] = entry.Name
+		}
+		if err := handle(names); err != nil {
+			return err
+		}
+		if len(response) < pageSize {
+			return nil
+		}
+	}
+}
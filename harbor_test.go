@@ -0,0 +1,83 @@
+package docker_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Harbor", func() {
+	var server *httptest.Server
+	var requests []string
+	BeforeEach(func() {
+		requests = nil
+		projects := map[string][]string{
+			"library": {"library/nginx", "library/redis", "library/postgres"},
+			"team":    {"team/app"},
+		}
+		page := func(req *http.Request, names []string) []map[string]string {
+			p, _ := strconv.Atoi(req.URL.Query().Get("page"))
+			size, _ := strconv.Atoi(req.URL.Query().Get("page_size"))
+			result := []map[string]string{}
+			for i := (p - 1) * size; i < p*size && i < len(names); i++ {
+				result = append(result, map[string]string{"name": names[i]})
+			}
+			return result
+		}
+		server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			requests = append(requests, req.URL.RequestURI())
+			if username, password, _ := req.BasicAuth(); username != "user" || password != "secret" {
+				resp.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			switch req.URL.Path {
+			case "/api/v2.0/projects":
+				json.NewEncoder(resp).Encode(page(req, []string{"library", "team"}))
+			case "/api/v2.0/projects/library/repositories", "/api/v2.0/projects/team/repositories":
+				json.NewEncoder(resp).Encode(page(req, projects[req.URL.Path[len("/api/v2.0/projects/"):len(req.URL.Path)-len("/repositories")]]))
+			default:
+				resp.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	list := func(options ...docker.ClientOption) ([]docker.RepositoryName, error) {
+		client := docker.NewV2Client(
+			docker.NewHttpClient(http.DefaultClient),
+			docker.Registry{Url: server.URL, Username: "user", Password: "secret"},
+			options...,
+		)
+		ch := make(chan docker.RepositoryName, 10)
+		err := client.ListRepositories(context.Background(), ch)
+		close(ch)
+		var result []docker.RepositoryName
+		for repositoryName := range ch {
+			result = append(result, repositoryName)
+		}
+		return result, err
+	}
+	It("lists repositories of all projects by the harbor api", func() {
+		repositories, err := list(docker.WithHarbor(true), docker.WithPageSize(2))
+		Expect(err).To(BeNil())
+		Expect(repositories).To(Equal([]docker.RepositoryName{"library/nginx", "library/redis", "library/postgres", "team/app"}))
+		Expect(requests).To(ContainElement("/api/v2.0/projects/library/repositories?page=2&page_size=2"))
+	})
+	It("limits the page size to the harbor maximum", func() {
+		_, err := list(docker.WithHarbor(true))
+		Expect(err).To(BeNil())
+		Expect(requests).To(ContainElement("/api/v2.0/projects?page=1&page_size=100"))
+	})
+	It("uses the catalog without option", func() {
+		_, err := list()
+		Expect(err).NotTo(BeNil())
+		Expect(requests).To(ContainElement(ContainSubstring("/v2/_catalog")))
+	})
+})
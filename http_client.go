@@ -3,11 +3,11 @@ package docker
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net/http"
 
 	"github.com/bborbe/io/reader_shadow_copy"
-	"github.com/golang/glog"
 	"github.com/pkg/errors"
 )
 
@@ -17,7 +17,14 @@ type HttpClient interface {
 	DoJSON(ctx context.Context, req *http.Request, data interface{}) error
 }
 
+// NewHttpClient wraps the client. Without own CheckRedirect the Authorization header is removed on redirects to other hosts,
+// like clients of the HttpClientBuilder do.
 func NewHttpClient(client *http.Client) HttpClient {
+	if client.CheckRedirect == nil {
+		c := *client
+		c.CheckRedirect = newCheckRedirect(nil)
+		client = &c
+	}
 	return &httpClient{
 		client: client,
 	}
@@ -30,9 +37,12 @@ type httpClient struct {
 func (h *httpClient) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
 	resp, err := h.client.Do(req.WithContext(ctx))
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.Wrapf(ctx.Err(), "%s request to %s aborted", req.Method, req.URL.String())
+		}
 		return nil, errors.Wrapf(err, "%s request to %s failed", req.Method, req.URL.String())
 	}
-	glog.V(2).Infof("%s request to %s completed with status %d", req.Method, req.URL.String(), resp.StatusCode)
+	debugfWith(loggerFromContext(ctx), "%s request to %s completed with status %d", req.Method, req.URL.String(), resp.StatusCode)
 	return resp, err
 }
 
@@ -41,15 +51,10 @@ func (h *httpClient) DoSuccess(ctx context.Context, req *http.Request) (*http.Re
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode/100 != 2 {
-		if glog.V(4) {
-			defer resp.Body.Close()
-			bytes, _ := ioutil.ReadAll(resp.Body)
-			glog.Infof(string(bytes))
-		}
-		return nil, errors.Errorf("%s request to %s failed with statusCode %d", req.Method, req.URL.String(), resp.StatusCode)
+	if err := checkSuccess(req, resp, loggerFromContext(ctx)); err != nil {
+		return nil, err
 	}
-	return resp, err
+	return resp, nil
 }
 
 func (h *httpClient) DoJSON(ctx context.Context, req *http.Request, data interface{}) error {
@@ -57,12 +62,25 @@ func (h *httpClient) DoJSON(ctx context.Context, req *http.Request, data interfa
 	if err != nil {
 		return err
 	}
+	return decodeJSON(resp, data, loggerFromContext(ctx))
+}
+
+// checkSuccess returns an error classified by status code if the response is not 2xx.
+func checkSuccess(req *http.Request, resp *http.Response, logger Logger) error {
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	defer resp.Body.Close()
+	bytes, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	debugfWith(logger, "%s request to %s failed with body: %s", req.Method, req.URL.String(), bytes)
+	return newRegistryError(req, resp, bytes)
+}
+
+func decodeJSON(resp *http.Response, data interface{}, logger Logger) error {
 	defer resp.Body.Close()
 	reader := reader_shadow_copy.New(resp.Body)
-	if err := json.NewDecoder(resp.Body).Decode(data); err != nil {
-		if glog.V(4) {
-			glog.Infof(string(reader.Bytes()))
-		}
+	if err := json.NewDecoder(reader).Decode(data); err != nil {
+		debugfWith(logger, "decode json failed for body: %s", reader.Bytes())
 		return errors.Wrap(err, "decode http response to json failed")
 	}
 	return nil
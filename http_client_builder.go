@@ -0,0 +1,485 @@
+package docker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultTimeout limits a single request including retries, so a registry that never responds does not hang forever.
+const DefaultTimeout = 30 * time.Second
+
+// DefaultDockerCertsDir is where docker looks for the certificates of a registry in <host>/.
+const DefaultDockerCertsDir = "/etc/docker/certs.d"
+
+// DefaultMaxIdleConnsPerHost keeps enough connections for concurrent tag listing, the http default keeps only 2.
+const DefaultMaxIdleConnsPerHost = 16
+
+// DefaultDialTimeout is the connect timeout of the http default transport.
+const DefaultDialTimeout = 30 * time.Second
+
+type HttpClientBuilder interface {
+	WithInsecureSkipVerify(insecureSkipVerify bool) HttpClientBuilder
+	WithClientCertificate(certFile string, keyFile string) HttpClientBuilder
+	WithCACertificate(caFile string) HttpClientBuilder
+	WithDockerCertsDir(certsDir string, registry Registry) HttpClientBuilder
+	WithCrawlStats(crawlStats *CrawlStats) HttpClientBuilder
+	WithRequestObserver(observer RequestObserver) HttpClientBuilder
+	WithRetry(maxRetries int, baseDelay time.Duration) HttpClientBuilder
+	WithRetryStatusCodes(statusCodes ...int) HttpClientBuilder
+	WithTimeout(timeout time.Duration) HttpClientBuilder
+	WithResponseHeaderTimeout(responseHeaderTimeout time.Duration) HttpClientBuilder
+	WithProxy(proxyUrl string) HttpClientBuilder
+	WithoutProxy() HttpClientBuilder
+	WithMaxIdleConns(maxIdleConns int) HttpClientBuilder
+	WithMaxIdleConnsPerHost(maxIdleConnsPerHost int) HttpClientBuilder
+	WithDialTimeout(dialTimeout time.Duration) HttpClientBuilder
+	WithIdleConnTimeout(idleConnTimeout time.Duration) HttpClientBuilder
+	WithKeepAlive(keepAlive time.Duration) HttpClientBuilder
+	WithLogger(logger Logger) HttpClientBuilder
+	Build() (*http.Client, error)
+	Close()
+}
+
+func NewHttpClientBuilder() HttpClientBuilder {
+	return &httpClientBuilder{
+		timeout:             DefaultTimeout,
+		maxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+	}
+}
+
+type httpClientBuilder struct {
+	insecureSkipVerify bool
+	certFile           string
+	keyFile            string
+	caFile             string
+	certsDirs          []string
+	crawlStats         *CrawlStats
+	observer           RequestObserver
+	maxRetries         int
+	retryDelay         time.Duration
+	retryStatusCodes   map[int]bool
+	timeout            time.Duration
+	headerTimeout      time.Duration
+	proxyUrl           string
+	withoutProxy       bool
+
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	dialTimeout         time.Duration
+	idleConnTimeout     time.Duration
+	keepAlive           time.Duration
+
+	logger Logger
+
+	mux        sync.Mutex
+	transports []*http.Transport
+}
+
+func (h *httpClientBuilder) WithInsecureSkipVerify(insecureSkipVerify bool) HttpClientBuilder {
+	h.insecureSkipVerify = insecureSkipVerify
+	return h
+}
+
+// WithClientCertificate enables mTLS. It is independent of the registry credentials,
+// so basic or bearer auth is still sent on top of the client certificate.
+func (h *httpClientBuilder) WithClientCertificate(certFile string, keyFile string) HttpClientBuilder {
+	h.certFile = certFile
+	h.keyFile = keyFile
+	return h
+}
+
+// WithCACertificate trusts the certificates of the given pem bundle in addition to the system roots.
+func (h *httpClientBuilder) WithCACertificate(caFile string) HttpClientBuilder {
+	h.caFile = caFile
+	return h
+}
+
+// WithDockerCertsDir uses the certificates of the registry in certsDir/<host>/ like docker does with /etc/docker/certs.d.
+// *.crt files are trusted as CA in addition to the system roots, *.cert files with the matching *.key are client certificates.
+// A missing directory is ignored, call it for each registry the client talks to.
+func (h *httpClientBuilder) WithDockerCertsDir(certsDir string, registry Registry) HttpClientBuilder {
+	if certsDir != "" {
+		h.certsDirs = append(h.certsDirs, filepath.Join(certsDir, registry.host()))
+	}
+	return h
+}
+
+// WithCrawlStats counts every request send by the built client.
+func (h *httpClientBuilder) WithCrawlStats(crawlStats *CrawlStats) HttpClientBuilder {
+	h.crawlStats = crawlStats
+	return h
+}
+
+// WithRequestObserver reports method, host, status code and duration of every request to the observer.
+// Without observer no wrapper is installed.
+func (h *httpClientBuilder) WithRequestObserver(observer RequestObserver) HttpClientBuilder {
+	h.observer = observer
+	return h
+}
+
+// WithRetry retries responses with 429 or 5xx and connection errors of GET and HEAD requests up to maxRetries times.
+// The delay starts at baseDelay and doubles with every attempt, a random jitter shortens it by up to half.
+func (h *httpClientBuilder) WithRetry(maxRetries int, baseDelay time.Duration) HttpClientBuilder {
+	h.maxRetries = maxRetries
+	h.retryDelay = baseDelay
+	return h
+}
+
+// WithRetryStatusCodes replaces the retried status codes, 429 and 5xx by default.
+func (h *httpClientBuilder) WithRetryStatusCodes(statusCodes ...int) HttpClientBuilder {
+	h.retryStatusCodes = make(map[int]bool, len(statusCodes))
+	for _, statusCode := range statusCodes {
+		h.retryStatusCodes[statusCode] = true
+	}
+	return h
+}
+
+// WithTimeout sets the timeout of the built client. Zero disables it.
+func (h *httpClientBuilder) WithTimeout(timeout time.Duration) HttpClientBuilder {
+	h.timeout = timeout
+	return h
+}
+
+// WithResponseHeaderTimeout limits waiting for the response headers, but not reading the body.
+// Unlike WithTimeout it bounds a hanging registry without cutting off large blob transfers.
+func (h *httpClientBuilder) WithResponseHeaderTimeout(responseHeaderTimeout time.Duration) HttpClientBuilder {
+	h.headerTimeout = responseHeaderTimeout
+	return h
+}
+
+// WithProxy sends the requests through the given proxy, except to hosts matching NO_PROXY of the environment.
+// Without it HTTP_PROXY, HTTPS_PROXY and NO_PROXY of the environment are used.
+func (h *httpClientBuilder) WithProxy(proxyUrl string) HttpClientBuilder {
+	h.proxyUrl = proxyUrl
+	return h
+}
+
+// WithoutProxy connects directly and ignores the proxy settings of the environment.
+func (h *httpClientBuilder) WithoutProxy() HttpClientBuilder {
+	h.withoutProxy = true
+	return h
+}
+
+// WithMaxIdleConns limits the idle connections kept over all registries.
+// Zero keeps the http default of 100, raised to the max idle connections per host if that is higher.
+func (h *httpClientBuilder) WithMaxIdleConns(maxIdleConns int) HttpClientBuilder {
+	h.maxIdleConns = maxIdleConns
+	return h
+}
+
+// WithMaxIdleConnsPerHost sets how many idle connections per registry are kept for reuse, see DefaultMaxIdleConnsPerHost.
+func (h *httpClientBuilder) WithMaxIdleConnsPerHost(maxIdleConnsPerHost int) HttpClientBuilder {
+	h.maxIdleConnsPerHost = maxIdleConnsPerHost
+	return h
+}
+
+// WithDialTimeout limits establishing the tcp connection, independent of the timeout of the whole request.
+// Zero keeps DefaultDialTimeout.
+func (h *httpClientBuilder) WithDialTimeout(dialTimeout time.Duration) HttpClientBuilder {
+	h.dialTimeout = dialTimeout
+	return h
+}
+
+// WithIdleConnTimeout closes connections idle for longer. Zero keeps the http default of 90 seconds.
+func (h *httpClientBuilder) WithIdleConnTimeout(idleConnTimeout time.Duration) HttpClientBuilder {
+	h.idleConnTimeout = idleConnTimeout
+	return h
+}
+
+// WithKeepAlive sets the tcp keep-alive period of new connections, negative disables it.
+// Zero keeps the http default of 30 seconds.
+func (h *httpClientBuilder) WithKeepAlive(keepAlive time.Duration) HttpClientBuilder {
+	h.keepAlive = keepAlive
+	return h
+}
+
+// WithLogger sets the logger of the built clients instead of the default of SetLogger.
+func (h *httpClientBuilder) WithLogger(logger Logger) HttpClientBuilder {
+	h.logger = logger
+	return h
+}
+
+// Close closes the idle connections of all clients built, e.g. before a long running process moves on to other registries.
+// The clients stay usable and open new connections if needed.
+func (h *httpClientBuilder) Close() {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for _, transport := range h.transports {
+		transport.CloseIdleConnections()
+	}
+}
+
+// Build returns a client with its own transport, which is shared by all requests and clients made from it.
+func (h *httpClientBuilder) Build() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{}
+	if h.maxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = h.maxIdleConnsPerHost
+		if transport.MaxIdleConns < h.maxIdleConnsPerHost {
+			transport.MaxIdleConns = h.maxIdleConnsPerHost
+		}
+	}
+	if h.maxIdleConns > 0 {
+		transport.MaxIdleConns = h.maxIdleConns
+	}
+	if h.headerTimeout > 0 {
+		transport.ResponseHeaderTimeout = h.headerTimeout
+	}
+	if h.idleConnTimeout > 0 {
+		transport.IdleConnTimeout = h.idleConnTimeout
+	}
+	if h.keepAlive != 0 || h.dialTimeout > 0 {
+		dialer := &net.Dialer{
+			Timeout:   DefaultDialTimeout,
+			KeepAlive: h.keepAlive,
+		}
+		if h.dialTimeout > 0 {
+			dialer.Timeout = h.dialTimeout
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	transport.Proxy = http.ProxyFromEnvironment
+	if h.proxyUrl != "" {
+		proxy, err := url.Parse(h.proxyUrl)
+		if err != nil || proxy.Host == "" {
+			return nil, errors.Wrapf(ErrUsage, "invalid proxy url '%s'", h.proxyUrl)
+		}
+		transport.Proxy = proxyExcept(proxy, noProxyFromEnvironment())
+	}
+	if h.withoutProxy {
+		transport.Proxy = nil
+	}
+	if h.certFile != "" || h.keyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(h.certFile, h.keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "load client certificate failed")
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{certificate}
+	}
+	if h.caFile != "" {
+		rootCAs, err := loadCertPool(h.caFile)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig.RootCAs = rootCAs
+	}
+	for _, dir := range h.certsDirs {
+		if err := loadDockerCertsDir(transport.TLSClientConfig, dir, h.logger); err != nil {
+			return nil, err
+		}
+	}
+	var roundTripper http.RoundTripper = transport
+	if h.insecureSkipVerify {
+		transport.TLSClientConfig.InsecureSkipVerify = true
+		roundTripper = &insecureWarningRoundTripper{
+			roundTripper: transport,
+			writer:       os.Stderr,
+			warned:       make(map[string]bool),
+			logger:       h.logger,
+		}
+	}
+	if h.observer != nil {
+		roundTripper = &requestObserverRoundTripper{
+			roundTripper: roundTripper,
+			observer:     h.observer,
+		}
+	}
+	if h.crawlStats != nil {
+		roundTripper = &crawlStatsRoundTripper{
+			roundTripper: roundTripper,
+			crawlStats:   h.crawlStats,
+		}
+	}
+	if h.maxRetries > 0 {
+		roundTripper = &retryRoundTripper{
+			roundTripper: roundTripper,
+			maxRetries:   h.maxRetries,
+			baseDelay:    h.retryDelay,
+			crawlStats:   h.crawlStats,
+			statusCodes:  h.retryStatusCodes,
+			logger:       h.logger,
+		}
+	}
+	h.mux.Lock()
+	h.transports = append(h.transports, transport)
+	h.mux.Unlock()
+	return &http.Client{
+		Transport:     roundTripper,
+		Timeout:       h.timeout,
+		CheckRedirect: newCheckRedirect(h.logger),
+	}, nil
+}
+
+func noProxyFromEnvironment() string {
+	if noProxy := os.Getenv("NO_PROXY"); noProxy != "" {
+		return noProxy
+	}
+	return os.Getenv("no_proxy")
+}
+
+// proxyExcept sends requests through the proxy except to loopback hosts and hosts matching the NO_PROXY list,
+// like http.ProxyFromEnvironment does.
+func proxyExcept(proxy *url.URL, noProxy string) func(req *http.Request) (*url.URL, error) {
+	entries := strings.Split(noProxy, ",")
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL.Host, entries) {
+			return nil, nil
+		}
+		return proxy, nil
+	}
+}
+
+// bypassProxy matches host[:port] against NO_PROXY entries like *, example.com, .example.com, host:port and 10.0.0.0/8.
+func bypassProxy(host string, entries []string) bool {
+	hostname, port := strings.ToLower(host), ""
+	if h, p, err := net.SplitHostPort(hostname); err == nil {
+		hostname, port = h, p
+	}
+	if isLoopbackHost(hostname) {
+		return true
+	}
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip := net.ParseIP(hostname); ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			if p != port {
+				continue
+			}
+			entry = h
+		}
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if hostname == entry || strings.HasSuffix(hostname, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxRedirects is the limit of the default http client.
+const maxRedirects = 10
+
+// newCheckRedirect removes the registry Authorization header if a redirect leaves the registry host,
+// e.g. blob downloads redirected to signed storage urls that reject additional credentials.
+// The default client would still send it to subdomains of the registry.
+func newCheckRedirect(logger Logger) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return errors.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if req.URL.Host != via[0].URL.Host {
+			debugfWith(logger, "redirect from %s to %s, remove authorization", via[0].URL.Host, req.URL.Host)
+			req.Header.Del("Authorization")
+		}
+		return nil
+	}
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if err := appendCertFile(pool, caFile); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+func appendCertFile(pool *x509.CertPool, caFile string) error {
+	content, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return errors.Wrap(err, "read ca certificate failed")
+	}
+	if !pool.AppendCertsFromPEM(content) {
+		return errors.Errorf("no certificate found in %s", caFile)
+	}
+	return nil
+}
+
+// loadDockerCertsDir adds the *.crt files of the dir to the root CAs and the *.cert/*.key pairs to the client certificates.
+func loadDockerCertsDir(config *tls.Config, dir string, logger Logger) error {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		debugfWith(logger, "no certs dir %s", dir)
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "read certs dir %s failed", dir)
+	}
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name())
+		switch filepath.Ext(file.Name()) {
+		case ".crt":
+			if config.RootCAs == nil {
+				if config.RootCAs, err = x509.SystemCertPool(); err != nil || config.RootCAs == nil {
+					config.RootCAs = x509.NewCertPool()
+				}
+			}
+			if err := appendCertFile(config.RootCAs, path); err != nil {
+				return err
+			}
+			debugfWith(logger, "trust ca %s", path)
+		case ".cert":
+			keyFile := strings.TrimSuffix(path, ".cert") + ".key"
+			certificate, err := tls.LoadX509KeyPair(path, keyFile)
+			if err != nil {
+				return errors.Wrapf(err, "load client certificate %s with key %s failed", path, keyFile)
+			}
+			config.Certificates = append(config.Certificates, certificate)
+			debugfWith(logger, "use client certificate %s", path)
+		}
+	}
+	return nil
+}
+
+// insecureWarningRoundTripper warns once per host that tls verification is skipped.
+type insecureWarningRoundTripper struct {
+	roundTripper http.RoundTripper
+	writer       io.Writer
+	logger       Logger
+
+	mux    sync.Mutex
+	warned map[string]bool
+}
+
+func (i *insecureWarningRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" {
+		i.warn(req.URL.Host)
+	}
+	return i.roundTripper.RoundTrip(req)
+}
+
+func (i *insecureWarningRoundTripper) warn(host string) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if i.warned[host] {
+		return
+	}
+	i.warned[host] = true
+	fmt.Fprintf(i.writer, "WARNING: TLS certificate verification is disabled for host %s\n", host)
+	warningfWith(i.logger, "TLS certificate verification is disabled for host %s", host)
+}
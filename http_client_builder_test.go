@@ -0,0 +1,446 @@
+package docker_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("HttpClientBuilder", func() {
+	var server *httptest.Server
+	BeforeEach(func() {
+		server = httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.WriteHeader(http.StatusOK)
+		}))
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	It("verifies certificates by default", func() {
+		client, err := docker.NewHttpClientBuilder().Build()
+		Expect(err).To(BeNil())
+		_, err = client.Get(server.URL)
+		Expect(err).NotTo(BeNil())
+	})
+	It("skips certificate verification if insecure", func() {
+		client, err := docker.NewHttpClientBuilder().WithInsecureSkipVerify(true).Build()
+		Expect(err).To(BeNil())
+		resp, err := client.Get(server.URL)
+		Expect(err).To(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+	It("removes the authorization on redirects to another host", func() {
+		authorizations := make(map[string]string)
+		proxy := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			authorizations[req.URL.Host] = req.Header.Get("Authorization")
+			switch req.URL.Host {
+			case "registry.example.com":
+				http.Redirect(resp, req, "http://storage.registry.example.com/blob?signature=abc", http.StatusTemporaryRedirect)
+			default:
+				resp.WriteHeader(http.StatusOK)
+			}
+		}))
+		defer proxy.Close()
+		client, err := docker.NewHttpClientBuilder().WithProxy(proxy.URL).Build()
+		Expect(err).To(BeNil())
+		req, err := http.NewRequest(http.MethodGet, "http://registry.example.com/v2/team/app/blobs/sha256:abc", nil)
+		Expect(err).To(BeNil())
+		req.Header.Set("Authorization", "Bearer token")
+		resp, err := client.Do(req)
+		Expect(err).To(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(authorizations).To(HaveKeyWithValue("registry.example.com", "Bearer token"))
+		Expect(authorizations).To(HaveKeyWithValue("storage.registry.example.com", ""))
+	})
+	It("sends requests through the given proxy", func() {
+		var proxied string
+		proxy := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			proxied = req.URL.String()
+			resp.WriteHeader(http.StatusOK)
+		}))
+		defer proxy.Close()
+		client, err := docker.NewHttpClientBuilder().WithProxy(proxy.URL).Build()
+		Expect(err).To(BeNil())
+		resp, err := client.Get("http://registry.example.com/v2/")
+		Expect(err).To(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(proxied).To(Equal("http://registry.example.com/v2/"))
+	})
+	Context("with given proxy and NO_PROXY", func() {
+		var oldNoProxy string
+		var proxy func(req *http.Request) (*url.URL, error)
+		BeforeEach(func() {
+			oldNoProxy = os.Getenv("NO_PROXY")
+			os.Setenv("NO_PROXY", "registry.internal, .corp.example.com,mirror.example.com:5000,10.0.0.0/8")
+			client, err := docker.NewHttpClientBuilder().WithProxy("http://proxy:3128").Build()
+			Expect(err).To(BeNil())
+			proxy = client.Transport.(*http.Transport).Proxy
+		})
+		AfterEach(func() {
+			os.Setenv("NO_PROXY", oldNoProxy)
+		})
+		for host, proxied := range map[string]bool{
+			"registry-1.docker.io":       true,
+			"registry.internal":          false,
+			"registry.internal:5000":     false,
+			"eu.corp.example.com":        false,
+			"corp.example.com":           false,
+			"mirror.example.com:5000":    false,
+			"mirror.example.com":         true,
+			"10.1.2.3:5000":              false,
+			"localhost:5000":             false,
+			"notregistry.internal.co.uk": true,
+		} {
+			host, proxied := host, proxied
+			It(fmt.Sprintf("uses proxy %v for %s", proxied, host), func() {
+				u, err := proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: host}})
+				Expect(err).To(BeNil())
+				Expect(u != nil).To(Equal(proxied))
+			})
+		}
+	})
+	It("uses the proxy of the environment by default", func() {
+		client, err := docker.NewHttpClientBuilder().Build()
+		Expect(err).To(BeNil())
+		Expect(client.Transport.(*http.Transport).Proxy).NotTo(BeNil())
+	})
+	It("connects directly without proxy", func() {
+		client, err := docker.NewHttpClientBuilder().WithoutProxy().Build()
+		Expect(err).To(BeNil())
+		Expect(client.Transport.(*http.Transport).Proxy).To(BeNil())
+	})
+	It("returns usage error for invalid proxy", func() {
+		_, err := docker.NewHttpClientBuilder().WithProxy("no-url").Build()
+		Expect(errors.Cause(err)).To(Equal(docker.ErrUsage))
+	})
+	It("reports every attempt to the request observer", func() {
+		var mux sync.Mutex
+		var observed []int
+		var calls int
+		flaky := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			mux.Lock()
+			calls++
+			first := calls == 1
+			mux.Unlock()
+			if first {
+				resp.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			resp.WriteHeader(http.StatusOK)
+		}))
+		defer flaky.Close()
+		observer := docker.RequestObserverFunc(func(method string, host string, statusCode int, duration time.Duration) {
+			mux.Lock()
+			defer mux.Unlock()
+			Expect(method).To(Equal(http.MethodGet))
+			Expect(flaky.URL).To(HaveSuffix(host))
+			observed = append(observed, statusCode)
+		})
+		client, err := docker.NewHttpClientBuilder().WithRetry(1, time.Millisecond).WithRequestObserver(observer).Build()
+		Expect(err).To(BeNil())
+		resp, err := client.Get(flaky.URL)
+		Expect(err).To(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(observed).To(Equal([]int{http.StatusServiceUnavailable, http.StatusOK}))
+	})
+	It("reports status code 0 for failed requests", func() {
+		var observed []int
+		observer := docker.RequestObserverFunc(func(method string, host string, statusCode int, duration time.Duration) {
+			observed = append(observed, statusCode)
+		})
+		client, err := docker.NewHttpClientBuilder().WithRequestObserver(observer).Build()
+		Expect(err).To(BeNil())
+		_, err = client.Get(server.URL)
+		Expect(err).NotTo(BeNil())
+		Expect(observed).To(Equal([]int{0}))
+	})
+	It("uses default timeout", func() {
+		client, err := docker.NewHttpClientBuilder().Build()
+		Expect(err).To(BeNil())
+		Expect(client.Timeout).To(Equal(docker.DefaultTimeout))
+	})
+	It("fails if registry does not respond in time", func() {
+		done := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			<-done
+		}))
+		defer slow.Close()
+		defer close(done)
+		client, err := docker.NewHttpClientBuilder().WithTimeout(50 * time.Millisecond).Build()
+		Expect(err).To(BeNil())
+		_, err = client.Get(slow.URL)
+		Expect(err).NotTo(BeNil())
+	})
+	It("reads slow bodies within the response header timeout", func() {
+		done := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/hang" {
+				<-done
+				return
+			}
+			resp.WriteHeader(http.StatusOK)
+			resp.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+			fmt.Fprint(resp, "blob")
+		}))
+		defer slow.Close()
+		defer close(done)
+		client, err := docker.NewHttpClientBuilder().WithTimeout(0).WithResponseHeaderTimeout(50 * time.Millisecond).Build()
+		Expect(err).To(BeNil())
+		resp, err := client.Get(slow.URL)
+		Expect(err).To(BeNil())
+		content, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		Expect(err).To(BeNil())
+		Expect(string(content)).To(Equal("blob"))
+		_, err = client.Get(slow.URL + "/hang")
+		Expect(err).NotTo(BeNil())
+	})
+	Context("connection reuse", func() {
+		const parallel = 8
+		var plain *httptest.Server
+		var mux sync.Mutex
+		var connections int
+		var barrier sync.WaitGroup
+		BeforeEach(func() {
+			connections = 0
+			plain = httptest.NewUnstartedServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				// all requests of a round are in flight at the same time and need their own connection
+				barrier.Done()
+				barrier.Wait()
+				resp.WriteHeader(http.StatusOK)
+			}))
+			plain.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					mux.Lock()
+					connections++
+					mux.Unlock()
+				}
+			}
+			plain.Start()
+		})
+		AfterEach(func() {
+			plain.Close()
+		})
+		round := func(client *http.Client, requests int) {
+			barrier.Add(requests)
+			var wg sync.WaitGroup
+			for i := 0; i < requests; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					resp, err := client.Get(plain.URL)
+					Expect(err).To(BeNil())
+					ioutil.ReadAll(resp.Body)
+					resp.Body.Close()
+				}()
+			}
+			wg.Wait()
+		}
+		count := func() int {
+			mux.Lock()
+			defer mux.Unlock()
+			return connections
+		}
+		It("keeps connections of parallel requests for reuse", func() {
+			client, err := docker.NewHttpClientBuilder().Build()
+			Expect(err).To(BeNil())
+			round(client, parallel)
+			Expect(count()).To(Equal(parallel))
+			round(client, parallel)
+			Expect(count()).To(Equal(parallel))
+		})
+		It("opens new connections beyond max idle connections per host", func() {
+			client, err := docker.NewHttpClientBuilder().WithMaxIdleConnsPerHost(2).Build()
+			Expect(err).To(BeNil())
+			round(client, parallel)
+			round(client, parallel)
+			Expect(count()).To(Equal(2*parallel - 2))
+		})
+		It("opens new connections beyond max idle connections", func() {
+			client, err := docker.NewHttpClientBuilder().WithMaxIdleConns(2).Build()
+			Expect(err).To(BeNil())
+			round(client, parallel)
+			round(client, parallel)
+			Expect(count()).To(Equal(2*parallel - 2))
+		})
+		It("fails to connect within the dial timeout", func() {
+			client, err := docker.NewHttpClientBuilder().WithDialTimeout(time.Nanosecond).Build()
+			Expect(err).To(BeNil())
+			_, err = client.Get(plain.URL)
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("timeout"))
+		})
+		It("closes idle connections on close", func() {
+			builder := docker.NewHttpClientBuilder().WithKeepAlive(time.Minute).WithIdleConnTimeout(time.Minute)
+			client, err := builder.Build()
+			Expect(err).To(BeNil())
+			round(client, 1)
+			builder.Close()
+			round(client, 1)
+			Expect(count()).To(Equal(2))
+		})
+	})
+	Context("with ca certificate", func() {
+		var dir string
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "docker-utils")
+			Expect(err).To(BeNil())
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+		It("trusts server signed by ca", func() {
+			caFile := filepath.Join(dir, "ca.pem")
+			Expect(ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)).To(BeNil())
+			client, err := docker.NewHttpClientBuilder().WithCACertificate(caFile).Build()
+			Expect(err).To(BeNil())
+			resp, err := client.Get(server.URL)
+			Expect(err).To(BeNil())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+		It("returns error for file without certificate", func() {
+			caFile := filepath.Join(dir, "ca.pem")
+			Expect(ioutil.WriteFile(caFile, []byte("banana"), 0600)).To(BeNil())
+			_, err := docker.NewHttpClientBuilder().WithCACertificate(caFile).Build()
+			Expect(err).NotTo(BeNil())
+		})
+	})
+	Context("with docker certs dir", func() {
+		var dir string
+		var hostDir string
+		var registry docker.Registry
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "docker-utils")
+			Expect(err).To(BeNil())
+			registry = docker.Registry{Url: server.URL}
+			hostDir = filepath.Join(dir, server.Listener.Addr().String())
+			Expect(os.Mkdir(hostDir, 0700)).To(BeNil())
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+		It("trusts the ca of the registry host", func() {
+			Expect(ioutil.WriteFile(filepath.Join(hostDir, "ca.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)).To(BeNil())
+			client, err := docker.NewHttpClientBuilder().WithDockerCertsDir(dir, registry).Build()
+			Expect(err).To(BeNil())
+			resp, err := client.Get(server.URL)
+			Expect(err).To(BeNil())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+		It("loads client certificate pairs", func() {
+			server.Close()
+			var peerCertificates int
+			server = httptest.NewUnstartedServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				peerCertificates = len(req.TLS.PeerCertificates)
+			}))
+			server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+			server.StartTLS()
+			hostDir = filepath.Join(dir, server.Listener.Addr().String())
+			Expect(os.Mkdir(hostDir, 0700)).To(BeNil())
+			writeClientCertificate(hostDir)
+			Expect(os.Rename(filepath.Join(hostDir, "client.crt"), filepath.Join(hostDir, "client.cert"))).To(BeNil())
+			client, err := docker.NewHttpClientBuilder().
+				WithInsecureSkipVerify(true).
+				WithDockerCertsDir(dir, docker.Registry{Url: server.URL}).
+				Build()
+			Expect(err).To(BeNil())
+			resp, err := client.Get(server.URL)
+			Expect(err).To(BeNil())
+			resp.Body.Close()
+			Expect(peerCertificates).To(Equal(1))
+		})
+		It("returns error for client certificate without key", func() {
+			Expect(ioutil.WriteFile(filepath.Join(hostDir, "client.cert"), []byte("banana"), 0600)).To(BeNil())
+			_, err := docker.NewHttpClientBuilder().WithDockerCertsDir(dir, registry).Build()
+			Expect(err).NotTo(BeNil())
+		})
+		It("ignores registries without directory", func() {
+			_, err := docker.NewHttpClientBuilder().WithDockerCertsDir(dir, docker.Registry{Url: "registry.example.com"}).Build()
+			Expect(err).To(BeNil())
+		})
+	})
+	It("returns error for missing client certificate", func() {
+		_, err := docker.NewHttpClientBuilder().WithClientCertificate("missing.crt", "missing.key").Build()
+		Expect(err).NotTo(BeNil())
+	})
+	Context("with client certificate", func() {
+		var dir string
+		var authorization string
+		var peerCertificates int
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "docker-utils")
+			Expect(err).To(BeNil())
+			writeClientCertificate(dir)
+
+			server.Close()
+			server = httptest.NewUnstartedServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				authorization = req.Header.Get("Authorization")
+				peerCertificates = len(req.TLS.PeerCertificates)
+				resp.Header().Set("Docker-Content-Digest", testDigest)
+				resp.WriteHeader(http.StatusOK)
+			}))
+			server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+			server.StartTLS()
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+		It("sends client certificate and authorization header", func() {
+			client, err := docker.NewHttpClientBuilder().
+				WithInsecureSkipVerify(true).
+				WithClientCertificate(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")).
+				Build()
+			Expect(err).To(BeNil())
+			v2Client := docker.NewV2Client(docker.NewHttpClient(client), docker.Registry{
+				Url:      server.URL,
+				Username: "user",
+				Password: "pass",
+			})
+			_, err = v2Client.Sha(context.Background(), "bborbe/app", "latest")
+			Expect(err).To(BeNil())
+			Expect(peerCertificates).To(Equal(1))
+			Expect(authorization).To(Equal("Basic dXNlcjpwYXNz"))
+		})
+	})
+})
+
+func writeClientCertificate(dir string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).To(BeNil())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).To(BeNil())
+	Expect(ioutil.WriteFile(filepath.Join(dir, "client.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)).To(BeNil())
+	Expect(ioutil.WriteFile(filepath.Join(dir, "client.key"), pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)).To(BeNil())
+}
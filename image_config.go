@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ImageConfig is the subset of the image config blob referenced by a manifest.
+type ImageConfig struct {
+	Created      time.Time            `json:"created"`
+	OS           string               `json:"os"`
+	Architecture string               `json:"architecture"`
+	Variant      string               `json:"variant,omitempty"`
+	Config       ImageContainerConfig `json:"config"`
+}
+
+// ImageContainerConfig holds the defaults for containers started from the image.
+type ImageContainerConfig struct {
+	User         string              `json:"User,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+}
+
+// ImageConfig downloads the image config the tag points to.
+// For manifest lists the image of the client platform is used.
+func (c *v2Client) ImageConfig(ctx context.Context, repositoryName RepositoryName, tag TagName) (*ImageConfig, error) {
+	manifest, _, err := c.manifest(ctx, repositoryName, tag.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "get manifest of %s:%s failed", repositoryName, tag)
+	}
+	if len(manifest.Manifests) > 0 {
+		descriptor, err := selectPlatform(manifest.Manifests, c.platform)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s:%s is a manifest list", repositoryName, tag)
+		}
+		c.debugf("use manifest %s of platform %s", descriptor.Digest, c.platform)
+		manifest, _, err = c.manifest(ctx, repositoryName, descriptor.Digest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get manifest %s of %s:%s failed", descriptor.Digest, repositoryName, tag)
+		}
+	}
+	config, err := c.configBlob(ctx, repositoryName, manifest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get image config of %s:%s failed", repositoryName, tag)
+	}
+	return config, nil
+}
+
+// Created returns the created date of the image config the tag points to.
+func (c *v2Client) Created(ctx context.Context, repositoryName RepositoryName, tag TagName) (time.Time, error) {
+	config, err := c.ImageConfig(ctx, repositoryName, tag)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return config.Created, nil
+}
+
+// Labels returns the labels of the image config, images without labels return an empty map.
+func (c *v2Client) Labels(ctx context.Context, repositoryName RepositoryName, tag TagName) (map[string]string, error) {
+	config, err := c.ImageConfig(ctx, repositoryName, tag)
+	if err != nil {
+		return nil, err
+	}
+	if config.Config.Labels == nil {
+		return map[string]string{}, nil
+	}
+	return config.Config.Labels, nil
+}
@@ -0,0 +1,111 @@
+package docker
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DockerHubDomain    = "docker.io"
+	DockerHubNamespace = "library"
+	DefaultTag         = TagName("latest")
+)
+
+var (
+	repositoryComponentRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*$`)
+	tagRegexp                 = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	domainRegexp              = regexp.MustCompile(`^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)(?:\.(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?))*(?::[0-9]+)?$`)
+)
+
+// ImageReference is a fully qualified image like docker.io/library/ubuntu:latest
+// or docker.io/library/ubuntu@sha256:... if pinned by digest.
+type ImageReference struct {
+	Domain     string
+	Repository RepositoryName
+	Tag        TagName
+	Digest     Digest
+}
+
+func (i ImageReference) String() string {
+	result := fmt.Sprintf("%s/%s", i.Domain, i.Repository)
+	if i.Tag != "" {
+		result += ":" + i.Tag.String()
+	}
+	if i.Digest != "" {
+		result += "@" + i.Digest.String()
+	}
+	return result
+}
+
+// ParseImageReference normalizes the given reference the same way docker pull does.
+// The first path segment is a registry host if it contains a "." or ":" or is "localhost",
+// otherwise the image lives on Docker Hub. Single segment Docker Hub images get the library namespace
+// and a missing tag defaults to latest unless the reference is pinned by a digest like name@sha256:...
+func ParseImageReference(ref string) (*ImageReference, error) {
+	if ref == "" {
+		return nil, errors.New("image reference is empty")
+	}
+	if strings.TrimSpace(ref) != ref {
+		return nil, errors.Errorf("image reference '%s' contains whitespace", ref)
+	}
+	remainder := ref
+	var digest Digest
+	if i := strings.Index(remainder, "@"); i != -1 {
+		digest = Digest(remainder[i+1:])
+		if err := digest.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid digest in image reference '%s'", ref)
+		}
+		remainder = remainder[:i]
+	}
+	domain, remainder := splitDomain(remainder)
+	name := remainder
+	var tag TagName
+	if digest == "" {
+		tag = DefaultTag
+	}
+	if i := strings.LastIndex(remainder, ":"); i > strings.LastIndex(remainder, "/") {
+		name = remainder[:i]
+		tag = TagName(remainder[i+1:])
+		if !tagRegexp.MatchString(tag.String()) {
+			return nil, errors.Errorf("invalid tag '%s' in image reference '%s'", tag, ref)
+		}
+	}
+	if !domainRegexp.MatchString(domain) {
+		return nil, errors.Errorf("invalid domain '%s' in image reference '%s'", domain, ref)
+	}
+	if domain == DockerHubDomain && !strings.Contains(name, "/") {
+		name = DockerHubNamespace + "/" + name
+	}
+	for _, component := range strings.Split(name, "/") {
+		if !repositoryComponentRegexp.MatchString(component) {
+			return nil, errors.Errorf("invalid repository '%s' in image reference '%s'", name, ref)
+		}
+	}
+	if len(domain)+1+len(name) > 255 {
+		return nil, errors.Errorf("repository name of image reference '%s' is longer than 255 characters", ref)
+	}
+	return &ImageReference{
+		Domain:     domain,
+		Repository: RepositoryName(name),
+		Tag:        tag,
+		Digest:     digest,
+	}, nil
+}
+
+func splitDomain(ref string) (string, string) {
+	i := strings.Index(ref, "/")
+	if i == -1 {
+		return DockerHubDomain, ref
+	}
+	first := ref[:i]
+	if !strings.ContainsAny(first, ".:") && first != "localhost" && strings.ToLower(first) == first {
+		return DockerHubDomain, ref
+	}
+	if first == "index.docker.io" {
+		return DockerHubDomain, ref[i+1:]
+	}
+	return first, ref[i+1:]
+}
@@ -0,0 +1,65 @@
+package docker_test
+
+import (
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseImageReference", func() {
+	type entry struct {
+		name     string
+		ref      string
+		expected docker.ImageReference
+	}
+	for _, e := range []entry{
+		{name: "official image", ref: "ubuntu", expected: docker.ImageReference{Domain: "docker.io", Repository: "library/ubuntu", Tag: "latest"}},
+		{name: "official image with tag", ref: "ubuntu:18.04", expected: docker.ImageReference{Domain: "docker.io", Repository: "library/ubuntu", Tag: "18.04"}},
+		{name: "hub namespace", ref: "bborbe/auth-http-proxy:1.0.1", expected: docker.ImageReference{Domain: "docker.io", Repository: "bborbe/auth-http-proxy", Tag: "1.0.1"}},
+		{name: "explicit hub domain", ref: "docker.io/ubuntu", expected: docker.ImageReference{Domain: "docker.io", Repository: "library/ubuntu", Tag: "latest"}},
+		{name: "legacy hub domain", ref: "index.docker.io/bborbe/app", expected: docker.ImageReference{Domain: "docker.io", Repository: "bborbe/app", Tag: "latest"}},
+		{name: "registry with dot", ref: "gcr.io/foo/bar", expected: docker.ImageReference{Domain: "gcr.io", Repository: "foo/bar", Tag: "latest"}},
+		{name: "registry with port", ref: "localhost:5000/foo", expected: docker.ImageReference{Domain: "localhost:5000", Repository: "foo", Tag: "latest"}},
+		{name: "registry with port and tag", ref: "localhost:5000/foo:1.2", expected: docker.ImageReference{Domain: "localhost:5000", Repository: "foo", Tag: "1.2"}},
+		{name: "localhost", ref: "localhost/foo", expected: docker.ImageReference{Domain: "localhost", Repository: "foo", Tag: "latest"}},
+		{name: "uppercase host", ref: "Registry/foo", expected: docker.ImageReference{Domain: "Registry", Repository: "foo", Tag: "latest"}},
+		{name: "digest", ref: "ubuntu@" + testDigest, expected: docker.ImageReference{Domain: "docker.io", Repository: "library/ubuntu", Digest: testDigest}},
+		{name: "tag and digest", ref: "localhost:5000/foo:1.2@" + testDigest, expected: docker.ImageReference{Domain: "localhost:5000", Repository: "foo", Tag: "1.2", Digest: testDigest}},
+		{name: "nested repository", ref: "registry.example.com/team/group/app:v1", expected: docker.ImageReference{Domain: "registry.example.com", Repository: "team/group/app", Tag: "v1"}},
+	} {
+		e := e
+		It("normalizes "+e.name, func() {
+			imageReference, err := docker.ParseImageReference(e.ref)
+			Expect(err).To(BeNil())
+			Expect(*imageReference).To(Equal(e.expected))
+		})
+		It("round trips "+e.name, func() {
+			imageReference, err := docker.ParseImageReference(e.expected.String())
+			Expect(err).To(BeNil())
+			Expect(*imageReference).To(Equal(e.expected))
+		})
+	}
+	for _, e := range []entry{
+		{name: "empty", ref: ""},
+		{name: "whitespace", ref: " ubuntu"},
+		{name: "uppercase repository", ref: "Ubuntu"},
+		{name: "empty tag", ref: "ubuntu:"},
+		{name: "invalid tag", ref: "ubuntu:-foo"},
+		{name: "trailing slash", ref: "gcr.io/foo/"},
+		{name: "scheme", ref: "https://gcr.io/foo"},
+		{name: "invalid digest", ref: "ubuntu@sha256:abc"},
+		{name: "empty digest", ref: "ubuntu@"},
+	} {
+		e := e
+		It("rejects "+e.name, func() {
+			_, err := docker.ParseImageReference(e.ref)
+			Expect(err).NotTo(BeNil())
+		})
+	}
+	It("formats digest reference", func() {
+		Expect(docker.ImageReference{Domain: "docker.io", Repository: "library/ubuntu", Digest: testDigest}.String()).To(Equal("docker.io/library/ubuntu@" + testDigest))
+	})
+	It("formats reference", func() {
+		Expect(docker.ImageReference{Domain: "docker.io", Repository: "library/ubuntu", Tag: "latest"}.String()).To(Equal("docker.io/library/ubuntu:latest"))
+	})
+})
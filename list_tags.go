@@ -0,0 +1,48 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultConcurrency is the number of repositories processed in parallel.
+const DefaultConcurrency = 8
+
+// ListTagsForRepositories lists the tags of all given repositories with concurrency parallel workers.
+// The tags of all successful listed repositories are returned, errors of single repositories are combined into the returned error.
+func (c *v2Client) ListTagsForRepositories(ctx context.Context, repositoryNames []RepositoryName, concurrency int) (map[RepositoryName][]TagName, error) {
+	if concurrency <= 0 {
+		return nil, errors.Errorf("invalid concurrency %d", concurrency)
+	}
+	tags := make([][]TagName, len(repositoryNames))
+	err := runWorkers(ctx, len(repositoryNames), concurrency, func(i int) error {
+		list, err := c.listAllTags(ctx, repositoryNames[i])
+		if err != nil {
+			return errors.Wrapf(err, "list tags of %s failed", repositoryNames[i])
+		}
+		tags[i] = list
+		return nil
+	})
+	result := make(map[RepositoryName][]TagName, len(repositoryNames))
+	for i, repositoryName := range repositoryNames {
+		if tags[i] != nil {
+			result[repositoryName] = tags[i]
+		}
+	}
+	return result, err
+}
+
+func (c *v2Client) listAllTags(ctx context.Context, repositoryName RepositoryName) ([]TagName, error) {
+	ch := make(chan TagName)
+	var err error
+	go func() {
+		defer close(ch)
+		err = c.ListTags(ctx, repositoryName, ch)
+	}()
+	tags := []TagName{}
+	for tag := range ch {
+		tags = append(tags, tag)
+	}
+	return tags, err
+}
@@ -0,0 +1,130 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// Logger receives all log output of the package.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+}
+
+var (
+	loggerMux sync.RWMutex
+	logger    Logger = GlogLogger{}
+)
+
+// SetLogger replaces the glog based default logger, e.g. with NopLogger if the package is embedded in a service with its own logging.
+// It is used by all clients and builders without own logger, see WithLogger.
+func SetLogger(l Logger) {
+	loggerMux.Lock()
+	defer loggerMux.Unlock()
+	if l == nil {
+		l = NopLogger{}
+	}
+	logger = l
+}
+
+func getLogger() Logger {
+	loggerMux.RLock()
+	defer loggerMux.RUnlock()
+	return logger
+}
+
+// WithLogger sets the logger of the client instead of the default of SetLogger.
+// It is also used for the requests the client sends through its HttpClient.
+func WithLogger(logger Logger) ClientOption {
+	return func(o *clientOptions) {
+		o.logger = logger
+	}
+}
+
+// orDefault returns the logger or the default of SetLogger if nil.
+func orDefault(logger Logger) Logger {
+	if logger == nil {
+		return getLogger()
+	}
+	return logger
+}
+
+func debugf(format string, args ...interface{}) {
+	getLogger().Debugf(format, args...)
+}
+
+func infof(format string, args ...interface{}) {
+	getLogger().Infof(format, args...)
+}
+
+func warningf(format string, args ...interface{}) {
+	getLogger().Warningf(format, args...)
+}
+
+func debugfWith(logger Logger, format string, args ...interface{}) {
+	orDefault(logger).Debugf(format, args...)
+}
+
+func infofWith(logger Logger, format string, args ...interface{}) {
+	orDefault(logger).Infof(format, args...)
+}
+
+func warningfWith(logger Logger, format string, args ...interface{}) {
+	orDefault(logger).Warningf(format, args...)
+}
+
+func (o clientOptions) debugf(format string, args ...interface{}) {
+	orDefault(o.logger).Debugf(format, args...)
+}
+
+func (o clientOptions) infof(format string, args ...interface{}) {
+	orDefault(o.logger).Infof(format, args...)
+}
+
+func (o clientOptions) warningf(format string, args ...interface{}) {
+	orDefault(o.logger).Warningf(format, args...)
+}
+
+type loggerContextKey struct{}
+
+// contextWithLogger passes the logger of a client to the HttpClient sending its requests.
+func contextWithLogger(ctx context.Context, logger Logger) context.Context {
+	if logger == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// loggerFromContext returns the logger of the client or nil for the default.
+func loggerFromContext(ctx context.Context) Logger {
+	logger, _ := ctx.Value(loggerContextKey{}).(Logger)
+	return logger
+}
+
+// GlogLogger logs debug messages with glog verbosity 2.
+type GlogLogger struct{}
+
+func (GlogLogger) Debugf(format string, args ...interface{}) {
+	if glog.V(2) {
+		glog.InfoDepth(2, fmt.Sprintf(format, args...))
+	}
+}
+
+func (GlogLogger) Infof(format string, args ...interface{}) {
+	glog.InfoDepth(2, fmt.Sprintf(format, args...))
+}
+
+func (GlogLogger) Warningf(format string, args ...interface{}) {
+	glog.WarningDepth(2, fmt.Sprintf(format, args...))
+}
+
+// NopLogger discards all messages.
+type NopLogger struct{}
+
+func (NopLogger) Debugf(format string, args ...interface{})   {}
+func (NopLogger) Infof(format string, args ...interface{})    {}
+func (NopLogger) Warningf(format string, args ...interface{}) {}
@@ -0,0 +1,104 @@
+package docker_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type recordingLogger struct {
+	mux      sync.Mutex
+	messages []string
+}
+
+func (r *recordingLogger) record(level string, format string, args ...interface{}) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.messages = append(r.messages, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (r *recordingLogger) Debugf(format string, args ...interface{}) {
+	r.record("debug", format, args...)
+}
+
+func (r *recordingLogger) Infof(format string, args ...interface{}) {
+	r.record("info", format, args...)
+}
+
+func (r *recordingLogger) Warningf(format string, args ...interface{}) {
+	r.record("warning", format, args...)
+}
+
+var _ = Describe("Logger", func() {
+	var logger *recordingLogger
+	BeforeEach(func() {
+		logger = &recordingLogger{}
+		docker.SetLogger(logger)
+	})
+	AfterEach(func() {
+		docker.SetLogger(docker.GlogLogger{})
+	})
+	It("routes log output to injected logger", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		client := docker.NewV2Client(docker.NewHttpClient(server.Client()), docker.Registry{Url: server.URL})
+		Expect(client.Ping(context.Background())).To(BeNil())
+		Expect(logger.messages).To(ContainElement(ContainSubstring("debug GET request to " + server.URL + "/v2/ completed with status 200")))
+	})
+	It("accepts nil to discard output", func() {
+		docker.SetLogger(nil)
+		server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {}))
+		defer server.Close()
+		client := docker.NewV2Client(docker.NewHttpClient(server.Client()), docker.Registry{Url: server.URL})
+		Expect(client.Ping(context.Background())).To(BeNil())
+		Expect(logger.messages).To(BeEmpty())
+	})
+	Context("WithLogger", func() {
+		var global *recordingLogger
+		var server *httptest.Server
+		BeforeEach(func() {
+			global = logger
+			server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/v2/retry/" {
+					resp.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				resp.WriteHeader(http.StatusOK)
+			}))
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("routes log output of each client to its own logger", func() {
+			first := &recordingLogger{}
+			second := &recordingLogger{}
+			firstClient := docker.NewV2Client(docker.NewHttpClient(server.Client()), docker.Registry{Url: server.URL}, docker.WithLogger(first))
+			secondClient := docker.NewV2Client(docker.NewHttpClient(server.Client()), docker.Registry{Url: server.URL}, docker.WithLogger(second))
+			Expect(firstClient.Ping(context.Background())).To(BeNil())
+			Expect(first.messages).To(ContainElement(ContainSubstring("debug GET request to " + server.URL + "/v2/ completed with status 200")))
+			Expect(second.messages).To(BeEmpty())
+			Expect(secondClient.Ping(context.Background())).To(BeNil())
+			Expect(second.messages).To(ContainElement(ContainSubstring("debug ping " + server.URL + " returned 200")))
+			Expect(global.messages).To(BeEmpty())
+		})
+		It("routes log output of built clients to the logger of the builder", func() {
+			builderLogger := &recordingLogger{}
+			httpClient, err := docker.NewHttpClientBuilder().WithRetry(1, time.Millisecond).WithLogger(builderLogger).Build()
+			Expect(err).To(BeNil())
+			resp, err := httpClient.Get(server.URL + "/v2/retry/")
+			Expect(err).To(BeNil())
+			resp.Body.Close()
+			Expect(builderLogger.messages).To(ContainElement(ContainSubstring("returned 503, retry 1/1")))
+			Expect(global.messages).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,246 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Platform identifies the image of one os and architecture in a manifest list.
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// DefaultPlatform is used to pick an image from manifest lists unless WithPlatform is given.
+var DefaultPlatform = Platform{OS: "linux", Architecture: "amd64"}
+
+func (p Platform) String() string {
+	if p.Variant == "" {
+		return fmt.Sprintf("%s/%s", p.OS, p.Architecture)
+	}
+	return fmt.Sprintf("%s/%s/%s", p.OS, p.Architecture, p.Variant)
+}
+
+// ParsePlatform parses os/architecture[/variant] like linux/arm64 or linux/arm/v7.
+func ParsePlatform(value string) (Platform, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Platform{}, errors.Errorf("platform '%s' is not of form os/architecture[/variant]", value)
+	}
+	for _, part := range parts {
+		if part == "" || strings.TrimSpace(part) != part {
+			return Platform{}, errors.Errorf("platform '%s' is not of form os/architecture[/variant]", value)
+		}
+	}
+	platform := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+	return platform, nil
+}
+
+// Match returns true if os and architecture are equal and the variant is equal or not requested.
+func (p Platform) Match(other Platform) bool {
+	return p.OS == other.OS && p.Architecture == other.Architecture && (p.Variant == "" || p.Variant == other.Variant)
+}
+
+// PlatformManifest is the image manifest of one platform a tag points to.
+type PlatformManifest struct {
+	Platform  Platform `json:"platform"`
+	MediaType string   `json:"mediaType"`
+	Digest    Digest   `json:"digest"`
+}
+
+// Manifests returns the image manifest of every platform of a manifest list or oci index.
+// A single-arch tag returns one element with the platform read from its image config.
+func (c *v2Client) Manifests(ctx context.Context, repositoryName RepositoryName, tag TagName) ([]PlatformManifest, error) {
+	manifest, digest, err := c.manifest(ctx, repositoryName, tag.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "get manifest of %s:%s failed", repositoryName, tag)
+	}
+	if len(manifest.Manifests) > 0 {
+		result := make([]PlatformManifest, 0, len(manifest.Manifests))
+		for _, descriptor := range manifest.Manifests {
+			if descriptor.Platform == nil {
+				// e.g. attestation manifests without platform
+				continue
+			}
+			result = append(result, PlatformManifest{
+				Platform:  *descriptor.Platform,
+				MediaType: descriptor.MediaType,
+				Digest:    Digest(descriptor.Digest),
+			})
+		}
+		return result, nil
+	}
+	config, err := c.configBlob(ctx, repositoryName, manifest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get image config of %s:%s failed", repositoryName, tag)
+	}
+	return []PlatformManifest{
+		{
+			Platform: Platform{
+				OS:           config.OS,
+				Architecture: config.Architecture,
+				Variant:      config.Variant,
+			},
+			MediaType: manifest.MediaType,
+			Digest:    digest,
+		},
+	}, nil
+}
+
+// HasPlatform returns true if the tag has an image for the platform, e.g. to verify an arm64 build exists before deploying.
+func (c *v2Client) HasPlatform(ctx context.Context, repositoryName RepositoryName, tag TagName, platform Platform) (bool, error) {
+	manifests, err := c.Manifests(ctx, repositoryName, tag)
+	if err != nil {
+		return false, err
+	}
+	for _, manifest := range manifests {
+		if platform.Match(manifest.Platform) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ManifestForPlatform returns the image manifest of the platform with its digest.
+// For manifest lists the entry of the platform is resolved, a single-arch tag must be built for the platform.
+// A tag without image for the platform returns ErrNotFound.
+func (c *v2Client) ManifestForPlatform(ctx context.Context, repositoryName RepositoryName, tag TagName, platform Platform) (*Manifest, Digest, error) {
+	manifest, digest, err := c.manifest(ctx, repositoryName, tag.String())
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "get manifest of %s:%s failed", repositoryName, tag)
+	}
+	if len(manifest.Manifests) == 0 {
+		config, err := c.configBlob(ctx, repositoryName, manifest)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "get image config of %s:%s failed", repositoryName, tag)
+		}
+		if !platform.Match(Platform{OS: config.OS, Architecture: config.Architecture, Variant: config.Variant}) {
+			return nil, "", errors.Wrapf(ErrNotFound, "%s:%s is a single-arch image without platform %s", repositoryName, tag, platform)
+		}
+		return manifest, digest, nil
+	}
+	descriptor, err := selectPlatform(manifest.Manifests, platform)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "%s:%s is a manifest list", repositoryName, tag)
+	}
+	manifest, digest, err = c.manifest(ctx, repositoryName, descriptor.Digest)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "get manifest %s of %s:%s failed", descriptor.Digest, repositoryName, tag)
+	}
+	return manifest, digest, nil
+}
+
+// manifest fetches the manifest by tag or digest accepting manifest lists
+// and returns it with its content digest.
+func (c *v2Client) manifest(ctx context.Context, repositoryName RepositoryName, reference string) (*Manifest, Digest, error) {
+	content, mediaType, digest, err := c.manifestContent(ctx, repositoryName, reference)
+	if err != nil {
+		return nil, "", err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		c.debugf("decode json failed for body: %s", content)
+		return nil, "", errors.Wrap(err, "decode manifest failed")
+	}
+	if manifest.MediaType == "" {
+		manifest.MediaType = mediaType
+	}
+	return &manifest, digest, nil
+}
+
+// manifestContent returns the raw manifest with its media type and content digest.
+// A sha256 digest announced by the registry must match the content.
+func (c *v2Client) manifestContent(ctx context.Context, repositoryName RepositoryName, reference string) ([]byte, string, Digest, error) {
+	url := c.repositoryUrl(repositoryName, "manifests/"+reference)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", "", errors.Wrap(err, "build request failed")
+	}
+	req.Header.Add("Accept", acceptManifestMediaTypes())
+	resp, err := c.doSuccess(ctx, req)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", "", errors.Wrap(err, "read manifest failed")
+	}
+	sum := sha256.Sum256(content)
+	computed := Digest("sha256:" + hex.EncodeToString(sum[:]))
+	digest := Digest(resp.Header.Get("Docker-Content-Digest"))
+	if digest == "" {
+		digest = computed
+	}
+	// only sha256 digests can be verified, other algorithms are trusted as served
+	if strings.HasPrefix(digest.String(), "sha256:") && digest != computed {
+		return nil, "", "", errors.Errorf("manifest %s:%s has digest %s but registry announced %s", repositoryName, reference, computed, digest)
+	}
+	return content, resp.Header.Get("Content-Type"), digest, nil
+}
+
+// ManifestByReference returns the manifest of a tag or digest like sha256:... with its verified content digest.
+// Unlike Manifest it accepts schema2 and OCI manifests as well as manifest lists and indexes, the media type is always set.
+func (c *v2Client) ManifestByReference(ctx context.Context, repositoryName RepositoryName, reference string) (*Manifest, Digest, error) {
+	if strings.Contains(reference, ":") {
+		if err := Digest(reference).Validate(); err != nil {
+			return nil, "", errors.Wrapf(err, "invalid reference %s", reference)
+		}
+	}
+	manifest, digest, err := c.manifest(ctx, repositoryName, reference)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "get manifest %s@%s failed", repositoryName, reference)
+	}
+	// like for the announced digest only sha256 can be verified
+	if strings.HasPrefix(reference, "sha256:") && Digest(reference) != digest {
+		return nil, "", errors.Errorf("manifest %s@%s has digest %s", repositoryName, reference, digest)
+	}
+	return manifest, digest, nil
+}
+
+// RawManifest returns the manifest exactly as served with its media type, e.g. to verify signatures or push it unchanged.
+// Manifest lists and OCI indexes are returned as is. The content is verified against the Docker-Content-Digest header.
+func (c *v2Client) RawManifest(ctx context.Context, repositoryName RepositoryName, tag TagName) ([]byte, string, error) {
+	content, mediaType, _, err := c.manifestContent(ctx, repositoryName, tag.String())
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "get manifest %s:%s failed", repositoryName, tag)
+	}
+	return content, mediaType, nil
+}
+
+func (c *v2Client) configBlob(ctx context.Context, repositoryName RepositoryName, manifest *Manifest) (*ImageConfig, error) {
+	if manifest.Config.Digest == "" {
+		return nil, errors.Wrap(ErrNotFound, "manifest has no image config")
+	}
+	url := c.repositoryUrl(repositoryName, "blobs/"+manifest.Config.Digest)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "build request failed")
+	}
+	var config ImageConfig
+	if err := c.doJSON(ctx, req, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func selectPlatform(descriptors []ManifestDescriptor, platform Platform) (*ManifestDescriptor, error) {
+	for i, descriptor := range descriptors {
+		if descriptor.Platform != nil && platform.Match(*descriptor.Platform) {
+			return &descriptors[i], nil
+		}
+	}
+	return nil, errors.Wrapf(ErrNotFound, "no image for platform %s", platform)
+}
@@ -0,0 +1,36 @@
+package docker
+
+import "strings"
+
+const (
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	// MediaTypeOCIArtifactManifest was removed from the OCI spec again, but some registries still serve artifacts with it.
+	MediaTypeOCIArtifactManifest = "application/vnd.oci.artifact.manifest.v1+json"
+	// MediaTypeOCIEmpty is the config of artifacts without config, their type is the artifactType of the manifest.
+	MediaTypeOCIEmpty        = "application/vnd.oci.empty.v1+json"
+	MediaTypeHelmChartConfig = "application/vnd.cncf.helm.config.v1+json"
+)
+
+// imageManifestMediaTypes accepted for a single manifest, images and OCI artifacts like Helm charts or SBOMs.
+var imageManifestMediaTypes = []string{
+	MediaTypeDockerManifest,
+	MediaTypeOCIManifest,
+	MediaTypeOCIArtifactManifest,
+}
+
+// manifestMediaTypes accepted when resolving a tag, including multi-arch indexes.
+var manifestMediaTypes = append([]string{
+	MediaTypeDockerManifestList,
+	MediaTypeOCIIndex,
+}, imageManifestMediaTypes...)
+
+func acceptManifestMediaTypes() string {
+	return strings.Join(manifestMediaTypes, ", ")
+}
+
+func acceptImageManifestMediaTypes() string {
+	return strings.Join(imageManifestMediaTypes, ", ")
+}
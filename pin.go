@@ -0,0 +1,40 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Pin resolves the tag of the given repository to its current digest.
+func (c *v2Client) Pin(ctx context.Context, repository Repository) (Digest, error) {
+	digest, err := c.Digest(ctx, repository.Name, repository.Tag)
+	if err != nil {
+		return "", errors.Wrapf(err, "pin %s:%s failed", repository.Name, repository.Tag)
+	}
+	return digest, nil
+}
+
+// PinAll resolves all given repositories with concurrency parallel workers and returns the digests of all successful resolved ones.
+// Errors of single repositories are combined into the returned error.
+func (c *v2Client) PinAll(ctx context.Context, repositories []Repository, concurrency int) (map[Repository]Digest, error) {
+	if concurrency <= 0 {
+		return nil, errors.Errorf("invalid concurrency %d", concurrency)
+	}
+	digests := make([]Digest, len(repositories))
+	err := runWorkers(ctx, len(repositories), concurrency, func(i int) error {
+		digest, err := c.Pin(ctx, repositories[i])
+		if err != nil {
+			return err
+		}
+		digests[i] = digest
+		return nil
+	})
+	result := make(map[Repository]Digest, len(repositories))
+	for i, repository := range repositories {
+		if digests[i] != "" {
+			result[repository] = digests[i]
+		}
+	}
+	return result, err
+}
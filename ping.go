@@ -0,0 +1,34 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Ping checks the registry speaks the v2 api and the credentials are accepted.
+// A Bearer challenge of /v2/ is completed before the result is interpreted.
+func (c *v2Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/v2/", c.registry.BaseUrl()), nil)
+	if err != nil {
+		return errors.Wrap(err, "build request failed")
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return errors.Wrapf(err, "ping %s failed", c.registry.BaseUrl())
+	}
+	resp.Body.Close()
+	c.debugf("ping %s returned %d", c.registry.BaseUrl(), resp.StatusCode)
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return errors.Wrapf(ErrUnauthorized, "ping %s failed", c.registry.BaseUrl())
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return errors.Wrapf(errorForStatusCode(req.Method, resp.StatusCode), "ping %s failed with status %d", c.registry.BaseUrl(), resp.StatusCode)
+	default:
+		return errors.Wrapf(ErrNotV2Registry, "ping %s failed with status %d", c.registry.BaseUrl(), resp.StatusCode)
+	}
+}
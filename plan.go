@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"fmt"
+	"sync"
+)
+
+// PlannedActionType names what a mutating operation does to the registry.
+type PlannedActionType string
+
+const (
+	PlannedActionDeleteManifest PlannedActionType = "delete-manifest"
+	// PlannedActionDeleteTag removes only the tag, like the Docker Hub api does.
+	PlannedActionDeleteTag   PlannedActionType = "delete-tag"
+	PlannedActionUploadBlob  PlannedActionType = "upload-blob"
+	PlannedActionMountBlob   PlannedActionType = "mount-blob"
+	PlannedActionPutManifest PlannedActionType = "put-manifest"
+)
+
+// PlannedAction is a single mutation of a registry, performed or only planned in a dry run.
+type PlannedAction struct {
+	Type       PlannedActionType `json:"type"`
+	Registry   string            `json:"registry"`
+	Repository RepositoryName    `json:"repository"`
+	// Tag is empty for blobs and child manifests of a manifest list.
+	Tag    TagName `json:"tag,omitempty"`
+	Digest Digest  `json:"digest,omitempty"`
+	Size   int64   `json:"size,omitempty"`
+	// From is the source repository of a blob mount.
+	From   RepositoryName `json:"from,omitempty"`
+	DryRun bool           `json:"dryRun"`
+}
+
+func (p PlannedAction) String() string {
+	result := fmt.Sprintf("%s %s/%s", p.Type, p.Registry, p.Repository)
+	if p.Tag != "" {
+		result += ":" + p.Tag.String()
+	}
+	if p.Digest != "" {
+		result += " " + p.Digest.String()
+	}
+	if p.From != "" {
+		result += " from " + p.From.String()
+	}
+	return result
+}
+
+// Plan collects the actions of mutating operations like DeleteTag, Prune, DeleteMatching and Copy.
+// Combined with WithDryRun it is the preview of what a run would change.
+type Plan struct {
+	mux     sync.Mutex
+	actions []PlannedAction
+}
+
+func NewPlan() *Plan {
+	return &Plan{}
+}
+
+// Actions returns a copy of the collected actions in the order they were performed or planned.
+func (p *Plan) Actions() []PlannedAction {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return append([]PlannedAction{}, p.actions...)
+}
+
+func (p *Plan) add(action PlannedAction) {
+	if p == nil {
+		return
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.actions = append(p.actions, action)
+}
+
+// WithPlan records every mutating action of the client in the plan, with WithDryRun without performing it.
+// Read operations are not recorded.
+func WithPlan(plan *Plan) ClientOption {
+	return func(o *clientOptions) {
+		o.plan = plan
+	}
+}
+
+// planned records the action done or skipped because of dry run.
+func (o clientOptions) planned(registry Registry, action PlannedAction, dryRun bool) {
+	action.Registry = registry.host()
+	action.DryRun = dryRun
+	o.plan.add(action)
+}
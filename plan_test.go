@@ -0,0 +1,117 @@
+package docker_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/bborbe/docker-utils"
+	"github.com/bborbe/docker-utils/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Plan", func() {
+	var plan *docker.Plan
+	BeforeEach(func() {
+		plan = docker.NewPlan()
+	})
+	Context("Prune", func() {
+		var registry *fake.Registry
+		var digest docker.Digest
+		BeforeEach(func() {
+			registry = fake.NewRegistry(map[docker.RepositoryName][]docker.TagName{
+				"team/app": {"1.0.0", "1.1.0"},
+			})
+			var err error
+			digest, err = registry.NewV2Client().Digest(context.Background(), "team/app", "1.0.0")
+			Expect(err).To(BeNil())
+		})
+		It("returns the deletes of a dry run", func() {
+			_, err := registry.NewV2Client(docker.WithDryRun(true), docker.WithPlan(plan)).Prune(context.Background(), "team/app", 1, docker.PruneOptions{})
+			Expect(err).To(BeNil())
+			Expect(plan.Actions()).To(Equal([]docker.PlannedAction{
+				{Type: docker.PlannedActionDeleteManifest, Registry: "registry.fake", Repository: "team/app", Tag: "1.0.0", Digest: digest, DryRun: true},
+			}))
+			Expect(registry.Repositories()["team/app"]).To(HaveLen(2))
+		})
+		It("records performed deletes", func() {
+			_, err := registry.NewV2Client(docker.WithPlan(plan)).Prune(context.Background(), "team/app", 1, docker.PruneOptions{})
+			Expect(err).To(BeNil())
+			Expect(plan.Actions()).To(HaveLen(1))
+			Expect(plan.Actions()[0].DryRun).To(BeFalse())
+			Expect(registry.Repositories()["team/app"]).To(Equal([]docker.TagName{"1.1.0"}))
+		})
+		It("records nothing for read operations", func() {
+			_, err := registry.NewV2Client(docker.WithPlan(plan)).ListTagsSortedSemver(context.Background(), "team/app")
+			Expect(err).To(BeNil())
+			Expect(plan.Actions()).To(BeEmpty())
+		})
+	})
+	Context("Copy", func() {
+		var src, dst *memoryRegistry
+		var srcServer, dstServer *httptest.Server
+		BeforeEach(func() {
+			src = newMemoryRegistry()
+			dst = newMemoryRegistry()
+			srcServer = httptest.NewServer(src)
+			dstServer = httptest.NewServer(dst)
+		})
+		AfterEach(func() {
+			srcServer.Close()
+			dstServer.Close()
+		})
+		It("returns uploads and manifest of a dry run", func() {
+			content := src.addImage("team/app", "1.0.0", "config", "layer-1")
+			err := docker.Copy(
+				context.Background(),
+				docker.NewHttpClient(http.DefaultClient),
+				docker.Registry{Url: srcServer.URL}, docker.Repository{Name: "team/app", Tag: "1.0.0"},
+				docker.Registry{Url: dstServer.URL}, docker.Repository{Name: "mirror/app", Tag: "1.0.0"},
+				docker.WithDryRun(true),
+				docker.WithPlan(plan),
+			)
+			Expect(err).To(BeNil())
+			host := dstServer.Listener.Addr().String()
+			Expect(plan.Actions()).To(Equal([]docker.PlannedAction{
+				{Type: docker.PlannedActionUploadBlob, Registry: host, Repository: "mirror/app", Digest: docker.Digest(sha256Digest([]byte("config"))), Size: 6, DryRun: true},
+				{Type: docker.PlannedActionUploadBlob, Registry: host, Repository: "mirror/app", Digest: docker.Digest(sha256Digest([]byte("layer-1"))), Size: 7, DryRun: true},
+				{Type: docker.PlannedActionPutManifest, Registry: host, Repository: "mirror/app", Tag: "1.0.0", Digest: docker.Digest(sha256Digest(content)), Size: int64(len(content)), DryRun: true},
+			}))
+			Expect(dst.blobs).To(BeEmpty())
+		})
+		It("records mounts within the same registry", func() {
+			src.addImage("team/app", "1.0.0", "config", "layer-1")
+			// one registry with separate blob stores per repository, so the blobs are mounted
+			server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				if strings.HasPrefix(req.URL.Path, "/v2/team/app/") {
+					src.ServeHTTP(resp, req)
+					return
+				}
+				if digest := req.URL.Query().Get("mount"); digest != "" {
+					dst.mux.Lock()
+					dst.blobs[digest] = src.blobs[digest]
+					dst.mux.Unlock()
+					resp.WriteHeader(http.StatusCreated)
+					return
+				}
+				dst.ServeHTTP(resp, req)
+			}))
+			defer server.Close()
+			err := docker.Copy(
+				context.Background(),
+				docker.NewHttpClient(http.DefaultClient),
+				docker.Registry{Url: server.URL}, docker.Repository{Name: "team/app", Tag: "1.0.0"},
+				docker.Registry{Url: server.URL}, docker.Repository{Name: "team/copy", Tag: "1.0.0"},
+				docker.WithPlan(plan),
+			)
+			Expect(err).To(BeNil())
+			actions := plan.Actions()
+			Expect(actions).To(HaveLen(3))
+			Expect(actions[0].Type).To(Equal(docker.PlannedActionMountBlob))
+			Expect(actions[0].From).To(Equal(docker.RepositoryName("team/app")))
+			Expect(actions[2].String()).To(Equal("put-manifest " + server.Listener.Addr().String() + "/team/copy:1.0.0 " + actions[2].Digest.String()))
+		})
+	})
+})
@@ -0,0 +1,210 @@
+package docker
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PruneOrder defines how Prune decides which tags are the newest.
+type PruneOrder string
+
+const (
+	// PruneOrderSemver orders semver tags by precedence, all other tags are kept.
+	PruneOrderSemver PruneOrder = "semver"
+	// PruneOrderCreated orders tags by the created date of their image config.
+	// Tags without created date are kept.
+	PruneOrderCreated PruneOrder = "created"
+)
+
+type PruneOptions struct {
+	// Order defaults to PruneOrderSemver.
+	Order PruneOrder
+	// TagFilter decides like TagFilter.ShouldDelete: tags matching an exclude glob are deleted regardless of keep and MaxAge,
+	// tags matching an include glob are never deleted and do not count against keep.
+	TagFilter TagFilter
+	// MaxAge only deletes tags whose image is older, younger tags are kept in addition to keep.
+	// Zero deletes regardless of age. Tags without created date are kept.
+	MaxAge time.Duration
+	// DryRun only returns the tags that would be deleted. A client created with WithDryRun never deletes.
+	DryRun bool
+}
+
+// Prune keeps the newest keep tags of the repository and deletes the older ones by their manifest digest.
+// A manifest shared with a kept tag is not deleted, because that would remove the kept tag too.
+// The deleted tags are returned, errors of single tags are combined into the returned error.
+func (c *v2Client) Prune(ctx context.Context, repositoryName RepositoryName, keep int, options PruneOptions) ([]TagName, error) {
+	if keep < 0 {
+		return nil, errors.Errorf("invalid keep %d", keep)
+	}
+	if err := options.TagFilter.Validate(); err != nil {
+		return nil, err
+	}
+	dryRun := options.DryRun || c.dryRun
+	if !dryRun {
+		if err := c.checkDeleteSupported(ctx); err != nil {
+			return nil, err
+		}
+	}
+	tags, err := c.listAllTags(ctx, repositoryName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list tags of %s failed", repositoryName)
+	}
+	var kept, forced, candidates []TagName
+	for _, tag := range tags {
+		switch {
+		case options.TagFilter.Exclude.Match(tag):
+			forced = append(forced, tag)
+		case options.TagFilter.Include.Match(tag):
+			kept = append(kept, tag)
+		default:
+			candidates = append(candidates, tag)
+		}
+	}
+
+	var errs []error
+	var others []TagName
+	var created map[TagName]time.Time
+	switch options.Order {
+	case "", PruneOrderSemver:
+		candidates, others = pruneCandidatesBySemver(candidates)
+	case PruneOrderCreated:
+		candidates, others, created, errs = c.pruneCandidatesByCreated(ctx, repositoryName, candidates)
+	default:
+		return nil, errors.Errorf("unknown prune order '%s'", options.Order)
+	}
+	kept = append(kept, others...)
+	if len(candidates) <= keep {
+		kept = append(kept, candidates...)
+		candidates = nil
+	} else {
+		kept = append(kept, candidates[:keep]...)
+		candidates = candidates[keep:]
+	}
+	if options.MaxAge > 0 && len(candidates) > 0 {
+		var young []TagName
+		var ageErrs []error
+		candidates, young, ageErrs = c.pruneCandidatesOlderThan(ctx, repositoryName, candidates, created, time.Now().Add(-options.MaxAge))
+		kept = append(kept, young...)
+		errs = append(errs, ageErrs...)
+	}
+	candidates = append(forced, candidates...)
+	if len(candidates) == 0 {
+		c.debugf("%s has no tags to delete", repositoryName)
+		return []TagName{}, CombineErrors(errs)
+	}
+	deleted, deleteErrs, err := c.deleteTagsKeeping(ctx, repositoryName, kept, candidates, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	return deleted, CombineErrors(append(errs, deleteErrs...))
+}
+
+// deleteTagsKeeping deletes the manifests of the candidates, except manifests shared with a kept tag.
+// Tags sharing an already deleted manifest are returned as deleted without second request.
+// Without the digests of all kept tags nothing is deleted, because a deletion could remove a kept tag.
+func (c *v2Client) deleteTagsKeeping(ctx context.Context, repositoryName RepositoryName, kept []TagName, candidates []TagName, dryRun bool) ([]TagName, []error, error) {
+	keptDigests := make(map[Digest]TagName, len(kept))
+	for _, tag := range kept {
+		digest, err := c.Digest(ctx, repositoryName, tag)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "get digest of kept tag %s:%s failed", repositoryName, tag)
+		}
+		keptDigests[digest] = tag
+	}
+	var errs []error
+	deleted := []TagName{}
+	deletedDigests := make(map[Digest]bool)
+	for _, tag := range candidates {
+		digest, err := c.Digest(ctx, repositoryName, tag)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "get digest of %s:%s failed", repositoryName, tag))
+			continue
+		}
+		if keptTag, ok := keptDigests[digest]; ok {
+			c.infof("skip %s:%s, manifest %s is shared with kept tag %s", repositoryName, tag, digest, keptTag)
+			continue
+		}
+		if deletedDigests[digest] {
+			deleted = append(deleted, tag)
+			continue
+		}
+		if dryRun {
+			c.infof("dry run: would delete %s:%s (%s)", repositoryName, tag, digest)
+		} else if err := c.deleteManifest(ctx, repositoryName, tag, digest); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		c.plannedDelete(repositoryName, tag, digest, dryRun)
+		deletedDigests[digest] = true
+		deleted = append(deleted, tag)
+	}
+	return deleted, errs, nil
+}
+
+// pruneCandidatesBySemver returns the semver tags newest first and all other tags.
+func pruneCandidatesBySemver(tags []TagName) ([]TagName, []TagName) {
+	var candidates, others []TagName
+	for _, tag := range tags {
+		if _, ok := ParseSemver(tag); ok {
+			candidates = append(candidates, tag)
+		} else {
+			others = append(others, tag)
+		}
+	}
+	SortTagsBySemver(candidates)
+	return candidates, others
+}
+
+// pruneCandidatesOlderThan returns the tags created before the given time and the other tags.
+// created dates already known are reused, tags without or with unknown created date are kept.
+func (c *v2Client) pruneCandidatesOlderThan(ctx context.Context, repositoryName RepositoryName, tags []TagName, created map[TagName]time.Time, before time.Time) ([]TagName, []TagName, []error) {
+	var candidates, others []TagName
+	var errs []error
+	for _, tag := range tags {
+		t, ok := created[tag]
+		if !ok {
+			var err error
+			t, err = c.Created(ctx, repositoryName, tag)
+			if err != nil {
+				errs = append(errs, errors.Wrapf(err, "get created of %s:%s failed", repositoryName, tag))
+				others = append(others, tag)
+				continue
+			}
+		}
+		if t.IsZero() || !t.Before(before) {
+			others = append(others, tag)
+			continue
+		}
+		candidates = append(candidates, tag)
+	}
+	return candidates, others, errs
+}
+
+// pruneCandidatesByCreated returns the tags newest first, the tags without created date and the created dates.
+// Tags whose created date could not be fetched are kept and their errors returned.
+func (c *v2Client) pruneCandidatesByCreated(ctx context.Context, repositoryName RepositoryName, tags []TagName) ([]TagName, []TagName, map[TagName]time.Time, []error) {
+	var candidates, others []TagName
+	var errs []error
+	created := make(map[TagName]time.Time, len(tags))
+	for _, tag := range tags {
+		t, err := c.Created(ctx, repositoryName, tag)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "get created of %s:%s failed", repositoryName, tag))
+			others = append(others, tag)
+			continue
+		}
+		if t.IsZero() {
+			others = append(others, tag)
+			continue
+		}
+		created[tag] = t
+		candidates = append(candidates, tag)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return created[candidates[i]].After(created[candidates[j]])
+	})
+	return candidates, others, created, errs
+}
@@ -0,0 +1,109 @@
+package docker_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/bborbe/docker-utils"
+	"github.com/bborbe/docker-utils/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Prune", func() {
+	var registry *fake.Registry
+	var options docker.PruneOptions
+	BeforeEach(func() {
+		registry = fake.NewRegistry(map[docker.RepositoryName][]docker.TagName{
+			"team/app": {"1.0.0", "1.1.0", "1.2.0", "2.0.0-rc.1", "latest"},
+		})
+		options = docker.PruneOptions{}
+	})
+	prune := func(keep int, clientOptions ...docker.ClientOption) []docker.TagName {
+		deleted, err := registry.NewV2Client(clientOptions...).Prune(context.Background(), "team/app", keep, options)
+		Expect(err).To(BeNil())
+		return deleted
+	}
+	It("keeps the newest semver tags and all other tags", func() {
+		Expect(prune(2)).To(Equal([]docker.TagName{"1.1.0", "1.0.0"}))
+		Expect(registry.Repositories()["team/app"]).To(Equal([]docker.TagName{"1.2.0", "2.0.0-rc.1", "latest"}))
+	})
+	It("deletes nothing if there are not more tags than keep", func() {
+		Expect(prune(4)).To(BeEmpty())
+		Expect(registry.Repositories()["team/app"]).To(HaveLen(5))
+	})
+	It("never deletes tags matching a keep pattern", func() {
+		options.TagFilter.Include = docker.TagPatterns{"1.0.*"}
+		Expect(prune(1)).To(Equal([]docker.TagName{"1.2.0", "1.1.0"}))
+		Expect(registry.Repositories()["team/app"]).To(Equal([]docker.TagName{"1.0.0", "2.0.0-rc.1", "latest"}))
+	})
+	It("combines multiple keep patterns", func() {
+		options.TagFilter.Include = docker.TagPatterns{"1.0.*", "1.1.*"}
+		Expect(prune(0)).To(Equal([]docker.TagName{"2.0.0-rc.1", "1.2.0"}))
+		Expect(registry.Repositories()["team/app"]).To(Equal([]docker.TagName{"1.0.0", "1.1.0", "latest"}))
+	})
+	It("deletes tags matching a delete pattern regardless of keep", func() {
+		options.TagFilter.Include = docker.TagPatterns{"*"}
+		options.TagFilter.Exclude = docker.TagPatterns{"*-rc.*"}
+		Expect(prune(10)).To(Equal([]docker.TagName{"2.0.0-rc.1"}))
+		Expect(registry.Repositories()["team/app"]).To(Equal([]docker.TagName{"1.0.0", "1.1.0", "1.2.0", "latest"}))
+	})
+	It("rejects invalid patterns", func() {
+		options.TagFilter.Include = docker.TagPatterns{"["}
+		_, err := registry.NewV2Client().Prune(context.Background(), "team/app", 1, options)
+		Expect(err).NotTo(BeNil())
+	})
+	It("only returns the tags on dry run", func() {
+		options.DryRun = true
+		Expect(prune(3)).To(Equal([]docker.TagName{"1.0.0"}))
+		Expect(registry.Repositories()["team/app"]).To(HaveLen(5))
+	})
+	It("respects the dry run client option", func() {
+		Expect(prune(3, docker.WithDryRun(true))).To(Equal([]docker.TagName{"1.0.0"}))
+		Expect(registry.Repositories()["team/app"]).To(HaveLen(5))
+	})
+	It("orders by created date of the image config", func() {
+		now := time.Now()
+		registry = fake.NewRegistry(map[docker.RepositoryName][]docker.TagName{})
+		registry.AddTag("team/app", "build-1", now.Add(-3*time.Hour))
+		registry.AddTag("team/app", "build-2", now.Add(-1*time.Hour))
+		registry.AddTag("team/app", "build-3", now.Add(-2*time.Hour))
+		registry.AddTags("team/app", "unknown")
+		options.Order = docker.PruneOrderCreated
+		Expect(prune(1)).To(Equal([]docker.TagName{"build-3", "build-1"}))
+		Expect(registry.Repositories()["team/app"]).To(Equal([]docker.TagName{"build-2", "unknown"}))
+	})
+	Context("with max age", func() {
+		BeforeEach(func() {
+			now := time.Now()
+			registry = fake.NewRegistry(map[docker.RepositoryName][]docker.TagName{})
+			registry.AddTag("team/app", "1.0.0", now.Add(-100*24*time.Hour))
+			registry.AddTag("team/app", "1.1.0", now.Add(-10*24*time.Hour))
+			registry.AddTag("team/app", "1.2.0", now.Add(-24*time.Hour))
+			registry.AddTags("team/app", "1.3.0")
+			options.MaxAge = 30 * 24 * time.Hour
+		})
+		It("only deletes tags older than max age", func() {
+			Expect(prune(0)).To(Equal([]docker.TagName{"1.0.0"}))
+			Expect(registry.Repositories()["team/app"]).To(Equal([]docker.TagName{"1.1.0", "1.2.0", "1.3.0"}))
+		})
+		It("keeps the newest tags even if old", func() {
+			options.MaxAge = time.Hour
+			Expect(prune(3)).To(Equal([]docker.TagName{"1.0.0"}))
+		})
+		It("combines with created order", func() {
+			options.Order = docker.PruneOrderCreated
+			Expect(prune(1)).To(Equal([]docker.TagName{"1.0.0"}))
+			Expect(registry.Repositories()["team/app"]).To(Equal([]docker.TagName{"1.1.0", "1.2.0", "1.3.0"}))
+		})
+	})
+	It("rejects negative keep", func() {
+		_, err := registry.NewV2Client().Prune(context.Background(), "team/app", -1, options)
+		Expect(err).NotTo(BeNil())
+	})
+	It("rejects unknown order", func() {
+		options.Order = "random"
+		_, err := registry.NewV2Client().Prune(context.Background(), "team/app", 1, options)
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,13 @@
+package docker
+
+// QuayDomain is the host of quay.io.
+const QuayDomain = "quay.io"
+
+// QuayOAuthUsername is the username quay.io expects if an OAuth access token is used as password.
+// Robot accounts use their name like org+robot and their token as password instead.
+const QuayOAuthUsername = "$oauthtoken"
+
+// IsQuay returns true if the registry is quay.io.
+func (r Registry) IsQuay() bool {
+	return r.host() == QuayDomain
+}
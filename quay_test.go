@@ -0,0 +1,59 @@
+package docker_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Quay", func() {
+	It("detects quay.io", func() {
+		Expect(docker.Registry{Url: "https://quay.io"}.IsQuay()).To(BeTrue())
+		Expect(docker.Registry{Url: "registry.example.com"}.IsQuay()).To(BeFalse())
+	})
+	Context("like quay.io", func() {
+		var server *httptest.Server
+		var client docker.V2Client
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/v2/auth":
+					if username, password, _ := req.BasicAuth(); username != "org+robot" || password != "robot-token" {
+						resp.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					fmt.Fprint(resp, `{"token":"quay-token"}`)
+				case "/v2/org/app/tags/list":
+					if req.Header.Get("Authorization") != "Bearer quay-token" {
+						resp.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/v2/auth",service="quay.io",scope="repository:org/app:pull"`, server.URL))
+						resp.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					fmt.Fprint(resp, `{"name":"org/app","tags":["latest"]}`)
+				default:
+					resp.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			client = docker.NewV2Client(docker.NewHttpClient(server.Client()), docker.Registry{Url: server.URL, Username: "org+robot", Password: "robot-token"})
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("lists tags with robot account", func() {
+			tags, err := client.ListTagsSortedSemver(context.Background(), "org/app")
+			Expect(err).To(BeNil())
+			Expect(tags).To(Equal([]docker.TagName{"latest"}))
+		})
+		It("explains a disabled catalog", func() {
+			err := client.ListRepositories(context.Background(), make(chan docker.RepositoryName, 10))
+			Expect(errors.Cause(err)).To(Equal(docker.ErrNotFound))
+			Expect(err.Error()).To(ContainSubstring("does not serve the _catalog api"))
+		})
+	})
+})
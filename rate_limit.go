@@ -0,0 +1,115 @@
+package docker
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RateLimit as reported by the RateLimit-Limit and RateLimit-Remaining headers of Docker Hub.
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Window    time.Duration
+}
+
+// String returns remaining=76 limit=100 window=6h0m0s.
+func (r RateLimit) String() string {
+	return fmt.Sprintf("remaining=%d limit=%d window=%v", r.Remaining, r.Limit, r.Window)
+}
+
+// rateLimitRecorder keeps the rate limit reported by the last response carrying the headers.
+type rateLimitRecorder struct {
+	mux       sync.Mutex
+	rateLimit *RateLimit
+}
+
+func (r *rateLimitRecorder) record(header http.Header) {
+	if header.Get("RateLimit-Limit") == "" && header.Get("RateLimit-Remaining") == "" {
+		return
+	}
+	rateLimit := ParseRateLimit(header)
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.rateLimit = &rateLimit
+}
+
+// LastRateLimit returns the rate limit of the last response and false if no response reported one.
+func (r *rateLimitRecorder) LastRateLimit() (RateLimit, bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.rateLimit == nil {
+		return RateLimit{}, false
+	}
+	return *r.rateLimit, true
+}
+
+// ParseRateLimit reads headers like "RateLimit-Limit: 100;w=21600".
+func ParseRateLimit(header http.Header) RateLimit {
+	var rateLimit RateLimit
+	rateLimit.Limit, rateLimit.Window = parseRateLimitValue(header.Get("RateLimit-Limit"))
+	rateLimit.Remaining, _ = parseRateLimitValue(header.Get("RateLimit-Remaining"))
+	return rateLimit
+}
+
+func parseRateLimitValue(value string) (int, time.Duration) {
+	parts := strings.Split(value, ";")
+	count, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0
+	}
+	var window time.Duration
+	for _, part := range parts[1:] {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "w=") {
+			seconds, err := strconv.Atoi(strings.TrimPrefix(part, "w="))
+			if err == nil {
+				window = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return count, window
+}
+
+// ParseRetryAfter reads the Retry-After header given as seconds or as http date.
+func ParseRetryAfter(header http.Header, now time.Time) time.Duration {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// ErrRateLimited is returned if the registry responds with 429 Too Many Requests.
+type ErrRateLimited struct {
+	RetryAfter time.Duration
+	RateLimit  RateLimit
+}
+
+func (e *ErrRateLimited) Error() string {
+	return fmt.Sprintf("rate limited, retry after %v (remaining %d of %d)", e.RetryAfter, e.RateLimit.Remaining, e.RateLimit.Limit)
+}
+
+func newErrRateLimited(resp *http.Response) *ErrRateLimited {
+	return &ErrRateLimited{
+		RetryAfter: ParseRetryAfter(resp.Header, time.Now()),
+		RateLimit:  ParseRateLimit(resp.Header),
+	}
+}
+
+// IsRateLimited returns the ErrRateLimited cause of the given error.
+func IsRateLimited(err error) (*ErrRateLimited, bool) {
+	rateLimited, ok := errors.Cause(err).(*ErrRateLimited)
+	return rateLimited, ok
+}
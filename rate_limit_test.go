@@ -0,0 +1,74 @@
+package docker_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RateLimit", func() {
+	It("parses rate limit headers", func() {
+		header := http.Header{}
+		header.Set("RateLimit-Limit", "100;w=21600")
+		header.Set("RateLimit-Remaining", "76;w=21600")
+		Expect(docker.ParseRateLimit(header)).To(Equal(docker.RateLimit{
+			Limit:     100,
+			Remaining: 76,
+			Window:    6 * time.Hour,
+		}))
+	})
+	It("formats rate limit", func() {
+		Expect(docker.RateLimit{Limit: 100, Remaining: 76, Window: 6 * time.Hour}.String()).To(Equal("remaining=76 limit=100 window=6h0m0s"))
+	})
+	It("parses retry after seconds", func() {
+		header := http.Header{}
+		header.Set("Retry-After", "120")
+		Expect(docker.ParseRetryAfter(header, time.Now())).To(Equal(2 * time.Minute))
+	})
+	It("parses retry after date", func() {
+		now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+		header := http.Header{}
+		header.Set("Retry-After", now.Add(time.Minute).Format(http.TimeFormat))
+		Expect(docker.ParseRetryAfter(header, now)).To(Equal(time.Minute))
+	})
+	It("returns ErrRateLimited on 429", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Retry-After", "30")
+			resp.Header().Set("RateLimit-Limit", "100;w=21600")
+			resp.Header().Set("RateLimit-Remaining", "0;w=21600")
+			resp.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		Expect(err).To(BeNil())
+		_, err = docker.NewHttpClient(server.Client()).DoSuccess(context.Background(), req)
+		rateLimited, ok := docker.IsRateLimited(err)
+		Expect(ok).To(BeTrue())
+		Expect(rateLimited.RetryAfter).To(Equal(30 * time.Second))
+		Expect(rateLimited.RateLimit.Remaining).To(Equal(0))
+		Expect(docker.ExitCode(err)).To(Equal(docker.ExitCodeUnavailable))
+	})
+	It("returns ErrRateLimited if retry after exceeds the timeout of the retrying client", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Retry-After", "3600")
+			resp.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+		client, err := docker.NewHttpClientBuilder().
+			WithRetry(3, time.Second).
+			WithTimeout(2 * time.Second).
+			Build()
+		Expect(err).To(BeNil())
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		Expect(err).To(BeNil())
+		_, err = docker.NewHttpClient(client).DoSuccess(context.Background(), req)
+		rateLimited, ok := docker.IsRateLimited(err)
+		Expect(ok).To(BeTrue())
+		Expect(rateLimited.RetryAfter).To(Equal(time.Hour))
+	})
+})
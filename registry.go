@@ -2,7 +2,12 @@ package docker
 
 import (
 	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -11,6 +16,137 @@ type Registry struct {
 	Url      string
 	Username string
 	Password string
+	// Insecure talks plain http to the registry, e.g. a local registry on localhost:5000.
+	Insecure bool
+	// AuthUrl is the login endpoint of the DockerHubClient for Docker Hub compatible services, see LoginUrl.
+	AuthUrl string
+	// PasswordExpires is set for short-lived passwords like ECR tokens, the V2Client renews them shortly before.
+	PasswordExpires time.Time
+	// Anonymous never sends the credentials, e.g. to check what is visible to the public.
+	Anonymous bool
+}
+
+// DefaultDockerHubLoginUrl is the login endpoint of hub.docker.com exchanging username and password for a jwt.
+const DefaultDockerHubLoginUrl = "https://hub.docker.com/v2/users/login/"
+
+// LoginUrl returns AuthUrl or DefaultDockerHubLoginUrl if it is not configured.
+func (r Registry) LoginUrl() string {
+	if r.AuthUrl != "" {
+		return r.AuthUrl
+	}
+	return DefaultDockerHubLoginUrl
+}
+
+// BaseUrl returns the url requests are send to. A missing scheme defaults to https,
+// or http if the registry is insecure or on a loopback host like localhost:5000, which docker treats as insecure too.
+// Docker Hub is always reached by https://registry-1.docker.io.
+func (r Registry) BaseUrl() string {
+	scheme := "https"
+	host := strings.TrimRight(r.Url, "/")
+	if i := strings.Index(host, "://"); i != -1 {
+		scheme = host[:i]
+		host = host[i+3:]
+	} else if isLoopbackHost(host) {
+		scheme = "http"
+	}
+	switch host {
+	case DockerHubDomain, "index.docker.io", "registry-1.docker.io":
+		return "https://registry-1.docker.io"
+	}
+	if r.Insecure {
+		scheme = "http"
+	}
+	return scheme + "://" + host
+}
+
+// isLoopbackHost returns true for localhost and loopback ips with optional port.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// IsDockerHub returns true if the registry is Docker Hub, given as docker.io, index.docker.io or registry-1.docker.io.
+func (r Registry) IsDockerHub() bool {
+	return r.BaseUrl() == "https://registry-1.docker.io"
+}
+
+var registryHostRegexp = regexp.MustCompile(`^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*(?::[0-9]{1,5})?$|^\[[0-9a-fA-F:.]+\](?::[0-9]{1,5})?$`)
+
+// Validate accepts host[:port] with optional http or https scheme and trailing slash, like docker.io or http://localhost:5000/.
+// Other schemes, paths and whitespace are rejected. Credentials are optional, see IsAnonymous.
+func (r Registry) Validate() error {
+	if r.Url == "" {
+		return errors.New("registry url is empty")
+	}
+	if strings.TrimSpace(r.Url) != r.Url || strings.ContainsAny(r.Url, " \t\r\n") {
+		return errors.Errorf("registry url '%s' contains whitespace", r.Url)
+	}
+	host := strings.TrimSuffix(r.Url, "/")
+	if i := strings.Index(host, "://"); i != -1 {
+		if scheme := host[:i]; scheme != "http" && scheme != "https" {
+			return errors.Errorf("registry url '%s' has unsupported scheme %s", r.Url, scheme)
+		}
+		host = host[i+3:]
+	}
+	if strings.Contains(host, "/") {
+		return errors.Errorf("registry url '%s' must not contain a path", r.Url)
+	}
+	if !registryHostRegexp.MatchString(host) {
+		return errors.Errorf("registry url '%s' is not a valid host[:port]", r.Url)
+	}
+	if r.AuthUrl != "" {
+		if u, err := url.Parse(r.AuthUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Errorf("auth url '%s' is not a valid http or https url", r.AuthUrl)
+		}
+	}
+	return nil
+}
+
+// IsAnonymous returns true if Anonymous is set or username or password is missing.
+// Anonymous requests carry no Authorization header and bearer challenges are completed with a token request without credentials,
+// which is enough to pull public images from registries like gcr.io or public Harbor projects.
+func (r Registry) IsAnonymous() bool {
+	return r.Anonymous || r.Username == "" || r.Password == ""
+}
+
+// tokenCacheUsername keeps tokens of anonymous requests apart from the tokens of the user.
+func (r Registry) tokenCacheUsername() string {
+	if r.IsAnonymous() {
+		return ""
+	}
+	return r.Username
+}
+
+// host returns the host of the registry url without scheme and path.
+func (r Registry) host() string {
+	host := r.Url
+	if strings.Contains(host, "://") {
+		if u, err := url.Parse(host); err == nil {
+			host = u.Host
+		}
+	}
+	return strings.SplitN(host, "/", 2)[0]
+}
+
+// DefaultPasswordEnv is the environment variable the commands read the password from if no password is given.
+const DefaultPasswordEnv = "DOCKER_PASSWORD"
+
+// RegistryPasswordFromEnv sets the password from the named environment variable.
+// Surrounding whitespace is trimmed, an unset or empty variable returns ErrNotFound.
+func (r *Registry) RegistryPasswordFromEnv(name string) error {
+	password := strings.TrimSpace(os.Getenv(name))
+	if password == "" {
+		return errors.Wrapf(ErrNotFound, "environment variable %s is unset or empty", name)
+	}
+	r.Password = password
+	return nil
 }
 
 func (r *Registry) RegistryPasswordFromFile(path string) error {
@@ -21,3 +157,68 @@ func (r *Registry) RegistryPasswordFromFile(path string) error {
 	r.Password = strings.TrimSpace(string(content))
 	return nil
 }
+
+// CredentialOptions are the sources of ResolveCredentials besides the cloud providers, empty values are skipped.
+type CredentialOptions struct {
+	PasswordFile string
+	// PasswordEnv is read if neither password nor password file is given.
+	// Only a variable other than DefaultPasswordEnv must be set.
+	PasswordEnv string
+	// DockerConfig is the path of the docker config, if empty the config at DockerConfigPath is used if it exists.
+	DockerConfig string
+}
+
+// ResolveCredentials completes the credentials like the commands do, anonymous registries are left untouched.
+// The password is read from the file or environment, a missing username from the given or default docker config,
+// then from ECR, Google, Azure or GitHub. Failing ECR is an error, the others continue anonymous.
+func (r *Registry) ResolveCredentials(opts CredentialOptions) error {
+	if r.Anonymous {
+		return nil
+	}
+	if len(opts.PasswordFile) > 0 {
+		if err := r.RegistryPasswordFromFile(opts.PasswordFile); err != nil {
+			return err
+		}
+	}
+	if len(r.Password) == 0 && len(opts.PasswordEnv) > 0 {
+		if err := r.RegistryPasswordFromEnv(opts.PasswordEnv); err != nil && opts.PasswordEnv != DefaultPasswordEnv {
+			return err
+		}
+	}
+	if len(opts.DockerConfig) > 0 && len(r.Username) == 0 {
+		if err := r.CredentialsFromDockerConfig(opts.DockerConfig); err != nil {
+			return errors.Wrap(err, "read credentials from docker config failed")
+		}
+	}
+	if len(opts.DockerConfig) == 0 && len(r.Username) == 0 {
+		if err := r.CredentialsFromDefaultDockerConfig(); err != nil {
+			cause := errors.Cause(err)
+			if cause == ErrNotFound || os.IsNotExist(cause) {
+				debugf("no credentials in default docker config: %v", err)
+			} else {
+				warningf("read credentials from default docker config failed, continue: %v", err)
+			}
+		}
+	}
+	if len(r.Username) == 0 && r.IsECR() {
+		if err := r.CredentialsFromECR(); err != nil {
+			return errors.Wrap(err, "get ecr credentials failed")
+		}
+	}
+	if len(r.Username) == 0 && r.IsGoogle() {
+		if err := r.CredentialsFromGoogle(); err != nil {
+			warningf("get google credentials failed, continue anonymous: %v", err)
+		}
+	}
+	if len(r.Username) == 0 && r.IsAzure() {
+		if err := r.CredentialsFromAzure(); err != nil {
+			warningf("get azure credentials failed, continue anonymous: %v", err)
+		}
+	}
+	if len(r.Username) == 0 && r.IsGitHub() {
+		if err := r.CredentialsFromGitHub(); err != nil {
+			warningf("get github credentials failed, continue anonymous: %v", err)
+		}
+	}
+	return nil
+}
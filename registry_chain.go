@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// RegistryChain asks an ordered list of registries, e.g. a pull-through mirror before its upstream.
+// The next registry is only asked if the previous one does not know the repository or tag or is not reachable.
+// Authentication errors are returned immediately, falling back would hide the wrong credentials.
+type RegistryChain interface {
+	ListRepositories(ctx context.Context) ([]RepositoryName, error)
+	ListTags(ctx context.Context, repositoryName RepositoryName) ([]TagName, error)
+	Digest(ctx context.Context, repositoryName RepositoryName, tag TagName) (Digest, error)
+}
+
+func NewRegistryChain(
+	httpClient HttpClient,
+	registries []Registry,
+	options ...ClientOption,
+) RegistryChain {
+	chain := &registryChain{
+		registries: registries,
+		logger:     newClientOptions(options).logger,
+	}
+	for _, registry := range registries {
+		chain.clients = append(chain.clients, NewV2Client(httpClient, registry, options...))
+	}
+	return chain
+}
+
+type registryChain struct {
+	registries []Registry
+	clients    []V2Client
+	logger     Logger
+}
+
+func (r *registryChain) ListRepositories(ctx context.Context) ([]RepositoryName, error) {
+	var result []RepositoryName
+	err := r.each(ctx, "list repositories", func(client V2Client) error {
+		repositories := make(chan RepositoryName)
+		var err error
+		go func() {
+			defer close(repositories)
+			err = client.ListRepositories(ctx, repositories)
+		}()
+		result = []RepositoryName{}
+		for repositoryName := range repositories {
+			result = append(result, repositoryName)
+		}
+		return err
+	})
+	return result, err
+}
+
+func (r *registryChain) ListTags(ctx context.Context, repositoryName RepositoryName) ([]TagName, error) {
+	var result []TagName
+	err := r.each(ctx, "list tags of "+repositoryName.String(), func(client V2Client) error {
+		tags := make(chan TagName)
+		var err error
+		go func() {
+			defer close(tags)
+			err = client.ListTags(ctx, repositoryName, tags)
+		}()
+		result = []TagName{}
+		for tag := range tags {
+			result = append(result, tag)
+		}
+		return err
+	})
+	return result, err
+}
+
+func (r *registryChain) Digest(ctx context.Context, repositoryName RepositoryName, tag TagName) (Digest, error) {
+	var result Digest
+	err := r.each(ctx, "get digest of "+repositoryName.String()+":"+tag.String(), func(client V2Client) error {
+		var err error
+		result, err = client.Digest(ctx, repositoryName, tag)
+		return err
+	})
+	return result, err
+}
+
+// each calls fn with the clients in order until one succeeds or fails with an error not allowing a fallback.
+// The error of the last asked registry is returned.
+func (r *registryChain) each(ctx context.Context, operation string, fn func(client V2Client) error) error {
+	if len(r.clients) == 0 {
+		return errors.Wrap(ErrUsage, "registry chain is empty")
+	}
+	for i, client := range r.clients {
+		err := fn(client)
+		if err == nil {
+			return nil
+		}
+		if i == len(r.clients)-1 || ctx.Err() != nil || !allowsFallback(err) {
+			return errors.Wrapf(err, "%s on %s failed", operation, r.registries[i].Url)
+		}
+		infofWith(r.logger, "%s on %s failed, try %s: %v", operation, r.registries[i].Url, r.registries[i+1].Url, err)
+	}
+	return nil
+}
+
+// allowsFallback returns true for missing repositories or tags and unreachable registries.
+func allowsFallback(err error) bool {
+	cause := errors.Cause(err)
+	switch cause {
+	case ErrNotFound, ErrUnavailable:
+		return true
+	}
+	if _, ok := cause.(*ErrRateLimited); ok {
+		return true
+	}
+	_, ok := cause.(net.Error)
+	return ok
+}
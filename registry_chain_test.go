@@ -0,0 +1,70 @@
+package docker_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/bborbe/docker-utils"
+	"github.com/bborbe/docker-utils/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RegistryChain", func() {
+	var mirror, upstream *httptest.Server
+	var registries []docker.Registry
+	BeforeEach(func() {
+		mirror = fake.NewRegistry(map[docker.RepositoryName][]docker.TagName{
+			"library/app": {"1.0.0"},
+		}).NewServer()
+		upstream = fake.NewRegistry(map[docker.RepositoryName][]docker.TagName{
+			"library/app": {"1.0.0", "1.1.0"},
+			"library/db":  {"latest"},
+		}).WithBearerAuth("user", "secret").NewServer()
+		registries = []docker.Registry{
+			{Url: mirror.URL, Username: "user", Password: "secret"},
+			{Url: upstream.URL, Username: "user", Password: "secret"},
+		}
+	})
+	AfterEach(func() {
+		mirror.Close()
+		upstream.Close()
+	})
+	chain := func() docker.RegistryChain {
+		return docker.NewRegistryChain(docker.NewHttpClient(http.DefaultClient), registries)
+	}
+	It("uses the first registry knowing the repository", func() {
+		tags, err := chain().ListTags(context.Background(), "library/app")
+		Expect(err).To(BeNil())
+		Expect(tags).To(Equal([]docker.TagName{"1.0.0"}))
+	})
+	It("falls back if the repository is not found", func() {
+		tags, err := chain().ListTags(context.Background(), "library/db")
+		Expect(err).To(BeNil())
+		Expect(tags).To(Equal([]docker.TagName{"latest"}))
+	})
+	It("falls back if the tag is not found", func() {
+		digest, err := chain().Digest(context.Background(), "library/app", "1.1.0")
+		Expect(err).To(BeNil())
+		Expect(digest.Validate()).To(BeNil())
+	})
+	It("falls back if the registry is not reachable", func() {
+		mirror.Close()
+		repositories, err := chain().ListRepositories(context.Background())
+		Expect(err).To(BeNil())
+		Expect(repositories).To(Equal([]docker.RepositoryName{"library/app", "library/db"}))
+	})
+	It("returns not found if no registry knows the tag", func() {
+		_, err := chain().Digest(context.Background(), "library/app", "2.0.0")
+		Expect(docker.IsNotFound(err)).To(BeTrue())
+	})
+	It("returns auth errors without fallback", func() {
+		registries = []docker.Registry{
+			{Url: upstream.URL, Username: "user", Password: "wrong"},
+			{Url: mirror.URL},
+		}
+		_, err := chain().ListTags(context.Background(), "library/app")
+		Expect(docker.IsUnauthorized(err)).To(BeTrue())
+	})
+})
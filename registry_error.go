@@ -0,0 +1,122 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorCodeManifestUnknown is the code of the error body for a missing manifest or tag.
+const ErrorCodeManifestUnknown = "MANIFEST_UNKNOWN"
+
+// RegistryError is returned for non-2xx responses of the registry or its token server.
+// Its cause is the matching sentinel like ErrNotFound, so errors.Cause and ExitCode keep working.
+// errors.Is and errors.As of the standard library match it against the cause and ErrManifestUnknown.
+type RegistryError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	// Errors is the parsed error body {"errors":[{"code":"...","message":"..."}]} if the registry sent one.
+	Errors []RegistryErrorDetail
+	cause  error
+}
+
+// RegistryErrorDetail is one entry of the error body defined by the distribution spec, e.g. MANIFEST_UNKNOWN.
+type RegistryErrorDetail struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Detail  json.RawMessage `json:"detail,omitempty"`
+}
+
+func newRegistryError(req *http.Request, resp *http.Response, body []byte) *RegistryError {
+	registryError := &RegistryError{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		cause:      errorForStatusCode(req.Method, resp.StatusCode),
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		registryError.cause = newErrRateLimited(resp)
+	}
+	var data struct {
+		Errors []RegistryErrorDetail `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &data); err == nil {
+		registryError.Errors = data.Errors
+	}
+	return registryError
+}
+
+func (r *RegistryError) Error() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%s request to %s failed with statusCode %d", r.Method, r.URL, r.StatusCode)
+	for _, detail := range r.Errors {
+		fmt.Fprintf(&builder, ": %s %s", detail.Code, detail.Message)
+	}
+	fmt.Fprintf(&builder, ": %v", r.cause)
+	return builder.String()
+}
+
+// Cause returns the sentinel error of the status code.
+func (r *RegistryError) Cause() error {
+	return r.cause
+}
+
+// Unwrap returns the cause for errors.Is and errors.As of the standard library.
+func (r *RegistryError) Unwrap() error {
+	return r.cause
+}
+
+// Is reports ErrManifestUnknown for errors with code MANIFEST_UNKNOWN, other sentinels are matched by the cause.
+func (r *RegistryError) Is(target error) bool {
+	return target == ErrManifestUnknown && r.HasCode(ErrorCodeManifestUnknown)
+}
+
+// HasCode returns true if the registry reported the given error code, e.g. MANIFEST_UNKNOWN.
+func (r *RegistryError) HasCode(code string) bool {
+	for _, detail := range r.Errors {
+		if detail.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// AsRegistryError returns the RegistryError in the cause chain of the given error.
+func AsRegistryError(err error) (*RegistryError, bool) {
+	type causer interface {
+		Cause() error
+	}
+	for err != nil {
+		if registryError, ok := err.(*RegistryError); ok {
+			return registryError, true
+		}
+		cause, ok := err.(causer)
+		if !ok {
+			return nil, false
+		}
+		err = cause.Cause()
+	}
+	return nil, false
+}
+
+// IsNotFound returns true if the error is caused by a missing repository, tag or manifest.
+func IsNotFound(err error) bool {
+	return errors.Cause(err) == ErrNotFound
+}
+
+// IsManifestUnknown returns true if the registry reported MANIFEST_UNKNOWN,
+// unlike IsNotFound it is false for missing repositories or blobs.
+// It follows the cause chain of errors.Wrap, which errors.Is(err, ErrManifestUnknown) does not.
+func IsManifestUnknown(err error) bool {
+	registryError, ok := AsRegistryError(err)
+	return ok && registryError.HasCode(ErrorCodeManifestUnknown)
+}
+
+// IsUnauthorized returns true if the error is caused by missing or rejected credentials.
+func IsUnauthorized(err error) bool {
+	return errors.Cause(err) == ErrUnauthorized
+}
@@ -0,0 +1,192 @@
+package docker_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/bborbe/docker-utils"
+	"github.com/bborbe/docker-utils/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Registry", func() {
+	type entry struct {
+		name     string
+		registry docker.Registry
+		expected string
+	}
+	for _, e := range []entry{
+		{name: "defaults to https", registry: docker.Registry{Url: "registry.example.com"}, expected: "https://registry.example.com"},
+		{name: "keeps explicit scheme", registry: docker.Registry{Url: "http://localhost:5000/"}, expected: "http://localhost:5000"},
+		{name: "uses http if insecure", registry: docker.Registry{Url: "localhost:5000", Insecure: true}, expected: "http://localhost:5000"},
+		{name: "uses http if insecure with https scheme", registry: docker.Registry{Url: "https://localhost:5000", Insecure: true}, expected: "http://localhost:5000"},
+		{name: "uses http for localhost", registry: docker.Registry{Url: "localhost:5000"}, expected: "http://localhost:5000"},
+		{name: "uses http for loopback ip", registry: docker.Registry{Url: "127.0.0.1:5000"}, expected: "http://127.0.0.1:5000"},
+		{name: "uses http for loopback ipv6", registry: docker.Registry{Url: "[::1]:5000"}, expected: "http://[::1]:5000"},
+		{name: "keeps https of localhost", registry: docker.Registry{Url: "https://localhost:5000"}, expected: "https://localhost:5000"},
+		{name: "uses docker hub", registry: docker.Registry{Url: "docker.io"}, expected: "https://registry-1.docker.io"},
+		{name: "uses https for docker hub even if insecure", registry: docker.Registry{Url: "http://registry-1.docker.io", Insecure: true}, expected: "https://registry-1.docker.io"},
+	} {
+		e := e
+		It(e.name, func() {
+			Expect(e.registry.BaseUrl()).To(Equal(e.expected))
+		})
+	}
+	Context("Validate", func() {
+		for _, url := range []string{"docker.io", "registry.example.com", "localhost:5000", "http://localhost:5000/", "https://registry-1.docker.io", "127.0.0.1:5000", "[::1]:5000"} {
+			url := url
+			It("accepts "+url, func() {
+				Expect(docker.Registry{Url: url}.Validate()).To(BeNil())
+			})
+		}
+		for _, url := range []string{"", " registry.example.com", "registry example.com", "ftp://registry.example.com", "registry.example.com/path", "https://registry.example.com/v2/", "registry.example.com:port", "-registry.example.com"} {
+			url := url
+			It("rejects '"+url+"'", func() {
+				Expect(docker.Registry{Url: url}.Validate()).NotTo(BeNil())
+			})
+		}
+		It("accepts an auth url", func() {
+			Expect(docker.Registry{Url: "docker.io", AuthUrl: "https://hub.example.com/v2/users/login/"}.Validate()).To(BeNil())
+		})
+		It("rejects an invalid auth url", func() {
+			Expect(docker.Registry{Url: "docker.io", AuthUrl: "hub.example.com/login"}.Validate()).NotTo(BeNil())
+		})
+	})
+	It("uses the hub.docker.com login without auth url", func() {
+		Expect(docker.Registry{Url: "docker.io"}.LoginUrl()).To(Equal(docker.DefaultDockerHubLoginUrl))
+		Expect(docker.Registry{Url: "docker.io", AuthUrl: "https://hub.example.com/login"}.LoginUrl()).To(Equal("https://hub.example.com/login"))
+	})
+	It("normalizes single segment docker hub repositories", func() {
+		for _, url := range []string{"docker.io", "index.docker.io", "https://registry-1.docker.io"} {
+			Expect(docker.RepositoryName("nginx").Normalize(docker.Registry{Url: url})).To(Equal(docker.RepositoryName("library/nginx")))
+			Expect(docker.RepositoryName("bborbe/app").Normalize(docker.Registry{Url: url})).To(Equal(docker.RepositoryName("bborbe/app")))
+		}
+	})
+	It("leaves repositories of other registries unchanged", func() {
+		Expect(docker.RepositoryName("nginx").Normalize(docker.Registry{Url: "registry.example.com"})).To(Equal(docker.RepositoryName("nginx")))
+	})
+	It("is anonymous without complete credentials", func() {
+		Expect(docker.Registry{Url: "gcr.io"}.IsAnonymous()).To(BeTrue())
+		Expect(docker.Registry{Url: "gcr.io", Username: "user"}.IsAnonymous()).To(BeTrue())
+		Expect(docker.Registry{Url: "gcr.io", Username: "user", Password: "secret"}.IsAnonymous()).To(BeFalse())
+		Expect(docker.Registry{Url: "gcr.io", Username: "user", Password: "secret", Anonymous: true}.IsAnonymous()).To(BeTrue())
+	})
+	It("sends no credentials in anonymous mode", func() {
+		var authorization []string
+		client := docker.NewV2Client(
+			docker.NewHttpClient(&http.Client{Transport: handlerTransport{http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				authorization = append(authorization, req.Header.Get("Authorization"))
+			})}}),
+			docker.Registry{Url: "registry.example.com", Username: "user", Password: "secret", Anonymous: true},
+		)
+		Expect(client.Ping(context.Background())).To(BeNil())
+		Expect(authorization).To(Equal([]string{""}))
+	})
+	It("completes the bearer challenge anonymously", func() {
+		registry := fake.NewRegistry(map[docker.RepositoryName][]docker.TagName{"library/app": {"latest"}}).WithBearerAuth("", "")
+		exists, err := registry.NewV2Client().ExistsTag(context.Background(), "library/app", "latest")
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeTrue())
+	})
+	Context("RegistryPasswordFromEnv", func() {
+		AfterEach(func() {
+			os.Unsetenv("DOCKER_UTILS_TEST_PASSWORD")
+		})
+		It("reads and trims the variable", func() {
+			os.Setenv("DOCKER_UTILS_TEST_PASSWORD", " secret\n")
+			var registry docker.Registry
+			Expect(registry.RegistryPasswordFromEnv("DOCKER_UTILS_TEST_PASSWORD")).To(BeNil())
+			Expect(registry.Password).To(Equal("secret"))
+		})
+		It("returns not found for unset variable", func() {
+			var registry docker.Registry
+			Expect(errors.Cause(registry.RegistryPasswordFromEnv("DOCKER_UTILS_TEST_PASSWORD"))).To(Equal(docker.ErrNotFound))
+		})
+		It("returns not found for empty variable", func() {
+			os.Setenv("DOCKER_UTILS_TEST_PASSWORD", "  ")
+			var registry docker.Registry
+			Expect(errors.Cause(registry.RegistryPasswordFromEnv("DOCKER_UTILS_TEST_PASSWORD"))).To(Equal(docker.ErrNotFound))
+		})
+	})
+	Context("ResolveCredentials", func() {
+		BeforeEach(func() {
+			os.Unsetenv(docker.DefaultPasswordEnv)
+		})
+		AfterEach(func() {
+			os.Unsetenv("DOCKER_UTILS_TEST_PASSWORD")
+			os.Unsetenv(docker.DefaultPasswordEnv)
+		})
+		It("reads the password from the environment", func() {
+			os.Setenv(docker.DefaultPasswordEnv, "secret")
+			registry := docker.Registry{Url: "registry.example.com", Username: "bborbe"}
+			Expect(registry.ResolveCredentials(docker.CredentialOptions{PasswordEnv: docker.DefaultPasswordEnv})).To(BeNil())
+			Expect(registry.Password).To(Equal("secret"))
+		})
+		It("prefers the password file", func() {
+			os.Setenv(docker.DefaultPasswordEnv, "env")
+			file, err := ioutil.TempFile("", "docker-utils")
+			Expect(err).To(BeNil())
+			defer os.Remove(file.Name())
+			fmt.Fprintln(file, "file")
+			file.Close()
+			registry := docker.Registry{Url: "registry.example.com", Username: "bborbe"}
+			Expect(registry.ResolveCredentials(docker.CredentialOptions{PasswordFile: file.Name(), PasswordEnv: docker.DefaultPasswordEnv})).To(BeNil())
+			Expect(registry.Password).To(Equal("file"))
+		})
+		It("ignores an unset default variable", func() {
+			registry := docker.Registry{Url: "registry.example.com", Username: "bborbe"}
+			Expect(registry.ResolveCredentials(docker.CredentialOptions{PasswordEnv: docker.DefaultPasswordEnv})).To(BeNil())
+			Expect(registry.Password).To(BeEmpty())
+		})
+		It("fails on an unset explicit variable", func() {
+			registry := docker.Registry{Url: "registry.example.com", Username: "bborbe"}
+			err := registry.ResolveCredentials(docker.CredentialOptions{PasswordEnv: "DOCKER_UTILS_TEST_PASSWORD"})
+			Expect(errors.Cause(err)).To(Equal(docker.ErrNotFound))
+		})
+		Context("without docker config path", func() {
+			var dir string
+			var oldDockerConfig string
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "docker-utils")
+				Expect(err).To(BeNil())
+				oldDockerConfig = os.Getenv("DOCKER_CONFIG")
+				os.Setenv("DOCKER_CONFIG", dir)
+			})
+			AfterEach(func() {
+				os.Setenv("DOCKER_CONFIG", oldDockerConfig)
+				os.RemoveAll(dir)
+			})
+			It("reads credentials from DOCKER_CONFIG", func() {
+				Expect(ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"auths":{"registry.example.com":{"auth":"dXNlcjpzZWNyZXQ="}}}`), 0600)).To(BeNil())
+				registry := docker.Registry{Url: "registry.example.com"}
+				Expect(registry.ResolveCredentials(docker.CredentialOptions{})).To(BeNil())
+				Expect(registry.Username).To(Equal("user"))
+				Expect(registry.Password).To(Equal("secret"))
+			})
+			It("continues without docker config in DOCKER_CONFIG", func() {
+				registry := docker.Registry{Url: "registry.example.com"}
+				Expect(registry.ResolveCredentials(docker.CredentialOptions{})).To(BeNil())
+				Expect(registry.Username).To(BeEmpty())
+			})
+			It("continues if DOCKER_CONFIG has no credentials for the registry", func() {
+				Expect(ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"auths":{}}`), 0600)).To(BeNil())
+				registry := docker.Registry{Url: "registry.example.com"}
+				Expect(registry.ResolveCredentials(docker.CredentialOptions{})).To(BeNil())
+				Expect(registry.Username).To(BeEmpty())
+			})
+		})
+		It("leaves anonymous registries untouched", func() {
+			os.Setenv(docker.DefaultPasswordEnv, "secret")
+			registry := docker.Registry{Url: "registry.example.com", Anonymous: true}
+			Expect(registry.ResolveCredentials(docker.CredentialOptions{PasswordEnv: docker.DefaultPasswordEnv})).To(BeNil())
+			Expect(registry.Password).To(BeEmpty())
+		})
+	})
+})
@@ -1,11 +1,22 @@
 package docker
 
+import "strings"
+
 type RepositoryName string
 
 func (r RepositoryName) String() string {
 	return string(r)
 }
 
+// Normalize adds the library namespace to single segment Docker Hub repositories, so nginx and library/nginx are the same.
+// Repositories of other registries are returned unchanged.
+func (r RepositoryName) Normalize(registry Registry) RepositoryName {
+	if !registry.IsDockerHub() || r == "" || strings.Contains(r.String(), "/") {
+		return r
+	}
+	return RepositoryName(DockerHubNamespace + "/" + r.String())
+}
+
 type RepositoryNamesByName []RepositoryName
 
 func (t RepositoryNamesByName) Len() int {
@@ -24,3 +35,8 @@ type Repository struct {
 	Name RepositoryName
 	Tag  TagName
 }
+
+// String returns name:tag.
+func (r Repository) String() string {
+	return r.Name.String() + ":" + r.Tag.String()
+}
@@ -0,0 +1,41 @@
+package docker
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// RepositoryFilter keeps repositories starting with Prefix and matching Regexp.
+// Empty fields match every repository.
+type RepositoryFilter struct {
+	Prefix string
+	Regexp *regexp.Regexp
+}
+
+func (r RepositoryFilter) IsEmpty() bool {
+	return r.Prefix == "" && r.Regexp == nil
+}
+
+func (r RepositoryFilter) Match(repositoryName RepositoryName) bool {
+	if !strings.HasPrefix(repositoryName.String(), r.Prefix) {
+		return false
+	}
+	return r.Regexp == nil || r.Regexp.MatchString(repositoryName.String())
+}
+
+// ListRepositoriesFiltered sends only repositories matching the filter.
+// The filter is applied page by page, so the catalog is never hold in memory.
+func (c *v2Client) ListRepositoriesFiltered(ctx context.Context, filter RepositoryFilter, ch chan<- RepositoryName) error {
+	return c.EachRepository(ctx, func(repositoryName RepositoryName) error {
+		if !filter.Match(repositoryName) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ch <- repositoryName:
+		}
+		return nil
+	})
+}
@@ -0,0 +1,36 @@
+package docker
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestObserver is notified about every request send to the registry, e.g. to record prometheus metrics.
+// The status code is 0 if the request failed without response. Observe must be safe for concurrent use.
+type RequestObserver interface {
+	Observe(method string, host string, statusCode int, duration time.Duration)
+}
+
+// RequestObserverFunc allows to use a func as RequestObserver.
+type RequestObserverFunc func(method string, host string, statusCode int, duration time.Duration)
+
+func (r RequestObserverFunc) Observe(method string, host string, statusCode int, duration time.Duration) {
+	r(method, host, statusCode, duration)
+}
+
+// requestObserverRoundTripper reports each attempt including retries to the observer.
+type requestObserverRoundTripper struct {
+	roundTripper http.RoundTripper
+	observer     RequestObserver
+}
+
+func (r *requestObserverRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := r.roundTripper.RoundTrip(req)
+	if err != nil {
+		r.observer.Observe(req.Method, req.URL.Host, 0, time.Since(start))
+		return nil, err
+	}
+	r.observer.Observe(req.Method, req.URL.Host, resp.StatusCode, time.Since(start))
+	return resp, nil
+}
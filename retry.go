@@ -0,0 +1,111 @@
+package docker
+
+import (
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultMaxRetries = 3
+	DefaultRetryDelay = time.Second
+	// MaxRetryAfter caps the Retry-After delay waited for requests without deadline.
+	MaxRetryAfter = time.Minute
+)
+
+// retryRoundTripper retries requests answered with 429 or 5xx using exponential backoff with jitter,
+// so parallel clients do not retry in lockstep. A Retry-After header send by the registry takes precedence over the computed delay.
+// A Retry-After delay passing the deadline of the request, or MaxRetryAfter without deadline, is not waited for,
+// the response is returned as is so the caller gets ErrRateLimited.
+// Connection errors like resets are retried for GET and HEAD requests.
+type retryRoundTripper struct {
+	roundTripper http.RoundTripper
+	maxRetries   int
+	baseDelay    time.Duration
+	crawlStats   *CrawlStats
+	// statusCodes overrides the retried status codes if not empty
+	statusCodes map[int]bool
+	logger      Logger
+}
+
+func (r *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := r.roundTripper.RoundTrip(req)
+		if attempt >= r.maxRetries {
+			return resp, err
+		}
+		if err != nil {
+			if req.Context().Err() != nil || req.Method != http.MethodGet && req.Method != http.MethodHead {
+				return resp, err
+			}
+		} else if !r.isRetryable(resp.StatusCode) {
+			return resp, nil
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return resp, err
+		}
+		var delay time.Duration
+		if err == nil {
+			delay = ParseRetryAfter(resp.Header, time.Now())
+			if exceedsDeadline(req, delay) {
+				debugfWith(r.logger, "%s %s returned %d, retry after %v exceeds deadline", req.Method, req.URL.String(), resp.StatusCode, delay)
+				return resp, nil
+			}
+			resp.Body.Close()
+			debugfWith(r.logger, "%s %s returned %d, retry %d/%d", req.Method, req.URL.String(), resp.StatusCode, attempt+1, r.maxRetries)
+		} else {
+			debugfWith(r.logger, "%s %s failed: %v, retry %d/%d", req.Method, req.URL.String(), err, attempt+1, r.maxRetries)
+		}
+		if delay <= 0 {
+			delay = jitter(r.baseDelay << uint(attempt))
+		}
+		debugfWith(r.logger, "wait %v before retry", delay)
+		if r.crawlStats != nil {
+			atomic.AddInt64(&r.crawlStats.Retries, 1)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+func (r *retryRoundTripper) isRetryable(statusCode int) bool {
+	if len(r.statusCodes) > 0 {
+		return r.statusCodes[statusCode]
+	}
+	return isRetryableStatusCode(statusCode)
+}
+
+// exceedsDeadline returns true if waiting the delay passes the deadline of the request or MaxRetryAfter if it has none.
+func exceedsDeadline(req *http.Request, delay time.Duration) bool {
+	if deadline, ok := req.Context().Deadline(); ok {
+		return time.Now().Add(delay).After(deadline)
+	}
+	return delay > MaxRetryAfter
+}
+
+func isRetryableStatusCode(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500 && statusCode <= 599
+}
+
+// jitter returns a random delay between half and the full delay.
+func jitter(delay time.Duration) time.Duration {
+	if delay <= 1 {
+		return delay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
@@ -0,0 +1,166 @@
+package docker_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retry", func() {
+	var server *httptest.Server
+	var counter int32
+	var failures int32
+	var statusCode int
+	var retryAfter string
+	var crawlStats *docker.CrawlStats
+	var client *http.Client
+	BeforeEach(func() {
+		counter = 0
+		failures = 2
+		statusCode = http.StatusServiceUnavailable
+		retryAfter = ""
+		crawlStats = docker.NewCrawlStats()
+		server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			if atomic.AddInt32(&counter, 1) <= failures {
+				if retryAfter != "" {
+					resp.Header().Set("Retry-After", retryAfter)
+				}
+				resp.WriteHeader(statusCode)
+				return
+			}
+			resp.WriteHeader(http.StatusOK)
+		}))
+		var err error
+		client, err = docker.NewHttpClientBuilder().
+			WithCrawlStats(crawlStats).
+			WithRetry(3, time.Millisecond).
+			Build()
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	It("retries 5xx until success", func() {
+		resp, err := client.Get(server.URL)
+		Expect(err).To(BeNil())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(atomic.LoadInt32(&counter)).To(Equal(int32(3)))
+		Expect(crawlStats.Snapshot().Retries).To(Equal(int64(2)))
+	})
+	It("retries 429 with retry after header", func() {
+		statusCode = http.StatusTooManyRequests
+		retryAfter = "0"
+		resp, err := client.Get(server.URL)
+		Expect(err).To(BeNil())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(crawlStats.Snapshot().RateLimited).To(Equal(int64(2)))
+	})
+	It("returns last response after budget is exhausted", func() {
+		failures = 10
+		resp, err := client.Get(server.URL)
+		Expect(err).To(BeNil())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(atomic.LoadInt32(&counter)).To(Equal(int32(4)))
+	})
+	It("does not retry other client errors", func() {
+		statusCode = http.StatusNotFound
+		resp, err := client.Get(server.URL)
+		Expect(err).To(BeNil())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(atomic.LoadInt32(&counter)).To(Equal(int32(1)))
+	})
+	It("retries only the given status codes", func() {
+		statusCode = http.StatusBadGateway
+		var err error
+		client, err = docker.NewHttpClientBuilder().
+			WithRetry(3, time.Millisecond).
+			WithRetryStatusCodes(http.StatusServiceUnavailable).
+			Build()
+		Expect(err).To(BeNil())
+		resp, err := client.Get(server.URL)
+		Expect(err).To(BeNil())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusBadGateway))
+		Expect(atomic.LoadInt32(&counter)).To(Equal(int32(1)))
+	})
+	Context("with connection reset", func() {
+		BeforeEach(func() {
+			server.Close()
+			server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				if atomic.AddInt32(&counter, 1) <= failures {
+					conn, _, err := resp.(http.Hijacker).Hijack()
+					Expect(err).To(BeNil())
+					conn.Close()
+					return
+				}
+				resp.WriteHeader(http.StatusOK)
+			}))
+		})
+		It("retries get requests", func() {
+			resp, err := client.Get(server.URL)
+			Expect(err).To(BeNil())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(atomic.LoadInt32(&counter)).To(Equal(int32(3)))
+			Expect(crawlStats.Snapshot().Retries).To(Equal(int64(2)))
+		})
+		It("does not retry post requests", func() {
+			_, err := client.Post(server.URL, "application/octet-stream", nil)
+			Expect(err).NotTo(BeNil())
+			Expect(atomic.LoadInt32(&counter)).To(Equal(int32(1)))
+		})
+	})
+	It("returns 429 at once if retry after exceeds the timeout", func() {
+		statusCode = http.StatusTooManyRequests
+		retryAfter = "3600"
+		var err error
+		client, err = docker.NewHttpClientBuilder().
+			WithRetry(3, time.Second).
+			WithTimeout(2 * time.Second).
+			Build()
+		Expect(err).To(BeNil())
+		start := time.Now()
+		resp, err := client.Get(server.URL)
+		Expect(err).To(BeNil())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(atomic.LoadInt32(&counter)).To(Equal(int32(1)))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+	It("returns 429 at once if retry after exceeds the max without timeout", func() {
+		statusCode = http.StatusTooManyRequests
+		retryAfter = "3600"
+		var err error
+		client, err = docker.NewHttpClientBuilder().
+			WithRetry(3, time.Second).
+			WithTimeout(0).
+			Build()
+		Expect(err).To(BeNil())
+		resp, err := client.Get(server.URL)
+		Expect(err).To(BeNil())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(atomic.LoadInt32(&counter)).To(Equal(int32(1)))
+	})
+	It("stops waiting if context is canceled", func() {
+		retryAfter = "10"
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		time.AfterFunc(50*time.Millisecond, cancel)
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		Expect(err).To(BeNil())
+		_, err = client.Do(req.WithContext(ctx))
+		Expect(err).NotTo(BeNil())
+		Expect(atomic.LoadInt32(&counter)).To(Equal(int32(1)))
+	})
+})
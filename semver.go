@@ -0,0 +1,139 @@
+package docker
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var semverRegexp = regexp.MustCompile(`^v?(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?$`)
+
+// Semver is a semantic version as defined by semver.org. Build metadata is ignored.
+type Semver struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	PreRelease []string
+}
+
+// ParseSemver parses tags like 1.2.3, v1.2.3 or 1.2.3-rc.1.
+func ParseSemver(tag TagName) (*Semver, bool) {
+	matches := semverRegexp.FindStringSubmatch(tag.String())
+	if matches == nil {
+		return nil, false
+	}
+	var semver Semver
+	var err error
+	if semver.Major, err = strconv.ParseUint(matches[1], 10, 64); err != nil {
+		return nil, false
+	}
+	if semver.Minor, err = strconv.ParseUint(matches[2], 10, 64); err != nil {
+		return nil, false
+	}
+	if semver.Patch, err = strconv.ParseUint(matches[3], 10, 64); err != nil {
+		return nil, false
+	}
+	if matches[4] != "" {
+		semver.PreRelease = strings.Split(matches[4], ".")
+	}
+	return &semver, true
+}
+
+// Compare returns -1, 0 or 1 following the precedence rules of semver.org.
+func (s Semver) Compare(other Semver) int {
+	if result := compareUint(s.Major, other.Major); result != 0 {
+		return result
+	}
+	if result := compareUint(s.Minor, other.Minor); result != 0 {
+		return result
+	}
+	if result := compareUint(s.Patch, other.Patch); result != 0 {
+		return result
+	}
+	// a version without pre-release has higher precedence
+	switch {
+	case len(s.PreRelease) == 0 && len(other.PreRelease) == 0:
+		return 0
+	case len(s.PreRelease) == 0:
+		return 1
+	case len(other.PreRelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(s.PreRelease) && i < len(other.PreRelease); i++ {
+		if result := comparePreRelease(s.PreRelease[i], other.PreRelease[i]); result != 0 {
+			return result
+		}
+	}
+	return compareUint(uint64(len(s.PreRelease)), uint64(len(other.PreRelease)))
+}
+
+// comparePreRelease compares numeric identifiers numerically and lower than alphanumeric ones.
+func comparePreRelease(a, b string) int {
+	na, errA := strconv.ParseUint(a, 10, 64)
+	nb, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		return compareUint(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// SortTagsBySemver sorts semver tags descending and moves all other tags to the end in stable order.
+func SortTagsBySemver(tags []TagName) {
+	versions := make(map[TagName]*Semver, len(tags))
+	for _, tag := range tags {
+		if semver, ok := ParseSemver(tag); ok {
+			versions[tag] = semver
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		a, b := versions[tags[i]], versions[tags[j]]
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return a.Compare(*b) > 0
+	})
+}
+
+// ListTagsSortedSemver returns all tags of the repository sorted by SortTagsBySemver.
+func (c *v2Client) ListTagsSortedSemver(ctx context.Context, repositoryName RepositoryName) ([]TagName, error) {
+	tags, err := c.listAllTags(ctx, repositoryName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list tags of %s failed", repositoryName)
+	}
+	SortTagsBySemver(tags)
+	return tags, nil
+}
+
+// LatestTag returns the highest semver tag of the repository, pre-releases included.
+func (c *v2Client) LatestTag(ctx context.Context, repositoryName RepositoryName) (TagName, error) {
+	tags, err := c.ListTagsSortedSemver(ctx, repositoryName)
+	if err != nil {
+		return "", err
+	}
+	if len(tags) == 0 {
+		return "", errors.Wrapf(ErrNotFound, "repository %s has no semver tag", repositoryName)
+	}
+	if _, ok := ParseSemver(tags[0]); !ok {
+		return "", errors.Wrapf(ErrNotFound, "repository %s has no semver tag", repositoryName)
+	}
+	return tags[0], nil
+}
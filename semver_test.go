@@ -0,0 +1,77 @@
+package docker_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Semver", func() {
+	It("parses version with leading v", func() {
+		semver, ok := docker.ParseSemver("v1.2.3")
+		Expect(ok).To(BeTrue())
+		Expect(*semver).To(Equal(docker.Semver{Major: 1, Minor: 2, Patch: 3}))
+	})
+	It("parses pre-release and ignores build metadata", func() {
+		semver, ok := docker.ParseSemver("1.0.0-rc.1+build.5")
+		Expect(ok).To(BeTrue())
+		Expect(semver.PreRelease).To(Equal([]string{"rc", "1"}))
+	})
+	for _, tag := range []docker.TagName{"latest", "main", "2020-01-01", "1.2", "01.2.3", "1.2.3-"} {
+		tag := tag
+		It("rejects "+tag.String(), func() {
+			_, ok := docker.ParseSemver(tag)
+			Expect(ok).To(BeFalse())
+		})
+	}
+	It("orders by semver precedence", func() {
+		ordered := []docker.TagName{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.10.0", "2.0.0"}
+		for i := 0; i < len(ordered)-1; i++ {
+			a, _ := docker.ParseSemver(ordered[i])
+			b, _ := docker.ParseSemver(ordered[i+1])
+			Expect(a.Compare(*b)).To(Equal(-1), fmt.Sprintf("%s < %s", ordered[i], ordered[i+1]))
+			Expect(b.Compare(*a)).To(Equal(1))
+		}
+	})
+	It("sorts descending and moves other tags to the end", func() {
+		tags := []docker.TagName{"latest", "1.0.0", "main", "v1.10.0", "1.0.0-rc1", "1.2.0"}
+		docker.SortTagsBySemver(tags)
+		Expect(tags).To(Equal([]docker.TagName{"v1.10.0", "1.2.0", "1.0.0", "1.0.0-rc1", "latest", "main"}))
+	})
+	Context("client", func() {
+		var server *httptest.Server
+		var body string
+		var client docker.V2Client
+		BeforeEach(func() {
+			body = `{"tags":["latest","1.0.0","1.2.0-rc1","1.1.0"]}`
+			server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				fmt.Fprint(resp, body)
+			}))
+			client = docker.NewV2Client(docker.NewHttpClient(server.Client()), docker.Registry{Url: server.URL})
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("lists tags sorted by semver", func() {
+			tags, err := client.ListTagsSortedSemver(context.Background(), "bborbe/app")
+			Expect(err).To(BeNil())
+			Expect(tags).To(Equal([]docker.TagName{"1.2.0-rc1", "1.1.0", "1.0.0", "latest"}))
+		})
+		It("returns highest semver tag", func() {
+			tag, err := client.LatestTag(context.Background(), "bborbe/app")
+			Expect(err).To(BeNil())
+			Expect(tag).To(Equal(docker.TagName("1.2.0-rc1")))
+		})
+		It("returns not found without semver tag", func() {
+			body = `{"tags":["latest"]}`
+			_, err := client.LatestTag(context.Background(), "bborbe/app")
+			Expect(errors.Cause(err)).To(Equal(docker.ErrNotFound))
+		})
+	})
+})
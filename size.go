@@ -0,0 +1,40 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Size returns the compressed size of the config and all layers as reported in the manifest, no blobs are downloaded.
+// For manifest lists the sizes of all referenced platform manifests are summed up.
+func (c *v2Client) Size(ctx context.Context, repositoryName RepositoryName, tag TagName) (int64, error) {
+	manifest, _, err := c.manifest(ctx, repositoryName, tag.String())
+	if err != nil {
+		return 0, errors.Wrapf(err, "get manifest of %s:%s failed", repositoryName, tag)
+	}
+	if len(manifest.Manifests) == 0 {
+		return manifest.Size(), nil
+	}
+	var size int64
+	for _, descriptor := range manifest.Manifests {
+		platformManifest, _, err := c.manifest(ctx, repositoryName, descriptor.Digest)
+		if err != nil {
+			return 0, errors.Wrapf(err, "get manifest %s of %s:%s failed", descriptor.Digest, repositoryName, tag)
+		}
+		size += platformManifest.Size()
+	}
+	return size, nil
+}
+
+// Size sums up the size of config and layers, or blobs of an OCI artifact manifest.
+func (m Manifest) Size() int64 {
+	size := int64(m.Config.Size)
+	for _, layer := range m.Layers {
+		size += int64(layer.Size)
+	}
+	for _, blob := range m.Blobs {
+		size += int64(blob.Size)
+	}
+	return size
+}
@@ -0,0 +1,76 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+type SummaryOptions struct {
+	// Filter limits the summary to matching repositories.
+	Filter RepositoryFilter
+	// CountTags lists the tags of every repository, which is expensive on large registries.
+	CountTags bool
+	// Concurrency of the tag listing, defaults to DefaultConcurrency.
+	Concurrency int
+}
+
+// RegistrySummary contains the totals of a registry.
+type RegistrySummary struct {
+	Repositories int `json:"repositories"`
+	// Tags is only counted with SummaryOptions.CountTags.
+	Tags int `json:"tags,omitempty"`
+}
+
+// String returns repositories=<n> tags=<n>, tags are omitted if not counted.
+func (r RegistrySummary) String() string {
+	if r.Tags == 0 {
+		return fmt.Sprintf("repositories=%d", r.Repositories)
+	}
+	return fmt.Sprintf("repositories=%d tags=%d", r.Repositories, r.Tags)
+}
+
+// CountRepositories returns the number of repositories in the catalog.
+func (c *v2Client) CountRepositories(ctx context.Context) (int, error) {
+	summary, err := c.Summary(ctx, SummaryOptions{})
+	if err != nil {
+		return 0, err
+	}
+	return summary.Repositories, nil
+}
+
+// Summary counts the repositories and, only with CountTags, their tags.
+// Repositories whose tags could not be listed are counted without tags and their errors are combined into the returned error.
+func (c *v2Client) Summary(ctx context.Context, options SummaryOptions) (*RegistrySummary, error) {
+	repositories := make(chan RepositoryName)
+	var listErr error
+	go func() {
+		defer close(repositories)
+		listErr = c.ListRepositoriesFiltered(ctx, options.Filter, repositories)
+	}()
+	summary := &RegistrySummary{}
+	var repositoryNames []RepositoryName
+	for repositoryName := range repositories {
+		summary.Repositories++
+		// the names are only kept if the tags are counted
+		if options.CountTags {
+			repositoryNames = append(repositoryNames, repositoryName)
+		}
+	}
+	if listErr != nil {
+		return nil, errors.Wrap(listErr, "list repositories failed")
+	}
+	if !options.CountTags {
+		return summary, nil
+	}
+	concurrency := options.Concurrency
+	if concurrency == 0 {
+		concurrency = DefaultConcurrency
+	}
+	tags, err := c.ListTagsForRepositories(ctx, repositoryNames, concurrency)
+	for _, repositoryTags := range tags {
+		summary.Tags += len(repositoryTags)
+	}
+	return summary, err
+}
@@ -0,0 +1,45 @@
+package docker_test
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/bborbe/docker-utils"
+	"github.com/bborbe/docker-utils/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Summary", func() {
+	var client docker.V2Client
+	BeforeEach(func() {
+		client = fake.NewRegistry(map[docker.RepositoryName][]docker.TagName{
+			"team/app": {"1.0.0", "1.1.0", "latest"},
+			"team/api": {"latest"},
+			"other/db": {"1", "2"},
+		}).NewV2Client(docker.WithPageSize(2))
+	})
+	It("counts repositories", func() {
+		count, err := client.CountRepositories(context.Background())
+		Expect(err).To(BeNil())
+		Expect(count).To(Equal(3))
+	})
+	It("counts no tags by default", func() {
+		summary, err := client.Summary(context.Background(), docker.SummaryOptions{})
+		Expect(err).To(BeNil())
+		Expect(*summary).To(Equal(docker.RegistrySummary{Repositories: 3}))
+	})
+	It("counts tags if requested", func() {
+		summary, err := client.Summary(context.Background(), docker.SummaryOptions{CountTags: true})
+		Expect(err).To(BeNil())
+		Expect(*summary).To(Equal(docker.RegistrySummary{Repositories: 3, Tags: 6}))
+	})
+	It("applies the filter", func() {
+		summary, err := client.Summary(context.Background(), docker.SummaryOptions{
+			Filter:    docker.RepositoryFilter{Prefix: "team/", Regexp: regexp.MustCompile(`app$`)},
+			CountTags: true,
+		})
+		Expect(err).To(BeNil())
+		Expect(*summary).To(Equal(docker.RegistrySummary{Repositories: 1, Tags: 3}))
+	})
+})
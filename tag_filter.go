@@ -0,0 +1,70 @@
+package docker
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TagFilter keeps tags matching one of the include globs and none of the exclude globs.
+// Includes are applied first, excludes afterwards remove tags again. An empty include list matches every tag.
+type TagFilter struct {
+	Include TagPatterns
+	Exclude TagPatterns
+}
+
+func (t TagFilter) Validate() error {
+	for _, pattern := range append(append(TagPatterns{}, t.Include...), t.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "invalid tag pattern %s", pattern)
+		}
+	}
+	return nil
+}
+
+func (t TagFilter) IsEmpty() bool {
+	return len(t.Include) == 0 && len(t.Exclude) == 0
+}
+
+func (t TagFilter) Match(tag TagName) bool {
+	if len(t.Include) > 0 && !t.Include.Match(tag) {
+		return false
+	}
+	return !t.Exclude.Match(tag)
+}
+
+// ShouldDelete decides the cleanup of a tag with the given age. Excludes are applied first and force the delete,
+// then includes protect the tag, all other tags are deleted if older than maxAge.
+// Unlike Match an empty include list protects nothing, so excludes alone do not keep the other tags.
+func (t TagFilter) ShouldDelete(tag TagName, age time.Duration, maxAge time.Duration) bool {
+	if t.Exclude.Match(tag) {
+		return true
+	}
+	if t.Include.Match(tag) {
+		return false
+	}
+	return age > maxAge
+}
+
+// TagPatterns is a list of shell globs usable as repeatable flag.
+type TagPatterns []string
+
+func (t *TagPatterns) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *TagPatterns) Set(value string) error {
+	*t = append(*t, value)
+	return nil
+}
+
+func (t TagPatterns) Match(tag TagName) bool {
+	for _, pattern := range t {
+		if ok, _ := path.Match(pattern, tag.String()); ok {
+			return true
+		}
+	}
+	return false
+}
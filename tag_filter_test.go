@@ -0,0 +1,75 @@
+package docker_test
+
+import (
+	"time"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TagFilter", func() {
+	var filter docker.TagFilter
+	BeforeEach(func() {
+		filter = docker.TagFilter{}
+	})
+	It("matches everything without patterns", func() {
+		Expect(filter.IsEmpty()).To(BeTrue())
+		Expect(filter.Match("latest")).To(BeTrue())
+	})
+	Context("with include and exclude", func() {
+		BeforeEach(func() {
+			filter.Include = docker.TagPatterns{"v*", "semver-*", "latest"}
+			filter.Exclude = docker.TagPatterns{"*-rc*"}
+		})
+		It("matches include", func() {
+			Expect(filter.Match("v1.0.0")).To(BeTrue())
+			Expect(filter.Match("semver-1")).To(BeTrue())
+			Expect(filter.Match("latest")).To(BeTrue())
+		})
+		It("does not match other tags", func() {
+			Expect(filter.Match("pr-123")).To(BeFalse())
+		})
+		It("does not match excluded tags", func() {
+			Expect(filter.Match("v1.0.0-rc1")).To(BeFalse())
+		})
+	})
+	It("matches all except excluded without include", func() {
+		filter.Exclude = docker.TagPatterns{"pr-*"}
+		Expect(filter.Match("master")).To(BeTrue())
+		Expect(filter.Match("pr-1")).To(BeFalse())
+	})
+	Context("ShouldDelete", func() {
+		const maxAge = 24 * time.Hour
+		It("deletes old tags without patterns", func() {
+			Expect(filter.ShouldDelete("master", 2*maxAge, maxAge)).To(BeTrue())
+			Expect(filter.ShouldDelete("master", maxAge/2, maxAge)).To(BeFalse())
+		})
+		It("protects included tags", func() {
+			filter.Include = docker.TagPatterns{"v*", "latest"}
+			Expect(filter.ShouldDelete("v1.0.0", 2*maxAge, maxAge)).To(BeFalse())
+			Expect(filter.ShouldDelete("master", 2*maxAge, maxAge)).To(BeTrue())
+		})
+		It("force deletes excluded tags even if included", func() {
+			filter.Include = docker.TagPatterns{"v*"}
+			filter.Exclude = docker.TagPatterns{"*-rc*"}
+			Expect(filter.ShouldDelete("v1.0.0-rc1", maxAge/2, maxAge)).To(BeTrue())
+		})
+		It("keeps pruning by age with delete patterns only", func() {
+			filter.Exclude = docker.TagPatterns{"pr-*"}
+			Expect(filter.ShouldDelete("pr-1", maxAge/2, maxAge)).To(BeTrue())
+			Expect(filter.ShouldDelete("master", 2*maxAge, maxAge)).To(BeTrue())
+			Expect(filter.ShouldDelete("master", maxAge/2, maxAge)).To(BeFalse())
+		})
+	})
+	It("returns error for invalid pattern", func() {
+		filter.Include = docker.TagPatterns{"["}
+		Expect(filter.Validate()).NotTo(BeNil())
+	})
+	It("collects repeated flag values", func() {
+		var patterns docker.TagPatterns
+		Expect(patterns.Set("a*")).To(BeNil())
+		Expect(patterns.Set("b*")).To(BeNil())
+		Expect(patterns.String()).To(Equal("a*,b*"))
+	})
+})
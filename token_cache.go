@@ -0,0 +1,133 @@
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenExpiryMargin renews tokens shortly before they expire to avoid using them mid-flight.
+	tokenExpiryMargin = 10 * time.Second
+	// defaultTokenLifetime is used if the token server does not report expires_in, as defined by the token spec.
+	defaultTokenLifetime = 60 * time.Second
+)
+
+// tokenCache stores tokens by key until shortly before they expire. It is safe for concurrent use.
+// With a file the tokens are shared with other processes, see WithTokenCacheDir.
+type tokenCache struct {
+	mux    sync.Mutex
+	tokens map[string]cachedToken
+
+	file     string
+	username string
+	loaded   bool
+	logger   Logger
+	// invalidated keys are not merged back from the file by save
+	invalidated map[string]bool
+}
+
+type cachedToken struct {
+	token   RegistryToken
+	expires time.Time
+}
+
+func (t *tokenCache) get(key string) (RegistryToken, bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.load()
+	cached, ok := t.tokens[key]
+	if !ok || time.Now().Add(tokenExpiryMargin).After(cached.expires) {
+		return "", false
+	}
+	return cached.token, true
+}
+
+func (t *tokenCache) set(key string, token RegistryToken, expires time.Time) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.load()
+	if t.tokens == nil {
+		t.tokens = make(map[string]cachedToken)
+	}
+	t.tokens[key] = cachedToken{
+		token:   token,
+		expires: expires,
+	}
+	delete(t.invalidated, key)
+	t.save()
+}
+
+// invalidate forces a refresh of the token, e.g. after the registry rejected it.
+func (t *tokenCache) invalidate(key string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.load()
+	if _, ok := t.tokens[key]; !ok {
+		return
+	}
+	delete(t.tokens, key)
+	if t.file != "" {
+		if t.invalidated == nil {
+			t.invalidated = make(map[string]bool)
+		}
+		t.invalidated[key] = true
+	}
+	t.save()
+}
+
+// tokenResponse is the answer of a token server like auth.docker.io.
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	IssuedAt    string `json:"issued_at"`
+}
+
+func (t tokenResponse) token() RegistryToken {
+	if t.Token != "" {
+		return RegistryToken(t.Token)
+	}
+	return RegistryToken(t.AccessToken)
+}
+
+// expires uses expires_in and issued_at of the response
+// and falls back to the exp claim if the token is a jwt.
+func (t tokenResponse) expires(now time.Time) time.Time {
+	if t.ExpiresIn <= 0 {
+		if exp, ok := jwtExpiry(t.token()); ok {
+			return exp
+		}
+	}
+	issuedAt := now
+	if t.IssuedAt != "" {
+		if parsed, err := time.Parse(time.RFC3339, t.IssuedAt); err == nil {
+			issuedAt = parsed
+		}
+	}
+	if t.ExpiresIn <= 0 {
+		return issuedAt.Add(defaultTokenLifetime)
+	}
+	return issuedAt.Add(time.Duration(t.ExpiresIn) * time.Second)
+}
+
+// jwtExpiry reads the exp claim of a jwt without verifying its signature.
+func jwtExpiry(token RegistryToken) (time.Time, bool) {
+	parts := strings.Split(token.String(), ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0), true
+}
@@ -0,0 +1,214 @@
+package docker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tokenCacheLockTimeout bounds waiting for the lock of another process, older locks are considered stale.
+const tokenCacheLockTimeout = 5 * time.Second
+
+// DefaultTokenCacheDir returns $XDG_CACHE_HOME/docker-utils or the user cache dir of the os.
+// An empty string is returned if neither is known.
+func DefaultTokenCacheDir() string {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "docker-utils")
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "docker-utils")
+}
+
+// WithTokenCache persists bearer tokens in DefaultTokenCacheDir, so short lived processes reuse them until they expire.
+// Clients keep tokens in memory only unless this or WithTokenCacheDir is given. The commands enable it unless -no-cache is set.
+func WithTokenCache(enabled bool) ClientOption {
+	return func(o *clientOptions) {
+		o.tokenCacheDir = ""
+		if enabled {
+			o.tokenCacheDir = DefaultTokenCacheDir()
+		}
+	}
+}
+
+// WithTokenCacheDir persists bearer tokens in the given dir. An empty dir keeps tokens in memory only.
+func WithTokenCacheDir(dir string) ClientOption {
+	return func(o *clientOptions) {
+		o.tokenCacheDir = dir
+	}
+}
+
+// newTokenCache returns a cache persisted in the dir if given.
+// Every username has its own file, so different credentials for the same registry never share a token.
+func newTokenCache(dir string, username string, logger Logger) tokenCache {
+	if dir == "" {
+		return tokenCache{}
+	}
+	return tokenCache{
+		file:     filepath.Join(dir, tokenCacheFileName(username)),
+		username: username,
+		logger:   logger,
+	}
+}
+
+// tokenCacheFileName derives the file name from a hash of the username, so any username is a valid file name.
+func tokenCacheFileName(username string) string {
+	sum := sha256.Sum256([]byte(username))
+	return "tokens-" + hex.EncodeToString(sum[:8]) + ".json"
+}
+
+// tokenFile is the content of the file of a username.
+type tokenFile struct {
+	Username string                    `json:"username"`
+	Tokens   map[string]persistedToken `json:"tokens"`
+}
+
+type persistedToken struct {
+	Token   RegistryToken `json:"token"`
+	Expires time.Time     `json:"expires"`
+}
+
+// load reads the tokens of the username once. A missing or corrupt file is ignored. The caller must hold the lock.
+func (t *tokenCache) load() {
+	if t.file == "" || t.loaded {
+		return
+	}
+	t.loaded = true
+	if t.tokens == nil {
+		t.tokens = make(map[string]cachedToken)
+	}
+	now := time.Now()
+	for key, persisted := range readTokenFile(t.file, t.username, t.logger) {
+		if !persisted.Expires.After(now) {
+			continue
+		}
+		t.tokens[key] = cachedToken{
+			token:   persisted.Token,
+			expires: persisted.Expires,
+		}
+	}
+}
+
+// save merges the tokens into the file and evicts all expired tokens.
+// Tokens other processes of the same username wrote in the meantime are kept, the file is locked while it is rewritten.
+// Failures only disable the persistence for this write. The caller must hold the lock.
+func (t *tokenCache) save() {
+	if t.file == "" {
+		return
+	}
+	if err := t.writeMerged(); err != nil {
+		warningfWith(t.logger, "write token cache %s failed: %v", t.file, err)
+	}
+}
+
+func (t *tokenCache) writeMerged() error {
+	if err := os.MkdirAll(filepath.Dir(t.file), 0700); err != nil {
+		return errors.Wrap(err, "create dir failed")
+	}
+	unlock, err := lockTokenFile(t.file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	now := time.Now()
+	persisted := make(map[string]persistedToken)
+	for key, token := range readTokenFile(t.file, t.username, t.logger) {
+		if t.invalidated[key] || !token.Expires.After(now) {
+			continue
+		}
+		persisted[key] = token
+	}
+	for key, cached := range t.tokens {
+		if !cached.expires.After(now) {
+			continue
+		}
+		persisted[key] = persistedToken{
+			Token:   cached.token,
+			Expires: cached.expires,
+		}
+	}
+	return writeTokenFile(t.file, tokenFile{
+		Username: t.username,
+		Tokens:   persisted,
+	})
+}
+
+// readTokenFile returns the tokens of the file if it belongs to the username.
+func readTokenFile(file string, username string, logger Logger) map[string]persistedToken {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			debugfWith(logger, "read token cache %s failed: %v", file, err)
+		}
+		return nil
+	}
+	var data tokenFile
+	if err := json.Unmarshal(content, &data); err != nil {
+		debugfWith(logger, "ignore corrupt token cache %s: %v", file, err)
+		return nil
+	}
+	if data.Username != username {
+		debugfWith(logger, "ignore token cache %s of other username", file)
+		return nil
+	}
+	return data.Tokens
+}
+
+// lockTokenFile creates file.lock exclusively and returns the func removing it.
+// A lock older than tokenCacheLockTimeout is left over by a killed process and removed.
+func lockTokenFile(file string) (func(), error) {
+	lock := file + ".lock"
+	deadline := time.Now().Add(tokenCacheLockTimeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, errors.Wrap(err, "create lock failed")
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > tokenCacheLockTimeout {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.Errorf("lock %s held by another process", lock)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// writeTokenFile writes the tokens readable only by the user.
+// The content is written to a temp file and renamed, so concurrent processes never read a partial file.
+func writeTokenFile(file string, data tokenFile) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "encode tokens failed")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return errors.Wrap(err, "create temp file failed")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "write temp file failed")
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "chmod temp file failed")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "close temp file failed")
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,137 @@
+package docker_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TokenCacheDir", func() {
+	var server *httptest.Server
+	var tokenRequests int32
+	var dir string
+	BeforeEach(func() {
+		atomic.StoreInt32(&tokenRequests, 0)
+		var err error
+		dir, err = ioutil.TempDir("", "token-cache")
+		Expect(err).To(BeNil())
+		server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/token":
+				atomic.AddInt32(&tokenRequests, 1)
+				fmt.Fprint(resp, `{"token":"abc","expires_in":300}`)
+			case "/v2/team/app/tags/list", "/v2/team/other/tags/list", "/v2/team/third/tags/list":
+				if req.Header.Get("Authorization") != "Bearer abc" {
+					resp.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, server.URL))
+					resp.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprint(resp, `{"tags":["latest"]}`)
+			default:
+				resp.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	})
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+	newClient := func(username string, options ...docker.ClientOption) docker.V2Client {
+		return docker.NewV2Client(docker.NewHttpClient(http.DefaultClient), docker.Registry{Url: server.URL, Username: username, Password: "secret"}, options...)
+	}
+	listTagsOf := func(client docker.V2Client, repositoryName docker.RepositoryName) {
+		ch := make(chan docker.TagName, 10)
+		Expect(client.ListTags(context.Background(), repositoryName, ch)).To(BeNil())
+	}
+	listTags := func(username string, options ...docker.ClientOption) {
+		listTagsOf(newClient(username, options...), "team/app")
+	}
+	tokenFiles := func() []string {
+		files, err := filepath.Glob(filepath.Join(dir, "tokens-*.json"))
+		Expect(err).To(BeNil())
+		return files
+	}
+	It("reuses tokens of previous clients", func() {
+		listTags("user", docker.WithTokenCacheDir(dir))
+		listTags("user", docker.WithTokenCacheDir(dir))
+		Expect(atomic.LoadInt32(&tokenRequests)).To(Equal(int32(1)))
+		Expect(tokenFiles()).To(HaveLen(1))
+		info, err := os.Stat(tokenFiles()[0])
+		Expect(err).To(BeNil())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+	It("keeps tokens in memory without dir", func() {
+		listTags("user")
+		listTags("user")
+		Expect(atomic.LoadInt32(&tokenRequests)).To(Equal(int32(2)))
+	})
+	It("does not share tokens between usernames", func() {
+		listTags("user", docker.WithTokenCacheDir(dir))
+		listTags("other", docker.WithTokenCacheDir(dir))
+		Expect(atomic.LoadInt32(&tokenRequests)).To(Equal(int32(2)))
+	})
+	It("does not mix usernames sharing a prefix", func() {
+		listTags("a@b", docker.WithTokenCacheDir(dir))
+		listTags("a", docker.WithTokenCacheDir(dir))
+		Expect(atomic.LoadInt32(&tokenRequests)).To(Equal(int32(2)))
+		listTags("a@b", docker.WithTokenCacheDir(dir))
+		listTags("a", docker.WithTokenCacheDir(dir))
+		Expect(atomic.LoadInt32(&tokenRequests)).To(Equal(int32(2)))
+		Expect(tokenFiles()).To(HaveLen(2))
+	})
+	It("keeps tokens written by concurrent clients of the same username", func() {
+		first := newClient("user", docker.WithTokenCacheDir(dir))
+		second := newClient("user", docker.WithTokenCacheDir(dir))
+		listTagsOf(first, "team/app")
+		listTagsOf(second, "team/other")
+		listTagsOf(first, "team/third")
+		Expect(atomic.LoadInt32(&tokenRequests)).To(Equal(int32(3)))
+		third := newClient("user", docker.WithTokenCacheDir(dir))
+		listTagsOf(third, "team/app")
+		listTagsOf(third, "team/other")
+		listTagsOf(third, "team/third")
+		Expect(atomic.LoadInt32(&tokenRequests)).To(Equal(int32(3)))
+	})
+	It("ignores a corrupt cache file", func() {
+		listTags("user", docker.WithTokenCacheDir(dir))
+		Expect(ioutil.WriteFile(tokenFiles()[0], []byte("{corrupt"), 0600)).To(BeNil())
+		listTags("user", docker.WithTokenCacheDir(dir))
+		listTags("user", docker.WithTokenCacheDir(dir))
+		Expect(atomic.LoadInt32(&tokenRequests)).To(Equal(int32(2)))
+	})
+	It("evicts expired tokens", func() {
+		listTags("user", docker.WithTokenCacheDir(dir))
+		file := tokenFiles()[0]
+		content, err := ioutil.ReadFile(file)
+		Expect(err).To(BeNil())
+		var data map[string]interface{}
+		Expect(json.Unmarshal(content, &data)).To(BeNil())
+		expired := map[string]interface{}{"token": "old", "expires": time.Now().Add(-time.Minute)}
+		tokens := data["tokens"].(map[string]interface{})
+		for key := range tokens {
+			tokens[key] = expired
+		}
+		tokens["expired-key"] = expired
+		content, err = json.Marshal(data)
+		Expect(err).To(BeNil())
+		Expect(ioutil.WriteFile(file, content, 0600)).To(BeNil())
+		listTags("user", docker.WithTokenCacheDir(dir))
+		Expect(atomic.LoadInt32(&tokenRequests)).To(Equal(int32(2)))
+		content, err = ioutil.ReadFile(file)
+		Expect(err).To(BeNil())
+		Expect(string(content)).NotTo(ContainSubstring("expired-key"))
+		Expect(string(content)).NotTo(ContainSubstring(`"old"`))
+		Expect(string(content)).To(ContainSubstring(`"username":"user"`))
+	})
+})
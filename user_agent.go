@@ -0,0 +1,55 @@
+package docker
+
+import (
+	"context"
+	"net/http"
+)
+
+// Version is reported in the default User-Agent, release builds set it with -ldflags "-X github.com/bborbe/docker-utils.Version=1.2.3".
+var Version = "dev"
+
+// DefaultUserAgent is sent with every request if no other is configured with WithUserAgent.
+func DefaultUserAgent() string {
+	return "docker-utils/" + Version
+}
+
+// WithUserAgent overrides the User-Agent header of all requests including token requests.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(o *clientOptions) {
+		o.userAgent = userAgent
+	}
+}
+
+// userAgentHttpClient stamps the User-Agent on every request before it is sent
+// and passes the logger of the client on to the HttpClient.
+type userAgentHttpClient struct {
+	httpClient HttpClient
+	userAgent  string
+	logger     Logger
+}
+
+func newUserAgentHttpClient(httpClient HttpClient, userAgent string, logger Logger) HttpClient {
+	if userAgent == "" {
+		userAgent = DefaultUserAgent()
+	}
+	return &userAgentHttpClient{
+		httpClient: httpClient,
+		userAgent:  userAgent,
+		logger:     logger,
+	}
+}
+
+func (u *userAgentHttpClient) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	req.Header.Set("User-Agent", u.userAgent)
+	return u.httpClient.Do(contextWithLogger(ctx, u.logger), req)
+}
+
+func (u *userAgentHttpClient) DoSuccess(ctx context.Context, req *http.Request) (*http.Response, error) {
+	req.Header.Set("User-Agent", u.userAgent)
+	return u.httpClient.DoSuccess(contextWithLogger(ctx, u.logger), req)
+}
+
+func (u *userAgentHttpClient) DoJSON(ctx context.Context, req *http.Request, data interface{}) error {
+	req.Header.Set("User-Agent", u.userAgent)
+	return u.httpClient.DoJSON(contextWithLogger(ctx, u.logger), req, data)
+}
@@ -0,0 +1,58 @@
+package docker_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/bborbe/docker-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UserAgent", func() {
+	var server *httptest.Server
+	var mux sync.Mutex
+	var userAgents map[string]string
+	BeforeEach(func() {
+		userAgents = make(map[string]string)
+		server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			mux.Lock()
+			userAgents[req.URL.Path] = req.Header.Get("User-Agent")
+			mux.Unlock()
+			switch req.URL.Path {
+			case "/token":
+				fmt.Fprint(resp, `{"token":"abc"}`)
+			case "/v2/team/app/tags/list":
+				if req.Header.Get("Authorization") != "Bearer abc" {
+					resp.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, server.URL))
+					resp.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprint(resp, `{"name":"team/app","tags":["latest"]}`)
+			default:
+				resp.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	listTags := func(options ...docker.ClientOption) {
+		client := docker.NewV2Client(docker.NewHttpClient(http.DefaultClient), docker.Registry{Url: server.URL}, options...)
+		ch := make(chan docker.TagName, 10)
+		Expect(client.ListTags(context.Background(), "team/app", ch)).To(BeNil())
+	}
+	It("sends the default user agent with registry and token requests", func() {
+		listTags()
+		Expect(userAgents).To(HaveKeyWithValue("/v2/team/app/tags/list", docker.DefaultUserAgent()))
+		Expect(userAgents).To(HaveKeyWithValue("/token", docker.DefaultUserAgent()))
+	})
+	It("sends the configured user agent", func() {
+		listTags(docker.WithUserAgent("my-cleaner/1.0"))
+		Expect(userAgents).To(HaveKeyWithValue("/v2/team/app/tags/list", "my-cleaner/1.0"))
+		Expect(userAgents).To(HaveKeyWithValue("/token", "my-cleaner/1.0"))
+	})
+})
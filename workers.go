@@ -0,0 +1,50 @@
+package docker
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// runWorkers calls fn for the indexes 0 to n-1 by concurrency workers reading the indexes from a channel,
+// so the number of goroutines does not grow with n. After the context is canceled the remaining indexes are not started.
+// The errors of fn are combined in index order. concurrency must be positive.
+func runWorkers(ctx context.Context, n int, concurrency int, fn func(i int) error) error {
+	if concurrency > n {
+		concurrency = n
+	}
+	errs := make([]error, n)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	started := 0
+feed:
+	for ; started < n; started++ {
+		select {
+		case <-ctx.Done():
+			break feed
+		case indexes <- started:
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	var result []error
+	for _, err := range errs[:started] {
+		if err != nil {
+			result = append(result, err)
+		}
+	}
+	if started < n {
+		result = append(result, errors.Wrapf(ctx.Err(), "%d of %d not started", n-started, n))
+	}
+	return CombineErrors(result)
+}